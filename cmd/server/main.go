@@ -1,101 +1,263 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
+	"cinerank/internal/auth"
+	"cinerank/internal/cache"
+	"cinerank/internal/config"
 	"cinerank/internal/database"
+	"cinerank/internal/events"
+	"cinerank/internal/gql"
 	"cinerank/internal/handlers"
+	"cinerank/internal/logging"
+	"cinerank/internal/metrics"
+	"cinerank/internal/middleware"
+	"cinerank/internal/migrate"
+	"cinerank/internal/tracing"
+	"cinerank/internal/webhooks"
+	"cinerank/migrations"
 )
 
+// traceFlushTimeout bounds sending the last spans on exit
+const traceFlushTimeout = 5 * time.Second
+
 func main() {
+	// Settings come from defaults, then the config file, then the environment, then flags
+	cfg, cmd, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if cmd.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid configuration:\n", err)
+	}
+
+	// Structured logs; the log package and slog's default write through the same handler
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, level)
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	slog.SetDefault(logger)
+
+	// Traces go nowhere unless an exporter is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		Stdout:      os.Stdout,
+	})
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+
 	// Connect to database
-	db, err := database.Connect()
+	db, err := database.Connect(cfg.Database.URL, database.Options{
+		QueryTimeout:    cfg.Database.QueryTimeout,
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+	})
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		fatal("Failed to connect to database", err)
 	}
 	defer db.Close()
 
-	// Create handler
-	h := handlers.NewHandler(db)
-
-	// Create HTTP router
-	mux := http.NewServeMux()
-
-	// HTML routes
-	mux.HandleFunc("/", h.HomePage)
-	mux.HandleFunc("/search", h.SearchMovies)
-	mux.HandleFunc("/movie/", func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/movie/") {
-			h.MoviePage(w, r)
-		} else {
-			http.NotFound(w, r)
+	// Maintenance subcommands run instead of the server
+	if len(cmd.Args) > 0 {
+		switch cmd.Args[0] {
+		case "migrate":
+			if err := runMigrate(db.DB, cmd.Args[1:]); err != nil {
+				fatal("Migration failed", err)
+			}
+		case "stats":
+			if err := runStats(context.Background(), db, cmd.Args[1:]); err != nil {
+				fatal("Stats rebuild failed", err)
+			}
+		default:
+			fatal("Unknown command "+cmd.Args[0], errors.New(migrateUsage+"\n"+statsUsage))
 		}
-	})
-	mux.HandleFunc("/add-movie", h.AddMovieForm)
-	mux.HandleFunc("/movies", h.CreateMovie)
-	mux.HandleFunc("/review-form", h.AddReviewForm)
-	mux.HandleFunc("/reviews", h.CreateReview)
-	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			h.Login(w, r)
-		} else {
-			h.LoginForm(w, r)
+		return
+	}
+
+	// Optionally bring the schema up to date before serving
+	if cfg.Database.AutoMigrate {
+		if err := runMigrate(db.DB, []string{"up"}); err != nil {
+			fatal("Migration failed", err)
 		}
-	})
-	mux.HandleFunc("/logout", h.Logout)
-	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			h.Register(w, r)
-		} else {
-			h.RegisterForm(w, r)
+	}
+
+	// Background workers run until shutdown, after the HTTP server has drained
+	background, stopBackground := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+
+	// Domain events feed the live page streams; the Postgres bus reaches every replica
+	var bus events.Bus = events.NewMemoryBus()
+	var publisher events.Publisher = bus
+	if cfg.Events.Bus == "postgres" {
+		pgBus, err := events.NewPostgresBus(db.DB, cfg.Database.URL)
+		if err != nil {
+			fatal("Failed to start event bus", err)
 		}
-	})
-	mux.HandleFunc("/admin", h.AdminPanel)
-	mux.HandleFunc("/admin/delete-user/", h.DeleteUser)
-	mux.HandleFunc("/admin/delete-movie/", h.DeleteMovie)
-
-	// API routes
-	mux.HandleFunc("/api/movies", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			h.APIGetMovies(w, r)
-		case http.MethodPost:
-			h.APICreateMovie(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		workers.Go(func() { pgBus.Run(background) })
+		bus = pgBus
+		// Writes NOTIFY in their own transactions, and this instance hears them back like the others
+		db.NotifyEvents = true
+		publisher = nil
+		slog.Info("Events shared through Postgres LISTEN/NOTIFY")
+	}
+	// Prometheus metrics; review counts come from the events the database publishes
+	m := metrics.New()
+	m.RegisterDB(db.DB)
+	db.Events = m.Events(publisher)
+
+	// Create handler
+	h := handlers.NewHandler(db)
+	h.Events = bus
+	h.Metrics = m
+
+	// Cached reads are cleared by every write this instance commits, before its event goes out, and
+	// by writes other instances announce on a shared bus
+	if cfg.Cache.TTL > 0 {
+		lru := cache.NewLRU(cfg.Cache.Size)
+		h.Cache = lru
+		h.CacheTTL = cfg.Cache.TTL
+		db.Events = cache.Invalidating(lru, db.Events)
+		if cfg.Events.Bus == "postgres" {
+			workers.Go(func() { cache.ClearOnEvents(background, lru, bus) })
 		}
-	})
-	
-	mux.HandleFunc("/api/movies/", h.APIGetMovie)
-	mux.HandleFunc("/api/reviews", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			h.APIGetReviews(w, r)
-		case http.MethodPost:
-			h.APICreateReview(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		m.RegisterCache(lru.Len)
+	}
+	m.RegisterSessions(h.ActiveSessions)
+	h.SessionLifetime = cfg.Session.Lifetime
+	h.HomeRecentReviews = cfg.Reviews.HomeRecent
+	h.APIRecentReviews = cfg.Reviews.APIRecent
+
+	// Optional external login through an OpenID Connect provider
+	if cfg.OIDC.IssuerURL != "" {
+		provider, err := auth.NewOIDCProvider(auth.OIDCConfig{
+			Name:         cfg.OIDC.ProviderName,
+			IssuerURL:    cfg.OIDC.IssuerURL,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       cfg.OIDC.Scopes,
+		}, nil)
+		if err != nil {
+			fatal("Invalid OIDC configuration", err)
 		}
-	})
+		h.IdentityProvider = provider
+		slog.Info("OIDC login enabled", "issuer", cfg.OIDC.IssuerURL)
+	}
 
-	// Static assets
+	schema, err := gql.NewSchema()
+	if err != nil {
+		fatal("Invalid GraphQL schema", err)
+	}
+	h.GraphQLSchema = &schema
+
+	// /readyz waits for the database and a schema matching this build's migrations
+	migrator, err := migrate.New(db.DB, migrations.FS)
+	if err != nil {
+		fatal("Invalid migrations", err)
+	}
+	h.ReadinessChecks = []handlers.ReadinessCheck{
+		{Name: "database", Check: db.PingContext},
+		{Name: "migrations", Check: migrator.Check},
+	}
+
+	// Deliver queued webhook events in the background
+	worker := webhooks.NewWorker(db)
+	workers.Go(func() { worker.Run(background) })
+
+	// Routes are declared in handlers/routes.go; only what the handlers cannot serve is added here
 	fs := http.FileServer(http.Dir("static"))
-	mux.Handle("/static/", http.StripPrefix("/static/", fs))
+	routes := h.Routes(
+		handlers.Route{Pattern: "GET /static/", Handler: http.StripPrefix("/static/", fs).ServeHTTP},
+	)
+
+	port := strconv.Itoa(cfg.Server.Port)
+	// Request IDs come first so spans and every later log line can carry them. Panics are recovered
+	// inside logging and metrics, which count them as the 500s they become, and answered with the
+	// same error page or problem as any other server error.
+	handler := middleware.Chain(routes,
+		middleware.RequestID,
+		middleware.Tracing,
+		middleware.Logging(logger),
+		m.Instrument,
+		middleware.Recover(handlers.ServerError),
+		middleware.CSRF,
+		middleware.Compress,
+	)
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	// Live update streams never finish on their own, so end them as soon as draining starts
+	srv.RegisterOnShutdown(bus.Close)
+
+	// The first SIGINT or SIGTERM drains the server; a second one kills it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		fatal("Server failed to start", err)
+	}
 
-	// Get port from environment or default to 8080
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	slog.Info("CineRank server listening", "addr", ln.Addr().String())
+
+	// Metrics get their own listener so they can stay on a private interface, away from the site
+	if cfg.Server.MetricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", m.Handler())
+		metricsSrv := &http.Server{Addr: cfg.Server.MetricsAddr, Handler: metricsMux, ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout}
+		metricsLn, err := net.Listen("tcp", metricsSrv.Addr)
+		if err != nil {
+			fatal("Metrics server failed to start", err)
+		}
+		go metricsSrv.Serve(metricsLn)
+		defer metricsSrv.Close()
+		slog.Info("Metrics listening", "addr", metricsLn.Addr().String())
 	}
 
-	log.Printf("🎬 CineRank server starting on port %s", port)
-	log.Printf("📊 Database connected successfully")
-	log.Printf("🌐 Visit http://localhost:%s to get started", port)
-	
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
-		log.Fatal("Server failed to start:", err)
+	serveErr := serve(ctx, srv, ln, cfg.Server.ShutdownTimeout)
+
+	// Workers stop once no request can queue more work for them; webhook attempts cut short are retried later
+	stopBackground()
+	workers.Wait()
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), traceFlushTimeout)
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
+	}
+	cancelFlush()
+	if serveErr != nil {
+		fatal("Server error", serveErr)
 	}
+	slog.Info("Server stopped")
 }
\ No newline at end of file
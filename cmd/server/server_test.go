@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// startServe runs serve in the background with handler, returning its address and result
+func startServe(t *testing.T, ctx context.Context, srv *http.Server, drainTimeout time.Duration) (string, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx, srv, ln, drainTimeout) }()
+	return "http://" + ln.Addr().String(), done
+}
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	})}
+	hookRan := make(chan struct{})
+	srv.RegisterOnShutdown(func() { close(hookRan) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, done := startServe(t, ctx, srv, 5*time.Second)
+
+	type result struct {
+		body string
+		err  error
+	}
+	resp := make(chan result, 1)
+	go func() {
+		r, err := http.Get(addr)
+		if err != nil {
+			resp <- result{err: err}
+			return
+		}
+		defer r.Body.Close()
+		body, err := io.ReadAll(r.Body)
+		resp <- result{string(body), err}
+	}()
+
+	<-started
+	cancel()
+	if r := <-resp; r.err != nil || r.body != "done" {
+		t.Errorf("in-flight request got %q, %v", r.body, r.err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("serve = %v", err)
+	}
+	<-hookRan
+
+	if _, err := http.Get(addr); err == nil {
+		t.Error("server still accepts requests after shutdown")
+	}
+}
+
+func TestServeGivesUpAfterDrainTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, done := startServe(t, ctx, srv, 50*time.Millisecond)
+	go http.Get(addr)
+
+	<-started
+	cancel()
+	if err := <-done; err == nil {
+		t.Error("serve returned nil with a request still running")
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cinerank/internal/database"
+)
+
+const statsUsage = "usage: server stats rebuild"
+
+// runStats handles `server stats ...`
+func runStats(ctx context.Context, db *database.DB, args []string) error {
+	if len(args) != 1 || args[0] != "rebuild" {
+		return errors.New(statsUsage)
+	}
+	n, err := db.RebuildMovieStats(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Stats rebuilt for %d movie(s)\n", n)
+	return nil
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockIdP is a minimal OpenID Connect provider issuing RS256 ID tokens
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// claims returned for the next token request, and the PKCE challenge it must satisfy
+	claims    map[string]interface{}
+	challenge string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdP{t: t, key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if CodeChallengeS256(r.Form.Get("code_verifier")) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     idp.sign(idp.claims),
+		})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (idp *mockIdP) validClaims(nonce string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":            idp.server.URL,
+		"sub":            "user-123",
+		"aud":            "cinerank",
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          "Jane@Example.com",
+		"email_verified": true,
+		"name":           "Jane Doe",
+	}
+}
+
+func newTestProvider(t *testing.T, idp *mockIdP) *OIDCProvider {
+	t.Helper()
+
+	provider, err := NewOIDCProvider(OIDCConfig{
+		Name:        "Test IdP",
+		IssuerURL:   idp.server.URL,
+		ClientID:    "cinerank",
+		RedirectURL: "http://localhost:8080/auth/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+	}, idp.server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(t, idp)
+
+	raw, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", "challenge-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw, idp.server.URL+"/authorize?") {
+		t.Errorf("unexpected authorization endpoint: %s", raw)
+	}
+
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "cinerank",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "challenge-1",
+		"code_challenge_method": "S256",
+		"scope":                 "openid email",
+	}
+	for key, value := range want {
+		if got := u.Query().Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(t, idp)
+
+	verifier, err := GenerateRandomToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.challenge = CodeChallengeS256(verifier)
+	idp.claims = idp.validClaims("nonce-1")
+
+	identity, err := provider.Exchange(context.Background(), "code", verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+
+	if identity.Subject != "user-123" || identity.Issuer != idp.server.URL {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+	if identity.Email != "jane@example.com" || !identity.EmailVerified {
+		t.Errorf("email not normalized or verified: %+v", identity)
+	}
+}
+
+func TestOIDCExchangeRejectsInvalidTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(claims map[string]interface{})
+		nonce  string
+	}{
+		{"wrong nonce", func(c map[string]interface{}) {}, "other-nonce"},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "someone-else" }, "nonce-1"},
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }, "nonce-1"},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "nonce-1"},
+		{"wrong authorized party", func(c map[string]interface{}) {
+			c["aud"] = []string{"cinerank", "other"}
+			c["azp"] = "other"
+		}, "nonce-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			provider := newTestProvider(t, idp)
+
+			idp.challenge = CodeChallengeS256("verifier")
+			idp.claims = idp.validClaims("nonce-1")
+			tt.mutate(idp.claims)
+
+			if _, err := provider.Exchange(context.Background(), "code", "verifier", tt.nonce); err == nil {
+				t.Fatal("expected Exchange to fail")
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeRejectsBadSignature(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(t, idp)
+
+	// Sign with a key the IdP never published; the JWKS still serves the original one
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.key = otherKey
+	idp.challenge = CodeChallengeS256("verifier")
+	idp.claims = idp.validClaims("nonce-1")
+
+	if _, err := provider.Exchange(context.Background(), "code", "verifier", "nonce-1"); err == nil {
+		t.Fatal("expected signature verification to fail")
+	}
+}
+
+func TestOIDCExchangeRequiresPKCEVerifier(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(t, idp)
+
+	idp.challenge = CodeChallengeS256("expected-verifier")
+	idp.claims = idp.validClaims("nonce-1")
+
+	if _, err := provider.Exchange(context.Background(), "code", "wrong-verifier", "nonce-1"); err == nil {
+		t.Fatal("expected token exchange to fail with the wrong verifier")
+	}
+}
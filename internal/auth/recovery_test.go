@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes", len(codes))
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || seen[code] {
+			t.Errorf("code %q is malformed or repeated", code)
+		}
+		seen[code] = true
+		for _, c := range strings.ReplaceAll(code, "-", "") {
+			if !strings.ContainsRune(recoveryAlphabet, c) {
+				t.Errorf("code %q has %q outside the alphabet", code, c)
+			}
+		}
+	}
+}
+
+func TestHashRecoveryCodeNormalizes(t *testing.T) {
+	want := HashRecoveryCode("abcde-fghjk")
+	for _, code := range []string{"ABCDE-FGHJK", " abcdefghjk ", "abcde fghjk"} {
+		if HashRecoveryCode(code) != want {
+			t.Errorf("%q hashes differently", code)
+		}
+	}
+}
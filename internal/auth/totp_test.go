@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateTOTPCodeMatchesRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes; ours are their last 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := GenerateTOTPCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+		if !ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0)) {
+			t.Errorf("code at %d does not validate", tt.unix)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / 30
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfc6238Secret, "050471", step, true},
+		{"surrounding spaces", rfc6238Secret, " 050471 ", step, true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "050471", step, true},
+		{"previous step", rfc6238Secret, codeAt(t, now.Add(-30*time.Second)), step - 1, true},
+		{"next step", rfc6238Secret, codeAt(t, now.Add(30*time.Second)), step + 1, true},
+		{"two steps ago", rfc6238Secret, codeAt(t, now.Add(-60*time.Second)), 0, false},
+		{"two steps ahead", rfc6238Secret, codeAt(t, now.Add(60*time.Second)), 0, false},
+		{"wrong code", rfc6238Secret, "123456", 0, false},
+		{"too short", rfc6238Secret, "05047", 0, false},
+		{"8 digit RFC code", rfc6238Secret, "14050471", 0, false},
+		{"empty", rfc6238Secret, "", 0, false},
+		{"invalid secret", "not base32!", "050471", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := MatchTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("MatchTOTP = %d, %v, want %d, %v", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func codeAt(t *testing.T, at time.Time) string {
+	t.Helper()
+	code, err := GenerateTOTPCode(rfc6238Secret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
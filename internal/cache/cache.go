@@ -0,0 +1,96 @@
+// Package cache keeps the results of expensive reads, such as the home page aggregates, until a
+// write invalidates them or they expire.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"cinerank/internal/events"
+)
+
+// Cache stores encoded values under keys for up to a TTL. Implementations are safe for concurrent
+// use; LRU keeps values in process, and a shared store such as Redis can implement the same methods.
+type Cache interface {
+	// Get returns the value under key, or false when it is missing or expired
+	Get(ctx context.Context, key string) ([]byte, bool)
+	// Generation changes with every Clear; read it before loading a value to Set
+	Generation(ctx context.Context) uint64
+	// Set stores value under key, unless the cache was cleared since it was at generation, as the
+	// value may then predate the write that cleared it. A ttl of zero keeps it until it is evicted
+	// or cleared.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, generation uint64)
+	// Clear drops every entry
+	Clear(ctx context.Context)
+}
+
+// Entry is a cached result with the time it was loaded, to the second as HTTP dates are
+type Entry[T any] struct {
+	Value  T         `json:"value"`
+	Loaded time.Time `json:"loaded"`
+}
+
+// Load returns the entry cached under key, or calls load and caches what it returns; hit reports
+// which. A nil c always loads. Entries are stored as JSON, so callers never share a value and an
+// entry that no longer decodes counts as a miss.
+func Load[T any](ctx context.Context, c Cache, key string, ttl time.Duration, load func(context.Context) (T, error)) (entry Entry[T], hit bool, err error) {
+	var generation uint64
+	if c != nil {
+		if data, ok := c.Get(ctx, key); ok && json.Unmarshal(data, &entry) == nil {
+			return entry, true, nil
+		}
+		// A write that commits while load runs clears the cache after it, so what load returns
+		// must not be stored then
+		generation = c.Generation(ctx)
+	}
+
+	value, err := load(ctx)
+	if err != nil {
+		return Entry[T]{}, false, err
+	}
+	entry = Entry[T]{Value: value, Loaded: time.Now().UTC().Truncate(time.Second)}
+	if c != nil {
+		if data, err := json.Marshal(entry); err == nil {
+			c.Set(ctx, key, data, ttl, generation)
+		}
+	}
+	return entry, false, nil
+}
+
+// Invalidating wraps next so that every published event clears c first. The cached reads are
+// aggregates over movies, reviews, tags and their authors, so any change can alter them.
+func Invalidating(c Cache, next events.Publisher) events.Publisher {
+	return &invalidatingPublisher{c: c, next: next}
+}
+
+type invalidatingPublisher struct {
+	c    Cache
+	next events.Publisher
+}
+
+func (p *invalidatingPublisher) Publish(e events.Event) {
+	p.c.Clear(context.Background())
+	if p.next != nil {
+		p.next.Publish(e)
+	}
+}
+
+// ClearOnEvents clears c whenever bus delivers an event, so an in-process cache also forgets what
+// other instances changed. It returns when ctx ends or the bus closes.
+func ClearOnEvents(ctx context.Context, c Cache, bus events.Bus) {
+	sub, cancel := bus.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-sub:
+			if !ok {
+				return
+			}
+			c.Clear(ctx)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cinerank/internal/events"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := t.Context()
+	c := NewLRU(2)
+	c.Set(ctx, "a", []byte("1"), 0, 0)
+	c.Set(ctx, "b", []byte("2"), 0, 0)
+	c.Get(ctx, "a") // b is now the least recently used
+	c.Set(ctx, "c", []byte("3"), 0, 0)
+
+	if _, ok := c.Get(ctx, "b"); ok {
+		t.Error("b survived eviction")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(ctx, key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+
+	c.Set(ctx, "a", []byte("4"), 0, 0)
+	if v, _ := c.Get(ctx, "a"); string(v) != "4" || c.Len() != 2 {
+		t.Errorf("after overwrite: a = %s, len = %d", v, c.Len())
+	}
+
+	c.Clear(ctx)
+	if _, ok := c.Get(ctx, "a"); ok || c.Len() != 0 {
+		t.Error("entries survived Clear")
+	}
+}
+
+func TestLRUExpiresEntries(t *testing.T) {
+	ctx := t.Context()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := NewLRU(10)
+	c.now = func() time.Time { return now }
+
+	c.Set(ctx, "movies", []byte("[]"), time.Minute, 0)
+	c.Set(ctx, "forever", []byte("[]"), 0, 0)
+
+	now = now.Add(59 * time.Second)
+	if _, ok := c.Get(ctx, "movies"); !ok {
+		t.Error("entry expired early")
+	}
+	now = now.Add(time.Second)
+	if _, ok := c.Get(ctx, "movies"); ok {
+		t.Error("entry outlived its TTL")
+	}
+	if _, ok := c.Get(ctx, "forever"); !ok {
+		t.Error("entry without a TTL expired")
+	}
+	if c.Len() != 1 {
+		t.Errorf("len = %d, the expired entry should be gone", c.Len())
+	}
+}
+
+func TestLoadCachesUntilInvalidated(t *testing.T) {
+	ctx := t.Context()
+	c := NewLRU(10)
+	loads := 0
+	load := func(context.Context) ([]string, error) {
+		loads++
+		return []string{"Cidade de Deus"}, nil
+	}
+
+	first, hit, err := Load(ctx, c, "movies", time.Minute, load)
+	if err != nil || hit || loads != 1 {
+		t.Fatalf("first load: hit = %v, loads = %d, err = %v", hit, loads, err)
+	}
+	if first.Loaded.Nanosecond() != 0 {
+		t.Errorf("Loaded = %v, want whole seconds", first.Loaded)
+	}
+
+	second, hit, _ := Load(ctx, c, "movies", time.Minute, load)
+	if !hit || loads != 1 || second.Value[0] != "Cidade de Deus" || !second.Loaded.Equal(first.Loaded) {
+		t.Errorf("second load: hit = %v, loads = %d, entry = %+v", hit, loads, second)
+	}
+	// Values are decoded afresh, so callers cannot change what others read
+	second.Value[0] = "changed"
+	if third, _, _ := Load(ctx, c, "movies", time.Minute, load); third.Value[0] != "Cidade de Deus" {
+		t.Error("a caller's change reached the cache")
+	}
+
+	next := &recordingPublisher{}
+	Invalidating(c, next).Publish(events.Event{Type: events.TypeReviewCreated})
+	if len(next.got) != 1 {
+		t.Error("event was not passed on")
+	}
+	if _, hit, _ := Load(ctx, c, "movies", time.Minute, load); hit || loads != 2 {
+		t.Errorf("after an event: hit = %v, loads = %d", hit, loads)
+	}
+}
+
+func TestLoadDropsValuesLoadedBeforeAClear(t *testing.T) {
+	ctx := t.Context()
+	c := NewLRU(10)
+
+	// A write commits and clears the cache while the reader is still loading what it replaced
+	entry, _, err := Load(ctx, c, "movies", time.Minute, func(context.Context) (string, error) {
+		Invalidating(c, nil).Publish(events.Event{Type: events.TypeMovieUpdated})
+		return "stale", nil
+	})
+	if err != nil || entry.Value != "stale" {
+		t.Fatalf("entry = %+v, err = %v", entry, err)
+	}
+	if c.Len() != 0 {
+		t.Error("a value loaded before the clear was cached")
+	}
+
+	entry, hit, _ := Load(ctx, c, "movies", time.Minute, func(context.Context) (string, error) { return "fresh", nil })
+	if hit || entry.Value != "fresh" {
+		t.Errorf("after the clear: hit = %v, entry = %+v", hit, entry)
+	}
+	if entry, hit, _ := Load(ctx, c, "movies", time.Minute, func(context.Context) (string, error) { return "again", nil }); !hit || entry.Value != "fresh" {
+		t.Errorf("a value loaded after the clear was not cached: hit = %v, entry = %+v", hit, entry)
+	}
+
+	generation := c.Generation(ctx)
+	c.Clear(ctx)
+	c.Set(ctx, "movies", []byte(`{"value":"stale"}`), 0, generation)
+	if _, ok := c.Get(ctx, "movies"); ok {
+		t.Error("Set stored a value from before the clear")
+	}
+}
+
+func TestLoadDoesNotCacheErrors(t *testing.T) {
+	ctx := t.Context()
+	c := NewLRU(10)
+	failure := errors.New("database is down")
+	if _, _, err := Load(ctx, c, "movies", time.Minute, func(context.Context) (int, error) { return 0, failure }); err != failure {
+		t.Fatalf("err = %v", err)
+	}
+	if c.Len() != 0 {
+		t.Error("failed load was cached")
+	}
+
+	// Without a cache every call loads
+	entry, hit, _ := Load(ctx, nil, "movies", time.Minute, func(context.Context) (int, error) { return 7, nil })
+	if hit || entry.Value != 7 {
+		t.Errorf("nil cache: hit = %v, entry = %+v", hit, entry)
+	}
+}
+
+func TestClearOnEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	c := NewLRU(10)
+	bus := events.NewMemoryBus()
+	done := make(chan struct{})
+	go func() {
+		ClearOnEvents(ctx, c, bus)
+		close(done)
+	}()
+
+	c.Set(ctx, "movies", []byte("[]"), 0, 0)
+	// The subscription starts in the goroutine, so publish until the entry goes
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("cache was not cleared")
+		}
+		bus.Publish(events.Event{Type: events.TypeMovieDeleted})
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
+
+type recordingPublisher struct{ got []events.Event }
+
+func (p *recordingPublisher) Publish(e events.Event) { p.got = append(p.got, e) }
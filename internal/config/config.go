@@ -0,0 +1,359 @@
+// Package config loads the server settings from defaults, a YAML file, environment variables and
+// command-line flags, each source overriding the ones before it.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigEnv names the config file when --config is not given
+const ConfigEnv = "CINERANK_CONFIG"
+
+type Config struct {
+	Server   Server   `yaml:"server"`
+	Database Database `yaml:"database"`
+	Session  Session  `yaml:"session"`
+	Reviews  Reviews  `yaml:"reviews"`
+	Events   Events   `yaml:"events"`
+	Cache    Cache    `yaml:"cache"`
+	OIDC     OIDC     `yaml:"oidc"`
+	Log      Log      `yaml:"log"`
+	Tracing  Tracing  `yaml:"tracing"`
+}
+
+type Server struct {
+	Port              int           `yaml:"port"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	// WriteTimeout does not apply to live update streams
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is how long in-flight requests get to finish on SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// MetricsAddr is the host:port /metrics is served on, apart from the site; empty disables it
+	MetricsAddr string `yaml:"metrics_addr"`
+}
+
+type Database struct {
+	URL string `yaml:"url"`
+	// QueryTimeout bounds each database call; zero disables it
+	QueryTimeout    time.Duration `yaml:"query_timeout"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	// AutoMigrate applies pending migrations on startup
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+type Session struct {
+	Lifetime time.Duration `yaml:"lifetime"`
+}
+
+// Reviews sets how many recent reviews the home page and the legacy /api/reviews list show
+type Reviews struct {
+	HomeRecent int `yaml:"home_recent"`
+	APIRecent  int `yaml:"api_recent"`
+}
+
+type Events struct {
+	// Bus is "memory" or "postgres", which shares events across replicas
+	Bus string `yaml:"bus"`
+}
+
+// Cache keeps the movie list, recent reviews and single movies until a write clears them
+type Cache struct {
+	// Size is how many entries the in-process cache holds
+	Size int `yaml:"size"`
+	// TTL bounds how long an entry lives when no write clears it; zero disables the cache
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// OIDC enables external login when IssuerURL is set
+type OIDC struct {
+	IssuerURL    string   `yaml:"issuer_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	ProviderName string   `yaml:"provider_name"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+type Log struct {
+	// Level is debug, info, warn or error
+	Level string `yaml:"level"`
+	// Format is "json" or "text", which reads better in a terminal
+	Format string `yaml:"format"`
+}
+
+type Tracing struct {
+	// Exporter is none, stdout or otlp, which reads the standard OTEL_EXPORTER_OTLP_* variables
+	Exporter string `yaml:"exporter"`
+	// SampleRatio is the share of new traces recorded, from 0 to 1
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// Default returns the settings used when no source sets them
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:              8080,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		Database: Database{
+			QueryTimeout:    5 * time.Second,
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Session: Session{Lifetime: 24 * time.Hour},
+		Reviews: Reviews{HomeRecent: 5, APIRecent: 10},
+		Events:  Events{Bus: "memory"},
+		Cache:   Cache{Size: 1000, TTL: 5 * time.Minute},
+		OIDC: OIDC{
+			ProviderName: "SSO",
+			Scopes:       []string{"openid", "email", "profile"},
+		},
+		Log:     Log{Level: "info", Format: "json"},
+		Tracing: Tracing{Exporter: "none", SampleRatio: 1},
+	}
+}
+
+// Command is what is left of the command line once the settings are taken out
+type Command struct {
+	// PrintConfig asks for the effective configuration instead of a server
+	PrintConfig bool
+	// Args holds a subcommand and its arguments, e.g. "migrate up"
+	Args []string
+}
+
+// envVars maps each flag to the environment variable that sets the same field
+var envVars = map[string]string{
+	"port":                 "PORT",
+	"metrics-addr":         "METRICS_ADDR",
+	"read-header-timeout":  "HTTP_READ_HEADER_TIMEOUT",
+	"read-timeout":         "HTTP_READ_TIMEOUT",
+	"write-timeout":        "HTTP_WRITE_TIMEOUT",
+	"idle-timeout":         "HTTP_IDLE_TIMEOUT",
+	"shutdown-timeout":     "SHUTDOWN_TIMEOUT",
+	"database-url":         "DATABASE_URL",
+	"db-query-timeout":     "DB_QUERY_TIMEOUT",
+	"db-max-open-conns":    "DB_MAX_OPEN_CONNS",
+	"db-max-idle-conns":    "DB_MAX_IDLE_CONNS",
+	"db-conn-max-lifetime": "DB_CONN_MAX_LIFETIME",
+	"auto-migrate":         "AUTO_MIGRATE",
+	"session-lifetime":     "SESSION_LIFETIME",
+	"home-recent-reviews":  "HOME_RECENT_REVIEWS",
+	"api-recent-reviews":   "API_RECENT_REVIEWS",
+	"event-bus":            "EVENT_BUS",
+	"cache-size":           "CACHE_SIZE",
+	"cache-ttl":            "CACHE_TTL",
+	"oidc-issuer-url":      "OIDC_ISSUER_URL",
+	"oidc-client-id":       "OIDC_CLIENT_ID",
+	"oidc-client-secret":   "OIDC_CLIENT_SECRET",
+	"oidc-redirect-url":    "OIDC_REDIRECT_URL",
+	"oidc-provider-name":   "OIDC_PROVIDER_NAME",
+	"oidc-scopes":          "OIDC_SCOPES",
+	"log-level":            "LOG_LEVEL",
+	"log-format":           "LOG_FORMAT",
+	"tracing-exporter":     "TRACING_EXPORTER",
+	"tracing-sample-ratio": "TRACING_SAMPLE_RATIO",
+}
+
+// settingFlags registers a flag for every setting, bound to the fields of c
+func settingFlags(fs *flag.FlagSet, c *Config) {
+	fs.IntVar(&c.Server.Port, "port", c.Server.Port, "HTTP port")
+	fs.StringVar(&c.Server.MetricsAddr, "metrics-addr", c.Server.MetricsAddr, "host:port serving /metrics, empty to disable")
+	fs.DurationVar(&c.Server.ReadHeaderTimeout, "read-header-timeout", c.Server.ReadHeaderTimeout, "time to read request headers")
+	fs.DurationVar(&c.Server.ReadTimeout, "read-timeout", c.Server.ReadTimeout, "time to read a whole request, 0 for no limit")
+	fs.DurationVar(&c.Server.WriteTimeout, "write-timeout", c.Server.WriteTimeout, "time to write a response, 0 for no limit")
+	fs.DurationVar(&c.Server.IdleTimeout, "idle-timeout", c.Server.IdleTimeout, "how long keep-alive connections wait for the next request")
+	fs.DurationVar(&c.Server.ShutdownTimeout, "shutdown-timeout", c.Server.ShutdownTimeout, "how long in-flight requests get to finish on shutdown")
+	fs.StringVar(&c.Database.URL, "database-url", c.Database.URL, "PostgreSQL connection string")
+	fs.DurationVar(&c.Database.QueryTimeout, "db-query-timeout", c.Database.QueryTimeout, "deadline for each database call, 0 to disable")
+	fs.IntVar(&c.Database.MaxOpenConns, "db-max-open-conns", c.Database.MaxOpenConns, "maximum open database connections, 0 for no limit")
+	fs.IntVar(&c.Database.MaxIdleConns, "db-max-idle-conns", c.Database.MaxIdleConns, "maximum idle database connections")
+	fs.DurationVar(&c.Database.ConnMaxLifetime, "db-conn-max-lifetime", c.Database.ConnMaxLifetime, "maximum age of a database connection, 0 for no limit")
+	fs.BoolVar(&c.Database.AutoMigrate, "auto-migrate", c.Database.AutoMigrate, "apply pending migrations on startup")
+	fs.DurationVar(&c.Session.Lifetime, "session-lifetime", c.Session.Lifetime, "how long a sign-in lasts")
+	fs.IntVar(&c.Reviews.HomeRecent, "home-recent-reviews", c.Reviews.HomeRecent, "recent reviews shown on the home page")
+	fs.IntVar(&c.Reviews.APIRecent, "api-recent-reviews", c.Reviews.APIRecent, "recent reviews returned by /api/reviews")
+	fs.StringVar(&c.Events.Bus, "event-bus", c.Events.Bus, `event bus, "memory" or "postgres"`)
+	fs.IntVar(&c.Cache.Size, "cache-size", c.Cache.Size, "entries held by the in-process cache")
+	fs.DurationVar(&c.Cache.TTL, "cache-ttl", c.Cache.TTL, "how long cached reads live without a write, 0 to disable the cache")
+	fs.StringVar(&c.OIDC.IssuerURL, "oidc-issuer-url", c.OIDC.IssuerURL, "OpenID Connect issuer; enables SSO login")
+	fs.StringVar(&c.OIDC.ClientID, "oidc-client-id", c.OIDC.ClientID, "OIDC client ID")
+	fs.StringVar(&c.OIDC.ClientSecret, "oidc-client-secret", c.OIDC.ClientSecret, "OIDC client secret")
+	fs.StringVar(&c.OIDC.RedirectURL, "oidc-redirect-url", c.OIDC.RedirectURL, "callback URL registered with the IdP")
+	fs.StringVar(&c.OIDC.ProviderName, "oidc-provider-name", c.OIDC.ProviderName, "label on the SSO login button")
+	fs.Var((*scopes)(&c.OIDC.Scopes), "oidc-scopes", "space or comma separated OIDC scopes")
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "minimum log level: debug, info, warn or error")
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format, `log format, "json" or "text"`)
+	fs.StringVar(&c.Tracing.Exporter, "tracing-exporter", c.Tracing.Exporter, "trace exporter: none, stdout or otlp")
+	fs.Float64Var(&c.Tracing.SampleRatio, "tracing-sample-ratio", c.Tracing.SampleRatio, "share of new traces recorded, from 0 to 1")
+}
+
+// scopes reads a list separated by spaces or commas
+type scopes []string
+
+func (s *scopes) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *scopes) Set(value string) error {
+	*s = strings.Fields(strings.ReplaceAll(value, ",", " "))
+	return nil
+}
+
+// Load builds the configuration from args (without the program name) and getenv.
+// The config file is named by --config or CINERANK_CONFIG; settings it leaves out keep their defaults.
+func Load(args []string, getenv func(string) string) (*Config, *Command, error) {
+	// Flags are parsed into a scratch copy first, as they must win over the file they may name
+	fs := flag.NewFlagSet("cinerank", flag.ContinueOnError)
+	path := fs.String("config", getenv(ConfigEnv), "YAML config file")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration, secrets redacted, and exit")
+	settingFlags(fs, Default())
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	bound := flag.NewFlagSet("cinerank", flag.ContinueOnError)
+	settingFlags(bound, cfg)
+	for name, env := range envVars {
+		if value := getenv(env); value != "" {
+			if err := bound.Set(name, value); err != nil {
+				return nil, nil, fmt.Errorf("invalid %s %q: %w", env, value, err)
+			}
+		}
+	}
+	// Setting the same value again cannot fail, as the scratch flags already accepted it
+	fs.Visit(func(f *flag.Flag) {
+		if bound.Lookup(f.Name) != nil {
+			bound.Set(f.Name, f.Value.String())
+		}
+	})
+
+	return cfg, &Command{PrintConfig: *printConfig, Args: fs.Args()}, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once, naming each by its config file key
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535")
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout must be positive")
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	if c.Server.MetricsAddr != "" {
+		_, port, err := net.SplitHostPort(c.Server.MetricsAddr)
+		check(err == nil && port != "" && port != strconv.Itoa(c.Server.Port), "server.metrics_addr must be a host:port apart from server.port, got %q", c.Server.MetricsAddr)
+	}
+	check(c.Database.URL != "", "database.url is required (or DATABASE_URL)")
+	check(c.Database.QueryTimeout >= 0, "database.query_timeout must not be negative")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Session.Lifetime > 0, "session.lifetime must be positive")
+	check(c.Reviews.HomeRecent > 0, "reviews.home_recent must be positive")
+	check(c.Reviews.APIRecent > 0, "reviews.api_recent must be positive")
+	check(c.Events.Bus == "memory" || c.Events.Bus == "postgres", `events.bus must be "memory" or "postgres", got %q`, c.Events.Bus)
+	check(c.Cache.Size > 0, "cache.size must be positive")
+	check(c.Cache.TTL >= 0, "cache.ttl must not be negative")
+	if c.OIDC.IssuerURL != "" {
+		check(c.OIDC.ClientID != "", "oidc.client_id is required when oidc.issuer_url is set")
+		check(c.OIDC.RedirectURL != "", "oidc.redirect_url is required when oidc.issuer_url is set")
+		check(len(c.OIDC.Scopes) > 0, "oidc.scopes must not be empty")
+	}
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	check(c.Log.Format == "json" || c.Log.Format == "text", `log.format must be "json" or "text", got %q`, c.Log.Format)
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		check(false, "tracing.exporter must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+	return errors.Join(errs...)
+}
+
+// Print writes c as a config file with its secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	redacted := *c
+	redacted.Database.URL = redactURL(c.Database.URL)
+	if c.OIDC.ClientSecret != "" {
+		redacted.OIDC.ClientSecret = "REDACTED"
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&redacted); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// redactURL hides the password in a connection URL, or all of a key=value connection string
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		if raw == "" {
+			return ""
+		}
+		return "REDACTED"
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+	}
+	q := u.Query()
+	if q.Has("password") {
+		q.Set("password", "REDACTED")
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
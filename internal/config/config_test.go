@@ -0,0 +1,134 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cinerank.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFlagsOverrideEnvOverrideFile(t *testing.T) {
+	path := writeFile(t, `
+server:
+  port: 9000
+database:
+  url: postgres://file
+  query_timeout: 2s
+session:
+  lifetime: 1h
+`)
+	cfg, cmd, err := Load(
+		[]string{"--port", "9100", "--oidc-scopes", "openid,email", "migrate", "up"},
+		env(map[string]string{ConfigEnv: path, "PORT": "9050", "DB_QUERY_TIMEOUT": "3s"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Server.Port != 9100 {
+		t.Errorf("port = %d, want the flag's", cfg.Server.Port)
+	}
+	if cfg.Database.QueryTimeout != 3*time.Second {
+		t.Errorf("query timeout = %v, want the env's", cfg.Database.QueryTimeout)
+	}
+	if cfg.Database.URL != "postgres://file" || cfg.Session.Lifetime != time.Hour {
+		t.Errorf("file settings lost: %+v", cfg)
+	}
+	if cfg.Reviews.HomeRecent != 5 || cfg.Database.MaxOpenConns != 10 {
+		t.Errorf("defaults lost: %+v", cfg)
+	}
+	if strings.Join(cfg.OIDC.Scopes, " ") != "openid email" {
+		t.Errorf("scopes = %q", cfg.OIDC.Scopes)
+	}
+	if strings.Join(cmd.Args, " ") != "migrate up" || cmd.PrintConfig {
+		t.Errorf("command = %+v", cmd)
+	}
+}
+
+func TestLoadRejectsBadInput(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"unknown file key", []string{"--config", writeFile(t, "sever:\n  port: 1\n")}, nil, "field sever not found"},
+		{"bad env value", nil, map[string]string{"DB_MAX_OPEN_CONNS": "many"}, "DB_MAX_OPEN_CONNS"},
+		{"bad flag value", []string{"--session-lifetime", "forever"}, nil, "session-lifetime"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Load(tt.args, env(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want mention of %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEverySetting(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = 0
+	cfg.Events.Bus = "kafka"
+	cfg.Cache.Size = 0
+	cfg.OIDC.IssuerURL = "https://login.example.com"
+	cfg.Server.MetricsAddr = "9090"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid config accepted")
+	}
+	for _, key := range []string{"server.port", "server.metrics_addr", "database.url", "events.bus", "cache.size", "oidc.client_id", "oidc.redirect_url"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error does not mention %s: %v", key, err)
+		}
+	}
+
+	cfg = Default()
+	cfg.Database.URL = "postgres://localhost/cinerank"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("defaults with a database rejected: %v", err)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "postgres://app:hunter2@db:5432/cinerank?sslmode=disable"
+	cfg.OIDC.ClientSecret = "s3cr3t"
+
+	var out strings.Builder
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "hunter2") || strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("secret printed:\n%s", out.String())
+	}
+	for _, want := range []string{"postgres://app:REDACTED@db:5432/cinerank", "query_timeout: 5s", "client_secret: REDACTED"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	// The printed configuration loads back as a config file
+	if _, _, err := Load([]string{"--config", writeFile(t, out.String())}, env(nil)); err != nil {
+		t.Errorf("printed config does not load: %v", err)
+	}
+	if got := redactURL("host=db user=app password=hunter2"); got != "REDACTED" {
+		t.Errorf("key=value connection string printed as %q", got)
+	}
+}
@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cinerank/internal/models"
+)
+
+// rankingOrders are the ORDER BY clauses of the movie rankings, over movieStatsJoin
+var rankingOrders = map[string]string{
+	models.RankMostReviewed: "s.review_count DESC, m.id DESC",
+	models.RankHighestRated: "s.rating_sum::float / s.review_count DESC, s.review_count DESC, m.id DESC",
+	models.RankLowestRated:  "s.rating_sum::float / s.review_count ASC, s.review_count DESC, m.id DESC",
+}
+
+// TruncateToPeriod returns the start of the UTC day or week holding t, as date_trunc does in the
+// analytics queries: weeks start on Monday
+func TruncateToPeriod(t time.Time, period string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if period == models.PeriodWeek {
+		// Weekday counts from Sunday
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day
+}
+
+// utcDate reads back a date_trunc of a UTC timestamp, a timestamp without time zone, as UTC
+func utcDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (db *DB) GetActivity(ctx context.Context, period string, since time.Time) ([]models.ActivityCount, error) {
+	ctx, end := db.begin(ctx, "GetActivity")
+	defer end()
+
+	if period != models.PeriodDay && period != models.PeriodWeek {
+		return nil, fmt.Errorf("unknown analytics period %q", period)
+	}
+
+	query := `
+		SELECT period, SUM(users), SUM(reviews)
+		FROM (
+			SELECT date_trunc($1, created_at AT TIME ZONE 'UTC') AS period, 1 AS users, 0 AS reviews
+			FROM users WHERE created_at >= $2
+			UNION ALL
+			SELECT date_trunc($1, created_at AT TIME ZONE 'UTC'), 0, 1
+			FROM reviews WHERE created_at >= $2
+		) activity
+		GROUP BY period
+		ORDER BY period
+	`
+
+	rows, err := db.QueryContext(ctx, query, period, since)
+	if err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	defer rows.Close()
+
+	activity := []models.ActivityCount{}
+	for rows.Next() {
+		var a models.ActivityCount
+		if err := rows.Scan(&a.Start, &a.NewUsers, &a.Reviews); err != nil {
+			return nil, wrapError(ctx, "review", err)
+		}
+		a.Start = utcDate(a.Start)
+		activity = append(activity, a)
+	}
+
+	recordRows(ctx, len(activity))
+	return activity, wrapError(ctx, "review", rows.Err())
+}
+
+func (db *DB) GetTopReviewers(ctx context.Context, limit int) ([]models.ReviewerStats, error) {
+	ctx, end := db.begin(ctx, "GetTopReviewers")
+	defer end()
+
+	query := `
+		SELECT u.id, u.username, COUNT(*), AVG(r.rating::float), MAX(r.created_at)
+		FROM reviews r
+		JOIN users u ON r.user_id = u.id
+		GROUP BY u.id, u.username
+		ORDER BY COUNT(*) DESC, u.id
+		LIMIT $1
+	`
+
+	rows, err := db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, wrapError(ctx, "user", err)
+	}
+	defer rows.Close()
+
+	reviewers := []models.ReviewerStats{}
+	for rows.Next() {
+		var rs models.ReviewerStats
+		if err := rows.Scan(&rs.UserID, &rs.Username, &rs.ReviewCount, &rs.AverageRating, &rs.LastReviewedAt); err != nil {
+			return nil, wrapError(ctx, "user", err)
+		}
+		reviewers = append(reviewers, rs)
+	}
+
+	recordRows(ctx, len(reviewers))
+	return reviewers, wrapError(ctx, "user", rows.Err())
+}
+
+func (db *DB) GetRankedMovies(ctx context.Context, ranking string, minReviews, limit int) ([]models.MovieWithStats, error) {
+	ctx, end := db.begin(ctx, "GetRankedMovies")
+	defer end()
+
+	order, ok := rankingOrders[ranking]
+	if !ok {
+		return nil, fmt.Errorf("unknown movie ranking %q", ranking)
+	}
+	// Movies without reviews have no movie_stats row, or one with no reviews left
+	query := `
+		SELECT ` + movieWithStatsColumns + ` FROM movies m ` + movieStatsJoin + `
+		WHERE s.review_count >= GREATEST($1, 1)
+		ORDER BY ` + order + `
+		LIMIT $2
+	`
+
+	rows, err := db.QueryContext(ctx, query, minReviews, limit)
+	if err != nil {
+		return nil, wrapError(ctx, "movie", err)
+	}
+	defer rows.Close()
+
+	movies := []models.MovieWithStats{}
+	for rows.Next() {
+		m, err := scanMovieWithStats(rows)
+		if err != nil {
+			return nil, wrapError(ctx, "movie", err)
+		}
+		movies = append(movies, m)
+	}
+
+	recordRows(ctx, len(movies))
+	return movies, wrapError(ctx, "movie", rows.Err())
+}
+
+func (db *DB) GetTagPopularity(ctx context.Context, limit int) ([]models.TagStats, error) {
+	ctx, end := db.begin(ctx, "GetTagPopularity")
+	defer end()
+
+	query := `
+		SELECT t.id, t.name, COUNT(mt.movie_id), COALESCE(SUM(s.review_count), 0),
+			COALESCE(SUM(s.rating_sum)::float / NULLIF(SUM(s.review_count), 0), 0)
+		FROM tags t
+		LEFT JOIN movie_tags mt ON mt.tag_id = t.id
+		LEFT JOIN movie_stats s ON s.movie_id = mt.movie_id
+		GROUP BY t.id, t.name
+		ORDER BY 4 DESC, 3 DESC, t.name
+		LIMIT $1
+	`
+
+	rows, err := db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, wrapError(ctx, "tag", err)
+	}
+	defer rows.Close()
+
+	tags := []models.TagStats{}
+	for rows.Next() {
+		var ts models.TagStats
+		if err := rows.Scan(&ts.TagID, &ts.Name, &ts.MovieCount, &ts.ReviewCount, &ts.AverageRating); err != nil {
+			return nil, wrapError(ctx, "tag", err)
+		}
+		tags = append(tags, ts)
+	}
+
+	recordRows(ctx, len(tags))
+	return tags, wrapError(ctx, "tag", rows.Err())
+}
+
+func (db *DB) GetRatingTrend(ctx context.Context, since time.Time) ([]models.RatingTrend, error) {
+	ctx, end := db.begin(ctx, "GetRatingTrend")
+	defer end()
+
+	query := `
+		SELECT date_trunc('month', created_at AT TIME ZONE 'UTC') AS month, COUNT(*),
+			AVG(rating::float), COUNT(*) FILTER (WHERE rating = 5)
+		FROM reviews
+		WHERE created_at >= $1
+		GROUP BY month
+		ORDER BY month
+	`
+
+	rows, err := db.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	defer rows.Close()
+
+	trend := []models.RatingTrend{}
+	for rows.Next() {
+		var rt models.RatingTrend
+		if err := rows.Scan(&rt.Month, &rt.ReviewCount, &rt.AverageRating, &rt.FiveStarCount); err != nil {
+			return nil, wrapError(ctx, "review", err)
+		}
+		rt.Month = utcDate(rt.Month)
+		trend = append(trend, rt)
+	}
+
+	recordRows(ctx, len(trend))
+	return trend, wrapError(ctx, "review", rows.Err())
+}
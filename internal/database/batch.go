@@ -0,0 +1,264 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"cinerank/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// Batched lookups used by the GraphQL loaders. Pages are keyset-paginated on
+// id, newest first: afterID 0 starts at the top, limit caps rows per parent.
+
+const movieWithStatsColumns = `
+	m.id, m.title, m.director, m.year, COALESCE(m.plot, ''), COALESCE(m.poster_url, ''),
+	COALESCE(m.imdb_rating, 0), m.created_at, m.updated_at,
+	COALESCE(s.review_count, 0), COALESCE(s.rating_sum::float / NULLIF(s.review_count, 0), 0)
+`
+
+// Review stats come from movie_stats, one row per movie, so tag joins cannot inflate them
+const movieStatsJoin = `
+	LEFT JOIN movie_stats s ON s.movie_id = m.id
+`
+
+func scanMovieWithStats(rows *sql.Rows, dest ...interface{}) (models.MovieWithStats, error) {
+	var m models.MovieWithStats
+	err := rows.Scan(append(dest,
+		&m.ID, &m.Title, &m.Director, &m.Year, &m.Plot, &m.PosterURL,
+		&m.IMDBRating, &m.CreatedAt, &m.UpdatedAt,
+		&m.ReviewCount, &m.AverageRating,
+	)...)
+	return m, err
+}
+
+func (db *DB) GetMoviesWithStatsByIDs(ctx context.Context, ids []int) (map[int]*models.MovieWithStats, error) {
+	ctx, end := db.begin(ctx, "GetMoviesWithStatsByIDs")
+	defer end()
+
+	query := `SELECT ` + movieWithStatsColumns + ` FROM movies m ` + movieStatsJoin + ` WHERE m.id = ANY($1)`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, wrapError(ctx, "movie", err)
+	}
+	defer rows.Close()
+
+	movies := make(map[int]*models.MovieWithStats, len(ids))
+	for rows.Next() {
+		m, err := scanMovieWithStats(rows)
+		if err != nil {
+			return nil, wrapError(ctx, "movie", err)
+		}
+		movies[m.ID] = &m
+	}
+	recordRows(ctx, len(movies))
+	return movies, wrapError(ctx, "movie", rows.Err())
+}
+
+// ListMoviesPage lists movies newest first, optionally filtered by title or tag
+func (db *DB) ListMoviesPage(ctx context.Context, search string, limit, afterID int) ([]models.MovieWithStats, error) {
+	ctx, end := db.begin(ctx, "ListMoviesPage")
+	defer end()
+
+	query := `
+		SELECT ` + movieWithStatsColumns + ` FROM movies m ` + movieStatsJoin + `
+		WHERE ($2 = 0 OR m.id < $2)
+		  AND ($3 = '' OR LOWER(m.title) LIKE '%' || LOWER($3) || '%' OR EXISTS (
+			SELECT 1 FROM movie_tags mt JOIN tags t ON mt.tag_id = t.id
+			WHERE mt.movie_id = m.id AND LOWER(t.name) LIKE '%' || LOWER($3) || '%'
+		  ))
+		ORDER BY m.id DESC
+		LIMIT $1
+	`
+
+	rows, err := db.QueryContext(ctx, query, limit, afterID, search)
+	if err != nil {
+		return nil, wrapError(ctx, "movie", err)
+	}
+	defer rows.Close()
+
+	movies := []models.MovieWithStats{}
+	for rows.Next() {
+		m, err := scanMovieWithStats(rows)
+		if err != nil {
+			return nil, wrapError(ctx, "movie", err)
+		}
+		movies = append(movies, m)
+	}
+	recordRows(ctx, len(movies))
+	return movies, wrapError(ctx, "movie", rows.Err())
+}
+
+func (db *DB) GetMoviePagesByTagIDs(ctx context.Context, tagIDs []int, limit, afterID int) (map[int][]models.MovieWithStats, error) {
+	ctx, end := db.begin(ctx, "GetMoviePagesByTagIDs")
+	defer end()
+
+	query := `
+		SELECT p.tag_id, ` + movieWithStatsColumns + `
+		FROM (
+			SELECT mt.tag_id, mt.movie_id,
+				   ROW_NUMBER() OVER (PARTITION BY mt.tag_id ORDER BY mt.movie_id DESC) AS rn
+			FROM movie_tags mt
+			WHERE mt.tag_id = ANY($1) AND ($3 = 0 OR mt.movie_id < $3)
+		) p
+		JOIN movies m ON m.id = p.movie_id
+		` + movieStatsJoin + `
+		WHERE p.rn <= $2
+		ORDER BY p.tag_id, m.id DESC
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(tagIDs), limit, afterID)
+	if err != nil {
+		return nil, wrapError(ctx, "movie", err)
+	}
+	defer rows.Close()
+
+	pages := make(map[int][]models.MovieWithStats, len(tagIDs))
+	for rows.Next() {
+		var tagID int
+		m, err := scanMovieWithStats(rows, &tagID)
+		if err != nil {
+			return nil, wrapError(ctx, "movie", err)
+		}
+		pages[tagID] = append(pages[tagID], m)
+	}
+	recordRows(ctx, pagedRows(pages))
+	return pages, wrapError(ctx, "movie", rows.Err())
+}
+
+func (db *DB) GetTagsByMovieIDs(ctx context.Context, movieIDs []int) (map[int][]models.Tag, error) {
+	ctx, end := db.begin(ctx, "GetTagsByMovieIDs")
+	defer end()
+
+	query := `
+		SELECT mt.movie_id, t.id, t.name
+		FROM movie_tags mt
+		JOIN tags t ON t.id = mt.tag_id
+		WHERE mt.movie_id = ANY($1)
+		ORDER BY t.name
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, wrapError(ctx, "tag", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[int][]models.Tag, len(movieIDs))
+	for rows.Next() {
+		var movieID int
+		var t models.Tag
+		if err := rows.Scan(&movieID, &t.ID, &t.Name); err != nil {
+			return nil, wrapError(ctx, "tag", err)
+		}
+		tags[movieID] = append(tags[movieID], t)
+	}
+	recordRows(ctx, len(tags))
+	return tags, wrapError(ctx, "tag", rows.Err())
+}
+
+func (db *DB) GetUsersByIDs(ctx context.Context, ids []int) (map[int]*models.User, error) {
+	ctx, end := db.begin(ctx, "GetUsersByIDs")
+	defer end()
+
+	query := `
+		SELECT id, username, email, role, created_at, updated_at, totp_enabled
+		FROM users WHERE id = ANY($1)
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, wrapError(ctx, "user", err)
+	}
+	defer rows.Close()
+
+	users := make(map[int]*models.User, len(ids))
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.Role, &u.CreatedAt, &u.UpdatedAt, &u.TOTPEnabled); err != nil {
+			return nil, wrapError(ctx, "user", err)
+		}
+		users[u.ID] = &u
+	}
+	recordRows(ctx, len(users))
+	return users, wrapError(ctx, "user", rows.Err())
+}
+
+func (db *DB) GetReviewPagesByMovieIDs(ctx context.Context, movieIDs []int, limit, afterID int) (map[int][]models.Review, error) {
+	return db.reviewPages(ctx, "movie_id", movieIDs, limit, afterID)
+}
+
+func (db *DB) GetReviewPagesByUserIDs(ctx context.Context, userIDs []int, limit, afterID int) (map[int][]models.Review, error) {
+	return db.reviewPages(ctx, "user_id", userIDs, limit, afterID)
+}
+
+// ListReviewsPage lists reviews across all movies, newest first
+func (db *DB) ListReviewsPage(ctx context.Context, limit, afterID int) ([]models.Review, error) {
+	ctx, end := db.begin(ctx, "ListReviewsPage")
+	defer end()
+
+	query := `
+		SELECT id, movie_id, user_id, rating, title, COALESCE(content, ''), created_at, updated_at
+		FROM reviews
+		WHERE ($2 = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $1
+	`
+
+	rows, err := db.QueryContext(ctx, query, limit, afterID)
+	if err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	defer rows.Close()
+
+	reviews := []models.Review{}
+	for rows.Next() {
+		var r models.Review
+		err := rows.Scan(&r.ID, &r.MovieID, &r.UserID, &r.Rating, &r.Title, &r.Content, &r.CreatedAt, &r.UpdatedAt)
+		if err != nil {
+			return nil, wrapError(ctx, "review", err)
+		}
+		reviews = append(reviews, r)
+	}
+	recordRows(ctx, len(reviews))
+	return reviews, wrapError(ctx, "review", rows.Err())
+}
+
+// reviewPages pages reviews for each value of parentColumn
+func (db *DB) reviewPages(ctx context.Context, parentColumn string, parentIDs []int, limit, afterID int) (map[int][]models.Review, error) {
+	ctx, end := db.begin(ctx, "reviewPages")
+	defer end()
+
+	query := fmt.Sprintf(`
+		SELECT %[1]s, id, movie_id, user_id, rating, title, COALESCE(content, ''), created_at, updated_at
+		FROM (
+			SELECT r.*, ROW_NUMBER() OVER (PARTITION BY r.%[1]s ORDER BY r.id DESC) AS rn
+			FROM reviews r
+			WHERE r.%[1]s = ANY($1) AND ($3 = 0 OR r.id < $3)
+		) p
+		WHERE rn <= $2
+		ORDER BY %[1]s, id DESC
+	`, parentColumn)
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(parentIDs), limit, afterID)
+	if err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	defer rows.Close()
+
+	pages := make(map[int][]models.Review, len(parentIDs))
+	for rows.Next() {
+		var parentID int
+		var r models.Review
+		err := rows.Scan(&parentID, &r.ID, &r.MovieID, &r.UserID, &r.Rating, &r.Title, &r.Content, &r.CreatedAt, &r.UpdatedAt)
+		if err != nil {
+			return nil, wrapError(ctx, "review", err)
+		}
+		pages[parentID] = append(pages[parentID], r)
+	}
+	recordRows(ctx, pagedRows(pages))
+	return pages, wrapError(ctx, "review", rows.Err())
+}
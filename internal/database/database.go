@@ -1,55 +1,112 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
+	"maps"
 	"strings"
+	"time"
 
+	"cinerank/internal/events"
 	"cinerank/internal/models"
+	"cinerank/internal/tracing"
 
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DB struct {
 	*sql.DB
+	// Events receives domain events once their transaction commits, when set
+	Events events.Publisher
+	// NotifyEvents also sends each event with NOTIFY inside its write's transaction, for the
+	// Postgres event bus of every instance to hear once the write commits
+	NotifyEvents bool
+	// QueryTimeout bounds each method call, transactions included; zero means no limit
+	QueryTimeout time.Duration
 }
 
-// Connect connects to the PostgreSQL database
-func Connect() (*DB, error) {
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		return nil, fmt.Errorf("DATABASE_URL environment variable is not set")
-	}
+// Options size the connection pool and bound each query
+type Options struct {
+	QueryTimeout    time.Duration
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
 
-	db, err := sql.Open("postgres", dbURL)
+// Connect connects to the PostgreSQL database at url
+func Connect(url string, opts Options) (*DB, error) {
+	db, err := sql.Open("postgres", url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
 
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	log.Println("Successfully connected to database")
-	return &DB{db}, nil
+	return &DB{DB: db, QueryTimeout: opts.QueryTimeout}, nil
+}
+
+// begin starts the store method op: it bounds ctx by the query timeout, when one is set, and traces
+// the call as a span. The returned function ends both.
+func (db *DB) begin(ctx context.Context, op string) (context.Context, func()) {
+	ctx, span := tracing.Start(ctx, "db."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.operation.name", op),
+		),
+	)
+
+	var cancel context.CancelFunc
+	if db.QueryTimeout <= 0 {
+		ctx, cancel = context.WithCancel(ctx)
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, db.QueryTimeout)
+	}
+	return ctx, func() {
+		cancel()
+		span.End()
+	}
+}
+
+// recordRows notes on the call's span how many rows a query returned
+func recordRows(ctx context.Context, n int) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("db.response.returned_rows", n))
+}
+
+// pagedRows counts the rows behind a batch of pages
+func pagedRows[V any](pages map[int][]V) int {
+	n := 0
+	for _, page := range pages {
+		n += len(page)
+	}
+	return n
 }
 
 // Movie operations
-func (db *DB) GetAllMoviesWithStats(searchQuery string) ([]models.MovieWithStats, error) {
+func (db *DB) GetAllMoviesWithStats(ctx context.Context, searchQuery string) ([]models.MovieWithStats, error) {
+	ctx, end := db.begin(ctx, "GetAllMoviesWithStats")
+	defer end()
+
 	query := `
-		SELECT 
-			m.id, m.title, m.director, m.year, m.plot, 
-			m.poster_url, m.imdb_rating, m.created_at, m.updated_at,
-			COALESCE(STRING_AGG(t.name, ', '), '') as tags,
-			COALESCE(COUNT(r.id), 0) as review_count,
-			COALESCE(AVG(r.rating::float), 0) as average_rating
+		SELECT
+			COALESCE((
+				SELECT STRING_AGG(t.name, ', ' ORDER BY t.name)
+				FROM movie_tags mt JOIN tags t ON mt.tag_id = t.id
+				WHERE mt.movie_id = m.id
+			), '') as tags,
+			` + movieWithStatsColumns + `
 		FROM movies m
-		LEFT JOIN movie_tags mt ON m.id = mt.movie_id
-		LEFT JOIN tags t ON mt.tag_id = t.id
-		LEFT JOIN reviews r ON m.id = r.movie_id
-	`
+	` + movieStatsJoin
 
 	args := []interface{}{}
 	if searchQuery != "" {
@@ -62,29 +119,21 @@ func (db *DB) GetAllMoviesWithStats(searchQuery string) ([]models.MovieWithStats
 	}
 
 	query += `
-		GROUP BY m.id, m.title, m.director, m.year, m.plot, 
-				 m.poster_url, m.imdb_rating, m.created_at, m.updated_at
-		ORDER BY m.created_at DESC
+		ORDER BY m.created_at DESC, m.id DESC
 	`
 
-	rows, err := db.Query(query, args...)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ctx, "movie", err)
 	}
 	defer rows.Close()
 
-	var movies []models.MovieWithStats
+	movies := []models.MovieWithStats{}
 	for rows.Next() {
-		var m models.MovieWithStats
 		var tagsStr string
-		err := rows.Scan(
-			&m.ID, &m.Title, &m.Director, &m.Year, &m.Plot,
-			&m.PosterURL, &m.IMDBRating, &m.CreatedAt, &m.UpdatedAt,
-			&tagsStr,
-			&m.ReviewCount, &m.AverageRating,
-		)
+		m, err := scanMovieWithStats(rows, &tagsStr)
 		if err != nil {
-			return nil, err
+			return nil, wrapError(ctx, "movie", err)
 		}
 		if tagsStr != "" {
 			m.Tags = strings.Split(tagsStr, ", ")
@@ -92,13 +141,17 @@ func (db *DB) GetAllMoviesWithStats(searchQuery string) ([]models.MovieWithStats
 		movies = append(movies, m)
 	}
 
-	return movies, nil
+	recordRows(ctx, len(movies))
+	return movies, wrapError(ctx, "movie", rows.Err())
 }
 
-func (db *DB) GetMovieByID(id int) (*models.Movie, error) {
+func (db *DB) GetMovieByID(ctx context.Context, id int) (*models.Movie, error) {
+	ctx, end := db.begin(ctx, "GetMovieByID")
+	defer end()
+
 	query := `
 		SELECT m.id, m.title, m.director, m.year, m.plot, m.poster_url, m.imdb_rating, m.created_at, m.updated_at,
-			   COALESCE(STRING_AGG(t.name, ', '), '') as tags
+			   COALESCE(STRING_AGG(t.name, ', ' ORDER BY t.name), '') as tags
 		FROM movies m
 		LEFT JOIN movie_tags mt ON m.id = mt.movie_id
 		LEFT JOIN tags t ON mt.tag_id = t.id
@@ -108,13 +161,13 @@ func (db *DB) GetMovieByID(id int) (*models.Movie, error) {
 
 	var m models.Movie
 	var tagsStr string
-	err := db.QueryRow(query, id).Scan(
+	err := db.QueryRowContext(ctx, query, id).Scan(
 		&m.ID, &m.Title, &m.Director, &m.Year, &m.Plot,
 		&m.PosterURL, &m.IMDBRating, &m.CreatedAt, &m.UpdatedAt,
 		&tagsStr,
 	)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ctx, "movie", err)
 	}
 	if tagsStr != "" {
 		m.Tags = strings.Split(tagsStr, ", ")
@@ -123,10 +176,13 @@ func (db *DB) GetMovieByID(id int) (*models.Movie, error) {
 	return &m, nil
 }
 
-func (db *DB) CreateMovie(req models.CreateMovieRequest) (*models.Movie, error) {
-	tx, err := db.Begin()
+func (db *DB) CreateMovie(ctx context.Context, req models.CreateMovieRequest) (*models.Movie, error) {
+	ctx, end := db.begin(ctx, "CreateMovie")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ctx, "movie", err)
 	}
 	defer tx.Rollback()
 
@@ -137,41 +193,108 @@ func (db *DB) CreateMovie(req models.CreateMovieRequest) (*models.Movie, error)
 	`
 
 	var m models.Movie
-	err = tx.QueryRow(query, req.Title, req.Director, req.Year, req.Plot, req.PosterURL, req.IMDBRating).Scan(
+	err = tx.QueryRowContext(ctx, query, req.Title, req.Director, req.Year, req.Plot, req.PosterURL, req.IMDBRating).Scan(
 		&m.ID, &m.Title, &m.Director, &m.Year, &m.Plot,
 		&m.PosterURL, &m.IMDBRating, &m.CreatedAt, &m.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ctx, "movie", err)
 	}
 
 	for _, tagName := range req.Tags {
 		if tagName == "" {
 			continue
 		}
-		tagID, err := db.getOrCreateTag(tx, tagName)
+		tagID, err := db.getOrCreateTag(ctx, tx, tagName)
+		if err != nil {
+			return nil, wrapError(ctx, "tag", err)
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO movie_tags (movie_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", m.ID, tagID)
+		if err != nil {
+			return nil, wrapError(ctx, "movie", err)
+		}
+		m.Tags = append(m.Tags, tagName)
+	}
+
+	if err := enqueueEvent(ctx, tx, models.EventMovieCreated, m); err != nil {
+		return nil, wrapError(ctx, "movie", err)
+	}
+
+	event := events.Event{Type: events.TypeMovieCreated, MovieID: m.ID, Movie: &m}
+	if err := db.notify(ctx, tx, event); err != nil {
+		return nil, wrapError(ctx, "movie", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapError(ctx, "movie", err)
+	}
+
+	db.publish(event)
+
+	return &m, nil
+}
+
+func (db *DB) UpdateMovie(ctx context.Context, id int, req models.CreateMovieRequest) (*models.Movie, error) {
+	ctx, end := db.begin(ctx, "UpdateMovie")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapError(ctx, "movie", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE movies
+		SET title = $2, director = $3, year = $4, plot = $5, poster_url = $6, imdb_rating = $7, updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, title, director, year, plot, poster_url, imdb_rating, created_at, updated_at
+	`
+
+	var m models.Movie
+	err = tx.QueryRowContext(ctx, query, id, req.Title, req.Director, req.Year, req.Plot, req.PosterURL, req.IMDBRating).Scan(
+		&m.ID, &m.Title, &m.Director, &m.Year, &m.Plot,
+		&m.PosterURL, &m.IMDBRating, &m.CreatedAt, &m.UpdatedAt,
+	)
+	if err != nil {
+		return nil, wrapError(ctx, "movie", err)
+	}
+
+	// Tags are replaced as a whole
+	if _, err := tx.ExecContext(ctx, "DELETE FROM movie_tags WHERE movie_id = $1", id); err != nil {
+		return nil, wrapError(ctx, "movie", err)
+	}
+	for _, tagName := range req.Tags {
+		tagID, err := db.getOrCreateTag(ctx, tx, tagName)
 		if err != nil {
-			return nil, err
+			return nil, wrapError(ctx, "tag", err)
 		}
-		_, err = tx.Exec("INSERT INTO movie_tags (movie_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", m.ID, tagID)
+		_, err = tx.ExecContext(ctx, "INSERT INTO movie_tags (movie_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", m.ID, tagID)
 		if err != nil {
-			return nil, err
+			return nil, wrapError(ctx, "movie", err)
 		}
 		m.Tags = append(m.Tags, tagName)
 	}
 
+	event := events.Event{Type: events.TypeMovieUpdated, MovieID: m.ID, Movie: &m}
+	if err := db.notify(ctx, tx, event); err != nil {
+		return nil, wrapError(ctx, "movie", err)
+	}
+
 	if err := tx.Commit(); err != nil {
-		return nil, err
+		return nil, wrapError(ctx, "movie", err)
 	}
 
+	db.publish(event)
+
 	return &m, nil
 }
 
-func (db *DB) getOrCreateTag(tx *sql.Tx, name string) (int, error) {
+func (db *DB) getOrCreateTag(ctx context.Context, tx *sql.Tx, name string) (int, error) {
 	var tagID int
-	err := tx.QueryRow("SELECT id FROM tags WHERE name = $1", name).Scan(&tagID)
+	err := tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE name = $1", name).Scan(&tagID)
 	if err == sql.ErrNoRows {
-		err = tx.QueryRow("INSERT INTO tags (name) VALUES ($1) RETURNING id", name).Scan(&tagID)
+		err = tx.QueryRowContext(ctx, "INSERT INTO tags (name) VALUES ($1) RETURNING id", name).Scan(&tagID)
 		if err != nil {
 			return 0, err
 		}
@@ -181,29 +304,69 @@ func (db *DB) getOrCreateTag(tx *sql.Tx, name string) (int, error) {
 	return tagID, nil
 }
 
-func (db *DB) DeleteMovie(id int) error {
-	_, err := db.Exec("DELETE FROM movies WHERE id = $1", id)
-	return err
+func (db *DB) DeleteMovie(ctx context.Context, id int) error {
+	ctx, end := db.begin(ctx, "DeleteMovie")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(ctx, "movie", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM movies WHERE id = $1
+		RETURNING id, title, director, year, plot, poster_url, imdb_rating, created_at, updated_at
+	`
+
+	var m models.Movie
+	err = tx.QueryRowContext(ctx, query, id).Scan(
+		&m.ID, &m.Title, &m.Director, &m.Year, &m.Plot,
+		&m.PosterURL, &m.IMDBRating, &m.CreatedAt, &m.UpdatedAt,
+	)
+	if err != nil {
+		return wrapError(ctx, "movie", err)
+	}
+
+	if err := enqueueEvent(ctx, tx, models.EventMovieDeleted, m); err != nil {
+		return wrapError(ctx, "movie", err)
+	}
+
+	event := events.Event{Type: events.TypeMovieDeleted, MovieID: m.ID, Movie: &m}
+	if err := db.notify(ctx, tx, event); err != nil {
+		return wrapError(ctx, "movie", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapError(ctx, "movie", err)
+	}
+
+	db.publish(event)
+
+	return nil
 }
 
 // Review operations
-func (db *DB) GetReviewsByMovieID(movieID int) ([]models.Review, error) {
+func (db *DB) GetReviewsByMovieID(ctx context.Context, movieID int) ([]models.Review, error) {
+	ctx, end := db.begin(ctx, "GetReviewsByMovieID")
+	defer end()
+
 	query := `
 		SELECT r.id, r.movie_id, r.user_id, r.rating, r.title, r.content, r.created_at, r.updated_at,
 			   u.username
 		FROM reviews r
 		JOIN users u ON r.user_id = u.id
 		WHERE r.movie_id = $1
-		ORDER BY r.created_at DESC
+		ORDER BY r.created_at DESC, r.id DESC
 	`
 
-	rows, err := db.Query(query, movieID)
+	rows, err := db.QueryContext(ctx, query, movieID)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ctx, "review", err)
 	}
 	defer rows.Close()
 
-	var reviews []models.Review
+	reviews := []models.Review{}
 	for rows.Next() {
 		var r models.Review
 		var username string
@@ -213,35 +376,217 @@ func (db *DB) GetReviewsByMovieID(movieID int) ([]models.Review, error) {
 			&username,
 		)
 		if err != nil {
-			return nil, err
+			return nil, wrapError(ctx, "review", err)
 		}
 		r.User = &models.User{Username: username}
 		reviews = append(reviews, r)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	if err := db.fillSubRatings(ctx, reviews); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+
+	recordRows(ctx, len(reviews))
 	return reviews, nil
 }
 
-func (db *DB) CreateReview(req models.CreateReviewRequest, userID int) (*models.Review, error) {
+func (db *DB) CreateReview(ctx context.Context, req models.CreateReviewRequest, userID int) (*models.Review, error) {
+	ctx, end := db.begin(ctx, "CreateReview")
+	defer end()
+
 	query := `
 		INSERT INTO reviews (movie_id, user_id, rating, title, content, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
 		RETURNING id, movie_id, user_id, rating, title, content, created_at, updated_at
 	`
 
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	defer tx.Rollback()
+
 	var r models.Review
-	err := db.QueryRow(query, req.MovieID, userID, req.Rating, req.Title, req.Content).Scan(
+	err = tx.QueryRowContext(ctx, query, req.MovieID, userID, req.Rating, req.Title, req.Content).Scan(
 		&r.ID, &r.MovieID, &r.UserID, &r.Rating, &r.Title,
 		&r.Content, &r.CreatedAt, &r.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ctx, "review", err)
+	}
+
+	if err := insertSubRatings(ctx, tx, r.ID, req.SubRatings); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	if len(req.SubRatings) > 0 {
+		r.SubRatings = maps.Clone(req.SubRatings)
+	}
+
+	if err := bumpMovieStats(ctx, tx, r.MovieID, r.Rating, 1); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+
+	if err := enqueueEvent(ctx, tx, models.EventReviewCreated, r); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+
+	var event *events.Event
+	if db.Events != nil || db.NotifyEvents {
+		if event, err = reviewCreatedEvent(ctx, tx, r); err != nil {
+			return nil, wrapError(ctx, "review", err)
+		}
+		if err := db.notify(ctx, tx, *event); err != nil {
+			return nil, wrapError(ctx, "review", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+
+	if event != nil {
+		db.publish(*event)
 	}
 
 	return &r, nil
 }
 
-func (db *DB) GetRecentReviews(limit int) ([]models.Review, error) {
+func (db *DB) GetReviewByID(ctx context.Context, id int) (*models.Review, error) {
+	ctx, end := db.begin(ctx, "GetReviewByID")
+	defer end()
+
+	query := `
+		SELECT r.id, r.movie_id, r.user_id, r.rating, r.title, r.content, r.created_at, r.updated_at,
+			   u.username
+		FROM reviews r
+		JOIN users u ON r.user_id = u.id
+		WHERE r.id = $1
+	`
+
+	var r models.Review
+	var username string
+	err := db.QueryRowContext(ctx, query, id).Scan(
+		&r.ID, &r.MovieID, &r.UserID, &r.Rating, &r.Title,
+		&r.Content, &r.CreatedAt, &r.UpdatedAt,
+		&username,
+	)
+	if err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	r.User = &models.User{Username: username}
+
+	reviews := []models.Review{r}
+	if err := db.fillSubRatings(ctx, reviews); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+
+	return &reviews[0], nil
+}
+
+func (db *DB) UpdateReview(ctx context.Context, id int, req models.CreateReviewRequest) (*models.Review, error) {
+	ctx, end := db.begin(ctx, "UpdateReview")
+	defer end()
+
+	// The old rating is read under the row lock so the stats move from exactly that rating
+	query := `
+		WITH old AS (SELECT id, rating FROM reviews WHERE id = $1 FOR UPDATE)
+		UPDATE reviews r
+		SET rating = $2, title = $3, content = $4, updated_at = NOW()
+		FROM old
+		WHERE r.id = old.id
+		RETURNING r.id, r.movie_id, r.user_id, r.rating, r.title, r.content, r.created_at, r.updated_at, old.rating
+	`
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	defer tx.Rollback()
+
+	var r models.Review
+	var oldRating int
+	err = tx.QueryRowContext(ctx, query, id, req.Rating, req.Title, req.Content).Scan(
+		&r.ID, &r.MovieID, &r.UserID, &r.Rating, &r.Title,
+		&r.Content, &r.CreatedAt, &r.UpdatedAt, &oldRating,
+	)
+	if err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+
+	// The sub-ratings are replaced as a whole
+	if _, err := tx.ExecContext(ctx, "DELETE FROM review_ratings WHERE review_id = $1", r.ID); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	if err := insertSubRatings(ctx, tx, r.ID, req.SubRatings); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	if len(req.SubRatings) > 0 {
+		r.SubRatings = maps.Clone(req.SubRatings)
+	}
+
+	if oldRating != r.Rating {
+		if err := bumpMovieStats(ctx, tx, r.MovieID, oldRating, -1); err != nil {
+			return nil, wrapError(ctx, "review", err)
+		}
+		if err := bumpMovieStats(ctx, tx, r.MovieID, r.Rating, 1); err != nil {
+			return nil, wrapError(ctx, "review", err)
+		}
+	}
+
+	event := events.Event{Type: events.TypeReviewUpdated, MovieID: r.MovieID, Review: &r}
+	if err := db.notify(ctx, tx, event); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+
+	db.publish(event)
+
+	return &r, nil
+}
+
+func (db *DB) DeleteReview(ctx context.Context, id int) error {
+	ctx, end := db.begin(ctx, "DeleteReview")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(ctx, "review", err)
+	}
+	defer tx.Rollback()
+
+	var movieID, rating int
+	err = tx.QueryRowContext(ctx, "DELETE FROM reviews WHERE id = $1 RETURNING movie_id, rating", id).Scan(&movieID, &rating)
+	if err != nil {
+		return wrapError(ctx, "review", err)
+	}
+
+	if err := bumpMovieStats(ctx, tx, movieID, rating, -1); err != nil {
+		return wrapError(ctx, "review", err)
+	}
+
+	event := events.Event{Type: events.TypeReviewDeleted, MovieID: movieID}
+	if err := db.notify(ctx, tx, event); err != nil {
+		return wrapError(ctx, "review", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapError(ctx, "review", err)
+	}
+
+	db.publish(event)
+	return nil
+}
+
+func (db *DB) GetRecentReviews(ctx context.Context, limit int) ([]models.Review, error) {
+	ctx, end := db.begin(ctx, "GetRecentReviews")
+	defer end()
+
 	query := `
 		SELECT 
 			r.id, r.movie_id, r.user_id, r.rating, r.title, r.content, r.created_at, r.updated_at,
@@ -250,17 +595,17 @@ func (db *DB) GetRecentReviews(limit int) ([]models.Review, error) {
 		FROM reviews r
 		JOIN movies m ON r.movie_id = m.id
 		JOIN users u ON r.user_id = u.id
-		ORDER BY r.created_at DESC
+		ORDER BY r.created_at DESC, r.id DESC
 		LIMIT $1
 	`
 
-	rows, err := db.Query(query, limit)
+	rows, err := db.QueryContext(ctx, query, limit)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ctx, "review", err)
 	}
 	defer rows.Close()
 
-	var reviews []models.Review
+	reviews := []models.Review{}
 	for rows.Next() {
 		var r models.Review
 		var movieTitle string
@@ -270,7 +615,7 @@ func (db *DB) GetRecentReviews(limit int) ([]models.Review, error) {
 			&r.Content, &r.CreatedAt, &r.UpdatedAt, &movieTitle, &username,
 		)
 		if err != nil {
-			return nil, err
+			return nil, wrapError(ctx, "review", err)
 		}
 
 		r.Movie = &models.Movie{Title: movieTitle}
@@ -278,90 +623,316 @@ func (db *DB) GetRecentReviews(limit int) ([]models.Review, error) {
 		reviews = append(reviews, r)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	if err := db.fillSubRatings(ctx, reviews); err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+
+	recordRows(ctx, len(reviews))
 	return reviews, nil
 }
 
 // User operations
-func (db *DB) CreateUser(req models.RegisterRequest) (*models.User, error) {
+func (db *DB) CreateUser(ctx context.Context, req models.RegisterRequest) (*models.User, error) {
+	return db.CreateUserWithRole(ctx, req, "user")
+}
+
+// CreateUserWithRole expects req.Password to already be hashed
+func (db *DB) CreateUserWithRole(ctx context.Context, req models.RegisterRequest, role string) (*models.User, error) {
+	ctx, end := db.begin(ctx, "CreateUserWithRole")
+	defer end()
+
 	query := `
 		INSERT INTO users (username, email, password_hash, role, created_at, updated_at)
-		VALUES ($1, $2, $3, 'user', NOW(), NOW())
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
 		RETURNING id, username, email, role, created_at, updated_at
 	`
 
 	var u models.User
-	err := db.QueryRow(query, req.Username, req.Email, req.Password).Scan(
+	err := db.QueryRowContext(ctx, query, req.Username, req.Email, req.Password, role).Scan(
 		&u.ID, &u.Username, &u.Email, &u.Role, &u.CreatedAt, &u.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ctx, "user", err)
 	}
 
 	return &u, nil
 }
 
-func (db *DB) GetUserByEmail(email string) (*models.User, error) {
+func (db *DB) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, end := db.begin(ctx, "GetUserByEmail")
+	defer end()
+
 	query := `
-		SELECT id, username, email, password_hash, role, created_at, updated_at
+		SELECT id, username, email, password_hash, role, created_at, updated_at,
+			   totp_enabled, COALESCE(totp_secret, '')
 		FROM users WHERE email = $1
 	`
 
 	var u models.User
-	err := db.QueryRow(query, email).Scan(
+	err := db.QueryRowContext(ctx, query, email).Scan(
 		&u.ID, &u.Username, &u.Email, &u.PasswordHash, &u.Role, &u.CreatedAt, &u.UpdatedAt,
+		&u.TOTPEnabled, &u.TOTPSecret,
 	)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ctx, "user", err)
 	}
 
 	return &u, nil
 }
 
-func (db *DB) GetUserByID(id int) (*models.User, error) {
+func (db *DB) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	ctx, end := db.begin(ctx, "GetUserByID")
+	defer end()
+
 	query := `
-		SELECT id, username, email, role, created_at, updated_at
+		SELECT id, username, email, role, created_at, updated_at,
+			   totp_enabled, COALESCE(totp_secret, '')
 		FROM users WHERE id = $1
 	`
 
 	var u models.User
-	err := db.QueryRow(query, id).Scan(
+	err := db.QueryRowContext(ctx, query, id).Scan(
 		&u.ID, &u.Username, &u.Email, &u.Role, &u.CreatedAt, &u.UpdatedAt,
+		&u.TOTPEnabled, &u.TOTPSecret,
 	)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ctx, "user", err)
 	}
 
 	return &u, nil
 }
 
-func (db *DB) GetAllUsers() ([]models.User, error) {
+func (db *DB) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	ctx, end := db.begin(ctx, "GetAllUsers")
+	defer end()
+
 	query := `
-		SELECT id, username, email, role, created_at, updated_at
-		FROM users ORDER BY created_at DESC
+		SELECT id, username, email, role, created_at, updated_at, totp_enabled
+		FROM users ORDER BY created_at DESC, id DESC
 	`
 
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ctx, "user", err)
 	}
 	defer rows.Close()
 
-	var users []models.User
+	users := []models.User{}
 	for rows.Next() {
 		var u models.User
 		err := rows.Scan(
-			&u.ID, &u.Username, &u.Email, &u.Role, &u.CreatedAt, &u.UpdatedAt,
+			&u.ID, &u.Username, &u.Email, &u.Role, &u.CreatedAt, &u.UpdatedAt, &u.TOTPEnabled,
 		)
 		if err != nil {
-			return nil, err
+			return nil, wrapError(ctx, "user", err)
 		}
 		users = append(users, u)
 	}
 
-	return users, nil
+	recordRows(ctx, len(users))
+	return users, wrapError(ctx, "user", rows.Err())
+}
+
+func (db *DB) DeleteUser(ctx context.Context, id int) error {
+	ctx, end := db.begin(ctx, "DeleteUser")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(ctx, "user", err)
+	}
+	defer tx.Rollback()
+
+	// Deleting a user also deletes their reviews, so the movies they reviewed need new stats
+	rows, err := tx.QueryContext(ctx, "SELECT DISTINCT movie_id FROM reviews WHERE user_id = $1", id)
+	if err != nil {
+		return wrapError(ctx, "user", err)
+	}
+	var movieIDs []int
+	for rows.Next() {
+		var movieID int
+		if err := rows.Scan(&movieID); err != nil {
+			rows.Close()
+			return wrapError(ctx, "user", err)
+		}
+		movieIDs = append(movieIDs, movieID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return wrapError(ctx, "user", err)
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		return wrapError(ctx, "user", err)
+	}
+	if err := notFoundIfNoRows("user", result); err != nil {
+		return err
+	}
+
+	if err := recomputeMovieStats(ctx, tx, movieIDs); err != nil {
+		return wrapError(ctx, "user", err)
+	}
+
+	event := events.Event{Type: events.TypeUserDeleted}
+	if err := db.notify(ctx, tx, event); err != nil {
+		return wrapError(ctx, "user", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapError(ctx, "user", err)
+	}
+
+	db.publish(event)
+	return nil
+}
+
+func (db *DB) UpdateUser(ctx context.Context, id int, req models.UpdateUserRequest) (*models.User, error) {
+	ctx, end := db.begin(ctx, "UpdateUser")
+	defer end()
+
+	query := `
+		UPDATE users
+		SET username = $2, email = $3, role = $4, updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, username, email, role, created_at, updated_at, totp_enabled
+	`
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapError(ctx, "user", err)
+	}
+	defer tx.Rollback()
+
+	var u models.User
+	err = tx.QueryRowContext(ctx, query, id, req.Username, req.Email, req.Role).Scan(
+		&u.ID, &u.Username, &u.Email, &u.Role, &u.CreatedAt, &u.UpdatedAt, &u.TOTPEnabled,
+	)
+	if err != nil {
+		return nil, wrapError(ctx, "user", err)
+	}
+
+	event := events.Event{Type: events.TypeUserUpdated}
+	if err := db.notify(ctx, tx, event); err != nil {
+		return nil, wrapError(ctx, "user", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapError(ctx, "user", err)
+	}
+
+	db.publish(event)
+
+	return &u, nil
+}
+
+// Tag operations
+func (db *DB) GetAllTags(ctx context.Context) ([]models.Tag, error) {
+	ctx, end := db.begin(ctx, "GetAllTags")
+	defer end()
+
+	rows, err := db.QueryContext(ctx, "SELECT id, name FROM tags ORDER BY name")
+	if err != nil {
+		return nil, wrapError(ctx, "tag", err)
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var t models.Tag
+		if err := rows.Scan(&t.ID, &t.Name); err != nil {
+			return nil, wrapError(ctx, "tag", err)
+		}
+		tags = append(tags, t)
+	}
+
+	recordRows(ctx, len(tags))
+	return tags, wrapError(ctx, "tag", rows.Err())
+}
+
+func (db *DB) GetTagByID(ctx context.Context, id int) (*models.Tag, error) {
+	ctx, end := db.begin(ctx, "GetTagByID")
+	defer end()
+
+	var t models.Tag
+	err := db.QueryRowContext(ctx, "SELECT id, name FROM tags WHERE id = $1", id).Scan(&t.ID, &t.Name)
+	if err != nil {
+		return nil, wrapError(ctx, "tag", err)
+	}
+	return &t, nil
 }
 
-func (db *DB) DeleteUser(id int) error {
-	_, err := db.Exec("DELETE FROM users WHERE id = $1", id)
-	return err
-}
\ No newline at end of file
+func (db *DB) CreateTag(ctx context.Context, name string) (*models.Tag, error) {
+	ctx, end := db.begin(ctx, "CreateTag")
+	defer end()
+
+	var t models.Tag
+	err := db.QueryRowContext(ctx, "INSERT INTO tags (name) VALUES ($1) RETURNING id, name", name).Scan(&t.ID, &t.Name)
+	if err != nil {
+		return nil, wrapError(ctx, "tag", err)
+	}
+	return &t, nil
+}
+
+func (db *DB) UpdateTag(ctx context.Context, id int, name string) (*models.Tag, error) {
+	ctx, end := db.begin(ctx, "UpdateTag")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapError(ctx, "tag", err)
+	}
+	defer tx.Rollback()
+
+	var t models.Tag
+	err = tx.QueryRowContext(ctx, "UPDATE tags SET name = $2 WHERE id = $1 RETURNING id, name", id, name).Scan(&t.ID, &t.Name)
+	if err != nil {
+		return nil, wrapError(ctx, "tag", err)
+	}
+
+	event := events.Event{Type: events.TypeTagUpdated}
+	if err := db.notify(ctx, tx, event); err != nil {
+		return nil, wrapError(ctx, "tag", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapError(ctx, "tag", err)
+	}
+
+	db.publish(event)
+	return &t, nil
+}
+
+func (db *DB) DeleteTag(ctx context.Context, id int) error {
+	ctx, end := db.begin(ctx, "DeleteTag")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(ctx, "tag", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM tags WHERE id = $1", id)
+	if err != nil {
+		return wrapError(ctx, "tag", err)
+	}
+	if err := notFoundIfNoRows("tag", result); err != nil {
+		return err
+	}
+
+	event := events.Event{Type: events.TypeTagDeleted}
+	if err := db.notify(ctx, tx, event); err != nil {
+		return wrapError(ctx, "tag", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapError(ctx, "tag", err)
+	}
+
+	db.publish(event)
+	return nil
+}
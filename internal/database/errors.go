@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"cinerank/internal/logging"
+	"cinerank/internal/tracing"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Domain errors returned by DB methods; match them with errors.Is
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrConstraint = errors.New("constraint violation")
+	// ErrCanceled means the caller gave up, e.g. the client disconnected; it is not a server fault
+	ErrCanceled = errors.New("canceled")
+	// ErrTimeout means the query ran past its deadline
+	ErrTimeout = errors.New("timeout")
+)
+
+// Error describes a failed operation on an entity in terms of a domain error
+type Error struct {
+	Kind       error
+	Entity     string
+	Constraint string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Constraint != "" {
+		return fmt.Sprintf("%s: %v (%s)", e.Entity, e.Kind, e.Constraint)
+	}
+	return fmt.Sprintf("%s: %v", e.Entity, e.Kind)
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+	pqNotNullViolation    = "23502"
+	pqCheckViolation      = "23514"
+	pqQueryCanceled       = "57014"
+)
+
+// ContextError reports why ctx ended as ErrCanceled or ErrTimeout, or nil while it is still live
+func ContextError(ctx context.Context, entity string) error {
+	switch err := ctx.Err(); {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Kind: ErrTimeout, Entity: entity, Err: err}
+	default:
+		return &Error{Kind: ErrCanceled, Entity: entity, Err: err}
+	}
+}
+
+// wrapError translates driver errors into domain errors, leaving anything else untouched.
+// Failures caused by ctx ending become ErrCanceled or ErrTimeout; timeouts are logged with the
+// request's logger, since callers only see the domain error. Failures other than missing rows and
+// cancellation mark the call's span as failed.
+func wrapError(ctx context.Context, entity string, err error) error {
+	var dbErr *Error
+	if err == nil || errors.As(err, &dbErr) {
+		return err
+	}
+
+	err = translateError(ctx, entity, err)
+	if errors.Is(err, ErrTimeout) {
+		logging.FromContext(ctx).Warn("Database call timed out", "entity", entity, "error", err)
+	}
+	if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrCanceled) {
+		tracing.Fail(trace.SpanFromContext(ctx), err)
+	}
+	return err
+}
+
+func translateError(ctx context.Context, entity string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return &Error{Kind: ErrNotFound, Entity: entity, Err: err}
+	}
+
+	// The driver reports a cancelled query as an error of its own, so ask ctx why it ended
+	if ctxErr := ContextError(ctx, entity); ctxErr != nil {
+		return ctxErr
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqQueryCanceled:
+			// Cancelled without ctx ending, i.e. by the server's statement_timeout
+			return &Error{Kind: ErrTimeout, Entity: entity, Err: err}
+		case pqUniqueViolation:
+			return &Error{Kind: ErrConflict, Entity: entity, Constraint: pqErr.Constraint, Err: err}
+		case pqForeignKeyViolation, pqNotNullViolation, pqCheckViolation:
+			return &Error{Kind: ErrConstraint, Entity: entity, Constraint: pqErr.Constraint, Err: err}
+		}
+	}
+
+	return err
+}
+
+// notFoundIfNoRows reports ErrNotFound when a write affected no rows
+func notFoundIfNoRows(entity string, result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return &Error{Kind: ErrNotFound, Entity: entity, Err: sql.ErrNoRows}
+	}
+	return nil
+}
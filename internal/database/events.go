@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"cinerank/internal/events"
+	"cinerank/internal/models"
+)
+
+// publish hands a committed change to the event bus, when one is set
+func (db *DB) publish(e events.Event) {
+	if db.Events != nil {
+		db.Events.Publish(e)
+	}
+}
+
+// notify sends e with NOTIFY as part of tx when NotifyEvents is set; Postgres delivers it if tx commits
+func (db *DB) notify(ctx context.Context, tx *sql.Tx, e events.Event) error {
+	if !db.NotifyEvents {
+		return nil
+	}
+	return events.Notify(ctx, tx, e)
+}
+
+// reviewCreatedEvent builds the live event for a new review, with what pages need to render it
+// and the movie's stats as seen by the inserting transaction
+func reviewCreatedEvent(ctx context.Context, tx *sql.Tx, r models.Review) (*events.Event, error) {
+	query := `
+		SELECT u.username, m.title, COALESCE(s.review_count, 0),
+			COALESCE(s.rating_sum::float / NULLIF(s.review_count, 0), 0)
+		FROM users u, movies m
+		LEFT JOIN movie_stats s ON s.movie_id = m.id
+		WHERE u.id = $1 AND m.id = $2
+	`
+
+	event := events.Event{Type: events.TypeReviewCreated, MovieID: r.MovieID}
+	var username, movieTitle string
+	err := tx.QueryRowContext(ctx, query, r.UserID, r.MovieID).Scan(
+		&username, &movieTitle, &event.ReviewCount, &event.AverageRating,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	r.User = &models.User{ID: r.UserID, Username: username}
+	r.Movie = &models.Movie{ID: r.MovieID, Title: movieTitle}
+	event.Review = &r
+	return &event, nil
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+
+	"cinerank/internal/models"
+)
+
+// External identity operations
+func (db *DB) GetUserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	ctx, end := db.begin(ctx, "GetUserByIdentity")
+	defer end()
+
+	query := `
+		SELECT u.id, u.username, u.email, u.role, u.created_at, u.updated_at,
+			   u.totp_enabled, COALESCE(u.totp_secret, '')
+		FROM user_identities i
+		JOIN users u ON i.user_id = u.id
+		WHERE i.issuer = $1 AND i.subject = $2
+	`
+
+	var u models.User
+	err := db.QueryRowContext(ctx, query, issuer, subject).Scan(
+		&u.ID, &u.Username, &u.Email, &u.Role, &u.CreatedAt, &u.UpdatedAt,
+		&u.TOTPEnabled, &u.TOTPSecret,
+	)
+	if err != nil {
+		return nil, wrapError(ctx, "identity", err)
+	}
+
+	return &u, nil
+}
+
+// LinkIdentity attaches an external identity to a user, refreshing the last login time if already linked
+func (db *DB) LinkIdentity(ctx context.Context, userID int, issuer, subject, email string) error {
+	ctx, end := db.begin(ctx, "LinkIdentity")
+	defer end()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO user_identities (user_id, issuer, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		ON CONFLICT (issuer, subject) DO UPDATE SET email = EXCLUDED.email, last_login_at = NOW()
+	`, userID, issuer, subject, email)
+	return wrapError(ctx, "user", err)
+}
+
+// CreateExternalUser creates a user without a password, so it can only sign in through its identity provider
+func (db *DB) CreateExternalUser(ctx context.Context, username, email string) (*models.User, error) {
+	ctx, end := db.begin(ctx, "CreateExternalUser")
+	defer end()
+
+	query := `
+		INSERT INTO users (username, email, password_hash, role, created_at, updated_at)
+		VALUES ($1, $2, '', 'user', NOW(), NOW())
+		RETURNING id, username, email, role, created_at, updated_at
+	`
+
+	var u models.User
+	err := db.QueryRowContext(ctx, query, username, email).Scan(
+		&u.ID, &u.Username, &u.Email, &u.Role, &u.CreatedAt, &u.UpdatedAt,
+	)
+	if err != nil {
+		return nil, wrapError(ctx, "user", err)
+	}
+
+	return &u, nil
+}
+
+func (db *DB) UsernameExists(ctx context.Context, username string) (bool, error) {
+	ctx, end := db.begin(ctx, "UsernameExists")
+	defer end()
+
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE username = $1)", username).Scan(&exists)
+	return exists, wrapError(ctx, "user", err)
+}
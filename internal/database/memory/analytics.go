@@ -0,0 +1,200 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"cinerank/internal/database"
+	"cinerank/internal/models"
+)
+
+func (s *Store) GetActivity(ctx context.Context, period string, since time.Time) ([]models.ActivityCount, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	if period != models.PeriodDay && period != models.PeriodWeek {
+		return nil, fmt.Errorf("unknown analytics period %q", period)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byStart := map[time.Time]*models.ActivityCount{}
+	count := func(created time.Time) *models.ActivityCount {
+		start := database.TruncateToPeriod(created, period)
+		if byStart[start] == nil {
+			byStart[start] = &models.ActivityCount{Start: start}
+		}
+		return byStart[start]
+	}
+	for _, u := range s.users {
+		if !u.CreatedAt.Before(since) {
+			count(u.CreatedAt).NewUsers++
+		}
+	}
+	for _, r := range s.reviews {
+		if !r.CreatedAt.Before(since) {
+			count(r.CreatedAt).Reviews++
+		}
+	}
+
+	activity := []models.ActivityCount{}
+	for _, a := range byStart {
+		activity = append(activity, *a)
+	}
+	sort.Slice(activity, func(i, j int) bool { return activity[i].Start.Before(activity[j].Start) })
+	return activity, nil
+}
+
+func (s *Store) GetTopReviewers(ctx context.Context, limit int) ([]models.ReviewerStats, error) {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byUser := map[int]*models.ReviewerStats{}
+	sums := map[int]int{}
+	for _, r := range s.reviews {
+		rs := byUser[r.UserID]
+		if rs == nil {
+			rs = &models.ReviewerStats{UserID: r.UserID, Username: s.users[r.UserID].Username}
+			byUser[r.UserID] = rs
+		}
+		rs.ReviewCount++
+		sums[r.UserID] += r.Rating
+		if r.CreatedAt.After(rs.LastReviewedAt) {
+			rs.LastReviewedAt = r.CreatedAt
+		}
+	}
+
+	reviewers := []models.ReviewerStats{}
+	for id, rs := range byUser {
+		rs.AverageRating = float64(sums[id]) / float64(rs.ReviewCount)
+		reviewers = append(reviewers, *rs)
+	}
+	sort.Slice(reviewers, func(i, j int) bool {
+		if reviewers[i].ReviewCount != reviewers[j].ReviewCount {
+			return reviewers[i].ReviewCount > reviewers[j].ReviewCount
+		}
+		return reviewers[i].UserID < reviewers[j].UserID
+	})
+	return reviewers[:min(limit, len(reviewers))], nil
+}
+
+func (s *Store) GetRankedMovies(ctx context.Context, ranking string, minReviews, limit int) ([]models.MovieWithStats, error) {
+	if err := database.ContextError(ctx, "movie"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	movies := []models.MovieWithStats{}
+	for id := range s.movies {
+		if m := s.movieWithStats(id); m.ReviewCount >= max(minReviews, 1) {
+			movies = append(movies, m)
+		}
+	}
+
+	// Ties go to the movie with more reviews, then to the newest, as in the Postgres rankings
+	var before func(a, b models.MovieWithStats) bool
+	switch ranking {
+	case models.RankMostReviewed:
+		before = func(a, b models.MovieWithStats) bool { return a.ReviewCount > b.ReviewCount }
+	case models.RankHighestRated:
+		before = func(a, b models.MovieWithStats) bool { return a.AverageRating > b.AverageRating }
+	case models.RankLowestRated:
+		before = func(a, b models.MovieWithStats) bool { return a.AverageRating < b.AverageRating }
+	default:
+		return nil, fmt.Errorf("unknown movie ranking %q", ranking)
+	}
+	sort.Slice(movies, func(i, j int) bool {
+		a, b := movies[i], movies[j]
+		switch {
+		case before(a, b):
+			return true
+		case before(b, a):
+			return false
+		case a.ReviewCount != b.ReviewCount:
+			return a.ReviewCount > b.ReviewCount
+		}
+		return a.ID > b.ID
+	})
+	return movies[:min(limit, len(movies))], nil
+}
+
+func (s *Store) GetTagPopularity(ctx context.Context, limit int) ([]models.TagStats, error) {
+	if err := database.ContextError(ctx, "tag"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byTag := map[int]*models.TagStats{}
+	sums := map[int]int{}
+	for id, tag := range s.tags {
+		byTag[id] = &models.TagStats{TagID: id, Name: tag.Name}
+	}
+	for movieID, tagIDs := range s.movieTags {
+		stats := s.movieStats(movieID)
+		for _, tagID := range tagIDs {
+			byTag[tagID].MovieCount++
+			byTag[tagID].ReviewCount += stats.ReviewCount
+			sums[tagID] += stats.RatingSum
+		}
+	}
+
+	tags := []models.TagStats{}
+	for id, ts := range byTag {
+		if ts.ReviewCount > 0 {
+			ts.AverageRating = float64(sums[id]) / float64(ts.ReviewCount)
+		}
+		tags = append(tags, *ts)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		a, b := tags[i], tags[j]
+		if a.ReviewCount != b.ReviewCount {
+			return a.ReviewCount > b.ReviewCount
+		}
+		if a.MovieCount != b.MovieCount {
+			return a.MovieCount > b.MovieCount
+		}
+		return a.Name < b.Name
+	})
+	return tags[:min(limit, len(tags))], nil
+}
+
+func (s *Store) GetRatingTrend(ctx context.Context, since time.Time) ([]models.RatingTrend, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byMonth := map[time.Time]*models.RatingTrend{}
+	sums := map[time.Time]int{}
+	for _, r := range s.reviews {
+		if r.CreatedAt.Before(since) {
+			continue
+		}
+		created := r.CreatedAt.UTC()
+		month := time.Date(created.Year(), created.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if byMonth[month] == nil {
+			byMonth[month] = &models.RatingTrend{Month: month}
+		}
+		byMonth[month].ReviewCount++
+		sums[month] += r.Rating
+		if r.Rating == 5 {
+			byMonth[month].FiveStarCount++
+		}
+	}
+
+	trend := []models.RatingTrend{}
+	for month, rt := range byMonth {
+		rt.AverageRating = float64(sums[month]) / float64(rt.ReviewCount)
+		trend = append(trend, *rt)
+	}
+	sort.Slice(trend, func(i, j int) bool { return trend[i].Month.Before(trend[j].Month) })
+	return trend, nil
+}
@@ -0,0 +1,130 @@
+// Package memory is an in-memory database.Store with the same semantics as the Postgres one,
+// including domain errors, cascading deletes, webhook outbox rows and live events. It backs
+// handler tests and runs without a database.
+package memory
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cinerank/internal/database"
+	"cinerank/internal/events"
+	"cinerank/internal/models"
+)
+
+var _ database.Store = (*Store)(nil)
+
+type identity struct {
+	userID  int
+	issuer  string
+	subject string
+	email   string
+}
+
+type recoveryCode struct {
+	userID int
+	hash   string
+	used   bool
+}
+
+type Store struct {
+	// Events receives domain events after each write, when set
+	Events events.Publisher
+
+	mu sync.Mutex
+	// lastID holds the last id handed out per table, like a SERIAL sequence
+	lastID        map[string]int
+	movies        map[int]*models.Movie
+	movieTags     map[int][]int // movie id to tag ids, in the order they were linked
+	tags          map[int]*models.Tag
+	reviews       map[int]*models.Review
+	reviewRatings map[int]map[string]int // review id to sub-ratings
+	users         map[int]*models.User
+	identities    []identity
+	recoveryCodes []recoveryCode
+	totpSteps     map[int]int64 // user id to last accepted TOTP time step
+	settings      map[string]string
+	webhooks      map[int]*models.Webhook
+	deliveries    []models.WebhookDelivery
+}
+
+func New() *Store {
+	return &Store{
+		lastID:        make(map[string]int),
+		movies:        make(map[int]*models.Movie),
+		movieTags:     make(map[int][]int),
+		tags:          make(map[int]*models.Tag),
+		reviews:       make(map[int]*models.Review),
+		reviewRatings: make(map[int]map[string]int),
+		users:         make(map[int]*models.User),
+		totpSteps:     make(map[int]int64),
+		webhooks:      make(map[int]*models.Webhook),
+		// Settings start out as the migrations seed them
+		settings: map[string]string{
+			database.SettingRatingDimensions: strings.Join(models.RatingDimensions, ","),
+		},
+	}
+}
+
+func (s *Store) nextID(table string) int {
+	s.lastID[table]++
+	return s.lastID[table]
+}
+
+// publish hands a change to the event bus, when one is set; call it without holding mu
+func (s *Store) publish(e events.Event) {
+	if s.Events != nil {
+		s.Events.Publish(e)
+	}
+}
+
+// Errors matching what wrapError makes of the Postgres ones
+
+func notFound(entity string) error {
+	return &database.Error{Kind: database.ErrNotFound, Entity: entity, Err: sql.ErrNoRows}
+}
+
+func conflict(entity, constraint string) error {
+	return &database.Error{Kind: database.ErrConflict, Entity: entity, Constraint: constraint}
+}
+
+func violation(entity, constraint string) error {
+	return &database.Error{Kind: database.ErrConstraint, Entity: entity, Constraint: constraint}
+}
+
+// newestFirst orders rows by creation time, then id, both descending
+func newestFirst(createdAt func(i int) time.Time, id func(i int) int) func(i, j int) bool {
+	return func(i, j int) bool {
+		if a, b := createdAt(i), createdAt(j); !a.Equal(b) {
+			return a.After(b)
+		}
+		return id(i) > id(j)
+	}
+}
+
+// sortedIDs returns the keys of m in descending order
+func sortedIDs[V any](m map[int]V) []int {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	return ids
+}
+
+// page keeps the ids (sorted descending) below afterID, up to limit
+func page(ids []int, limit, afterID int) []int {
+	var kept []int
+	for _, id := range ids {
+		if len(kept) == limit {
+			break
+		}
+		if afterID == 0 || id < afterID {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
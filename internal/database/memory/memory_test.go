@@ -0,0 +1,309 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"cinerank/internal/database"
+	"cinerank/internal/events"
+	"cinerank/internal/models"
+)
+
+func mustUser(t *testing.T, s *Store, username string) *models.User {
+	t.Helper()
+	u, err := s.CreateUser(t.Context(), models.RegisterRequest{Username: username, Email: username + "@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func mustMovie(t *testing.T, s *Store, title string, tags ...string) *models.Movie {
+	t.Helper()
+	m, err := s.CreateMovie(t.Context(), models.CreateMovieRequest{Title: title, Director: "Diretor", Year: 2000, Tags: tags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestTagsAreSharedByNameAndReplacedOnUpdate(t *testing.T) {
+	s := New()
+	first := mustMovie(t, s, "Cidade de Deus", "Drama", "Crime", "")
+	mustMovie(t, s, "Central do Brasil", "Drama")
+
+	tags, _ := s.GetAllTags(t.Context())
+	if len(tags) != 2 || tags[0].Name != "Crime" || tags[1].Name != "Drama" {
+		t.Fatalf("tags = %+v", tags)
+	}
+	if len(first.Tags) != 2 {
+		t.Errorf("created movie tags = %q", first.Tags)
+	}
+
+	updated, err := s.UpdateMovie(t.Context(), first.ID, models.CreateMovieRequest{Title: "Cidade de Deus", Tags: []string{"Favela"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.Tags) != 1 || updated.Tags[0] != "Favela" {
+		t.Errorf("updated tags = %q", updated.Tags)
+	}
+
+	crime := tags[0]
+	if err := s.DeleteTag(t.Context(), crime.ID); err != nil {
+		t.Fatal(err)
+	}
+	drama, _ := s.GetAllMoviesWithStats(t.Context(), "drama")
+	if len(drama) != 1 || drama[0].Title != "Central do Brasil" {
+		t.Errorf("search by tag = %+v", drama)
+	}
+}
+
+func TestStatsCountEachReviewOnce(t *testing.T) {
+	s := New()
+	movie := mustMovie(t, s, "Cidade de Deus", "Drama", "Crime")
+	var reviews []*models.Review
+	for i, rating := range []int{5, 4, 2} {
+		u := mustUser(t, s, []string{"ana", "bia", "caio"}[i])
+		r, err := s.CreateReview(t.Context(), models.CreateReviewRequest{MovieID: movie.ID, Rating: rating, Title: "ok"}, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reviews = append(reviews, r)
+	}
+
+	movies, _ := s.GetAllMoviesWithStats(t.Context(), "")
+	if got := movies[0]; got.ReviewCount != 3 || got.AverageRating != 11.0/3 {
+		t.Errorf("count = %d, average = %v", got.ReviewCount, got.AverageRating)
+	}
+	byID, _ := s.GetMoviesWithStatsByIDs(t.Context(), []int{movie.ID, 99})
+	if len(byID) != 1 || byID[movie.ID].ReviewCount != 3 {
+		t.Errorf("by id = %+v", byID)
+	}
+
+	stats, err := s.GetMovieStats(t.Context(), movie.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RatingSum != 11 || stats.Histogram != [5]int{0, 1, 0, 1, 1} || stats.LastReviewedAt == nil {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// Edits move a review between histogram buckets; deletes and deleted authors drop it
+	if _, err := s.UpdateReview(t.Context(), reviews[0].ID, models.CreateReviewRequest{Rating: 3, Title: "ok"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteReview(t.Context(), reviews[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	stats, _ = s.GetMovieStats(t.Context(), movie.ID)
+	if stats.ReviewCount != 2 || stats.Histogram != [5]int{0, 1, 1, 0, 0} || stats.AverageRating() != 2.5 {
+		t.Errorf("after edits: stats = %+v", stats)
+	}
+	if err := s.DeleteUser(t.Context(), reviews[2].UserID); err != nil {
+		t.Fatal(err)
+	}
+	stats, _ = s.GetMovieStats(t.Context(), movie.ID)
+	if stats.ReviewCount != 1 || stats.Histogram != [5]int{0, 0, 1, 0, 0} {
+		t.Errorf("after deleting an author: stats = %+v", stats)
+	}
+
+	if _, err := s.GetMovieStats(t.Context(), 99); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("unknown movie: err = %v", err)
+	}
+}
+
+func TestErrorsMatchDomainErrors(t *testing.T) {
+	s := New()
+	u := mustUser(t, s, "ana")
+	mustMovie(t, s, "Cidade de Deus")
+	if _, err := s.CreateTag(t.Context(), "Drama"); err != nil {
+		t.Fatal(err)
+	}
+	canceled, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	tests := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"missing movie", func() error { _, err := s.GetMovieByID(t.Context(), 42); return err }(), database.ErrNotFound},
+		{"duplicate tag", func() error { _, err := s.CreateTag(t.Context(), "Drama"); return err }(), database.ErrConflict},
+		{"duplicate email", func() error { _, err := s.CreateExternalUser(t.Context(), "outra", "ana@example.com"); return err }(), database.ErrConflict},
+		{"review of missing movie", func() error {
+			_, err := s.CreateReview(t.Context(), models.CreateReviewRequest{MovieID: 42, Rating: 3}, u.ID)
+			return err
+		}(), database.ErrConstraint},
+		{"rating out of range", func() error {
+			_, err := s.CreateReview(t.Context(), models.CreateReviewRequest{MovieID: 1, Rating: 6}, u.ID)
+			return err
+		}(), database.ErrConstraint},
+		{"unknown rating dimension", func() error {
+			_, err := s.CreateReview(t.Context(), models.CreateReviewRequest{MovieID: 1, Rating: 3, SubRatings: map[string]int{"plot": 3}}, u.ID)
+			return err
+		}(), database.ErrConstraint},
+		{"sub-rating out of range", func() error {
+			_, err := s.CreateReview(t.Context(), models.CreateReviewRequest{MovieID: 1, Rating: 3, SubRatings: map[string]int{models.DimensionStory: 0}}, u.ID)
+			return err
+		}(), database.ErrConstraint},
+		{"unknown role", func() error {
+			_, err := s.UpdateUser(t.Context(), u.ID, models.UpdateUserRequest{Username: "ana", Email: "ana@example.com", Role: "root"})
+			return err
+		}(), database.ErrConstraint},
+		{"delete missing webhook", s.DeleteWebhook(t.Context(), 7), database.ErrNotFound},
+		{"canceled request", func() error { _, err := s.GetAllMoviesWithStats(canceled, ""); return err }(), database.ErrCanceled},
+	}
+
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.kind) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.err, tt.kind)
+		}
+	}
+}
+
+func TestDeleteUserCascades(t *testing.T) {
+	s := New()
+	u := mustUser(t, s, "ana")
+	movie := mustMovie(t, s, "Cidade de Deus")
+	if _, err := s.CreateReview(t.Context(), models.CreateReviewRequest{MovieID: movie.ID, Rating: 5, Title: "ok"}, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EnableTOTP(t.Context(), u.ID, []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LinkIdentity(t.Context(), u.ID, "https://issuer", "sub", "ana@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteUser(t.Context(), u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if reviews, _ := s.GetReviewsByMovieID(t.Context(), movie.ID); len(reviews) != 0 {
+		t.Errorf("reviews left: %+v", reviews)
+	}
+	if n, _ := s.CountUnusedRecoveryCodes(t.Context(), u.ID); n != 0 {
+		t.Errorf("%d recovery codes left", n)
+	}
+	if _, err := s.GetUserByIdentity(t.Context(), "https://issuer", "sub"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("identity lookup: %v", err)
+	}
+}
+
+func TestWritesQueueWebhooksAndPublishEvents(t *testing.T) {
+	s := New()
+	bus := events.NewMemoryBus()
+	s.Events = bus
+	received, cancel := bus.Subscribe()
+	defer cancel()
+
+	if _, err := s.CreateWebhook(t.Context(), models.WebhookRequest{URL: "https://example.com/hook", Events: []string{models.EventReviewCreated}}); err != nil {
+		t.Fatal(err)
+	}
+	u := mustUser(t, s, "ana")
+	movie := mustMovie(t, s, "Cidade de Deus")
+	if _, err := s.CreateReview(t.Context(), models.CreateReviewRequest{MovieID: movie.ID, Rating: 4, Title: "ok"}, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := <-received; e.Type != events.TypeMovieCreated {
+		t.Errorf("first event = %s", e.Type)
+	}
+	e := <-received
+	if e.Type != events.TypeReviewCreated || e.ReviewCount != 1 || e.Review.User.Username != "ana" || e.Review.Movie.Title != "Cidade de Deus" {
+		t.Errorf("review event = %+v", e)
+	}
+
+	deliveries, _ := s.GetRecentDeliveries(t.Context(), 10)
+	if len(deliveries) != 1 || deliveries[0].Event != models.EventReviewCreated || deliveries[0].URL != "https://example.com/hook" {
+		t.Fatalf("deliveries = %+v", deliveries)
+	}
+	var body struct {
+		Event string        `json:"event"`
+		Data  models.Review `json:"data"`
+	}
+	if err := json.Unmarshal(s.deliveries[0].Payload, &body); err != nil || body.Data.MovieID != movie.ID {
+		t.Errorf("payload = %s (%v)", s.deliveries[0].Payload, err)
+	}
+}
+
+func TestChangesPublishEvents(t *testing.T) {
+	s := New()
+	u := mustUser(t, s, "ana")
+	movie := mustMovie(t, s, "Cidade de Deus", "drama")
+	review, err := s.CreateReview(t.Context(), models.CreateReviewRequest{MovieID: movie.ID, Rating: 4, Title: "ok"}, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, _ := s.GetAllTags(t.Context())
+
+	bus := events.NewMemoryBus()
+	s.Events = bus
+	received, cancel := bus.Subscribe()
+	defer cancel()
+
+	ctx := t.Context()
+	steps := []struct {
+		want string
+		run  func() error
+	}{
+		{events.TypeMovieUpdated, func() error {
+			_, err := s.UpdateMovie(ctx, movie.ID, models.CreateMovieRequest{Title: "Cidade de Deus", Director: "Meirelles", Year: 2002})
+			return err
+		}},
+		{events.TypeReviewUpdated, func() error {
+			_, err := s.UpdateReview(ctx, review.ID, models.CreateReviewRequest{Rating: 5, Title: "ótimo"})
+			return err
+		}},
+		{events.TypeReviewDeleted, func() error { return s.DeleteReview(ctx, review.ID) }},
+		{events.TypeTagUpdated, func() error {
+			_, err := s.UpdateTag(ctx, tags[0].ID, "crime")
+			return err
+		}},
+		{events.TypeTagDeleted, func() error { return s.DeleteTag(ctx, tags[0].ID) }},
+		{events.TypeUserUpdated, func() error {
+			_, err := s.UpdateUser(ctx, u.ID, models.UpdateUserRequest{Username: "ana2", Email: u.Email, Role: "user"})
+			return err
+		}},
+		{events.TypeUserDeleted, func() error { return s.DeleteUser(ctx, u.ID) }},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.want, err)
+		}
+		if e := <-received; e.Type != step.want {
+			t.Errorf("got %s, want %s", e.Type, step.want)
+		}
+	}
+
+	// Failed writes announce nothing
+	if err := s.DeleteReview(ctx, review.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("deleting twice = %v", err)
+	}
+	if len(received) != 0 {
+		t.Errorf("failed write published %+v", <-received)
+	}
+}
+
+func TestPagesAreNewestFirstByID(t *testing.T) {
+	s := New()
+	u := mustUser(t, s, "ana")
+	movie := mustMovie(t, s, "Cidade de Deus")
+	for i := 0; i < 5; i++ {
+		if _, err := s.CreateReview(t.Context(), models.CreateReviewRequest{MovieID: movie.ID, Rating: 3, Title: "ok"}, u.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pages, _ := s.GetReviewPagesByMovieIDs(t.Context(), []int{movie.ID, movie.ID, 99}, 2, 4)
+	got := pages[movie.ID]
+	if len(pages) != 1 || len(got) != 2 || got[0].ID != 3 || got[1].ID != 2 {
+		t.Errorf("pages = %+v", pages)
+	}
+
+	all, _ := s.ListReviewsPage(t.Context(), 10, 0)
+	if len(all) != 5 || all[0].ID != 5 {
+		t.Errorf("list = %+v", all)
+	}
+}
@@ -0,0 +1,433 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"cinerank/internal/database"
+	"cinerank/internal/events"
+	"cinerank/internal/models"
+)
+
+// Movie operations
+func (s *Store) GetAllMoviesWithStats(ctx context.Context, search string) ([]models.MovieWithStats, error) {
+	if err := database.ContextError(ctx, "movie"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	movies := []models.MovieWithStats{}
+	for _, id := range sortedIDs(s.movies) {
+		if search != "" && !s.movieMatches(id, search) {
+			continue
+		}
+		m := s.movieWithStats(id)
+		m.Tags = s.tagNames(id)
+		movies = append(movies, m)
+	}
+	sort.SliceStable(movies, newestFirst(
+		func(i int) time.Time { return movies[i].CreatedAt },
+		func(i int) int { return movies[i].ID },
+	))
+	return movies, nil
+}
+
+func (s *Store) GetMovieByID(ctx context.Context, id int) (*models.Movie, error) {
+	if err := database.ContextError(ctx, "movie"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.movies[id]
+	if !ok {
+		return nil, notFound("movie")
+	}
+	movie := *m
+	movie.Tags = s.tagNames(id)
+	return &movie, nil
+}
+
+func (s *Store) GetMovieStats(ctx context.Context, movieID int) (*models.MovieStats, error) {
+	if err := database.ContextError(ctx, "movie"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.movies[movieID]; !ok {
+		return nil, notFound("movie")
+	}
+	stats := s.movieStats(movieID)
+	return &stats, nil
+}
+
+func (s *Store) CreateMovie(ctx context.Context, req models.CreateMovieRequest) (*models.Movie, error) {
+	if err := database.ContextError(ctx, "movie"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	now := time.Now()
+	m := models.Movie{
+		ID:         s.nextID("movies"),
+		Title:      req.Title,
+		Director:   req.Director,
+		Year:       req.Year,
+		Plot:       req.Plot,
+		PosterURL:  req.PosterURL,
+		IMDBRating: req.IMDBRating,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	stored := m
+	s.movies[m.ID] = &stored
+
+	for _, tagName := range req.Tags {
+		if tagName == "" {
+			continue
+		}
+		s.linkTag(m.ID, s.getOrCreateTag(tagName))
+		m.Tags = append(m.Tags, tagName)
+	}
+	s.enqueueEvent(models.EventMovieCreated, m)
+	s.mu.Unlock()
+
+	published := m
+	s.publish(events.Event{Type: events.TypeMovieCreated, MovieID: m.ID, Movie: &published})
+
+	return &m, nil
+}
+
+func (s *Store) UpdateMovie(ctx context.Context, id int, req models.CreateMovieRequest) (*models.Movie, error) {
+	if err := database.ContextError(ctx, "movie"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	stored, ok := s.movies[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, notFound("movie")
+	}
+	stored.Title = req.Title
+	stored.Director = req.Director
+	stored.Year = req.Year
+	stored.Plot = req.Plot
+	stored.PosterURL = req.PosterURL
+	stored.IMDBRating = req.IMDBRating
+	stored.UpdatedAt = time.Now()
+	m := *stored
+
+	// Tags are replaced as a whole
+	delete(s.movieTags, id)
+	for _, tagName := range req.Tags {
+		s.linkTag(id, s.getOrCreateTag(tagName))
+		m.Tags = append(m.Tags, tagName)
+	}
+	s.mu.Unlock()
+
+	published := m
+	s.publish(events.Event{Type: events.TypeMovieUpdated, MovieID: m.ID, Movie: &published})
+
+	return &m, nil
+}
+
+func (s *Store) DeleteMovie(ctx context.Context, id int) error {
+	if err := database.ContextError(ctx, "movie"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	stored, ok := s.movies[id]
+	if !ok {
+		s.mu.Unlock()
+		return notFound("movie")
+	}
+	m := *stored
+	delete(s.movies, id)
+	delete(s.movieTags, id)
+	for reviewID, r := range s.reviews {
+		if r.MovieID == id {
+			delete(s.reviews, reviewID)
+			delete(s.reviewRatings, reviewID)
+		}
+	}
+	s.enqueueEvent(models.EventMovieDeleted, m)
+	s.mu.Unlock()
+
+	s.publish(events.Event{Type: events.TypeMovieDeleted, MovieID: m.ID, Movie: &m})
+
+	return nil
+}
+
+// movieMatches reports whether the movie's title or one of its tags contains search, ignoring case
+func (s *Store) movieMatches(id int, search string) bool {
+	search = strings.ToLower(search)
+	if strings.Contains(strings.ToLower(s.movies[id].Title), search) {
+		return true
+	}
+	for _, tagID := range s.movieTags[id] {
+		if strings.Contains(strings.ToLower(s.tags[tagID].Name), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// movieWithStats copies a movie with its review stats and no tags
+func (s *Store) movieWithStats(id int) models.MovieWithStats {
+	stats := s.movieStats(id)
+	return models.MovieWithStats{
+		Movie:         *s.movies[id],
+		ReviewCount:   stats.ReviewCount,
+		AverageRating: stats.AverageRating(),
+	}
+}
+
+// movieStats aggregates a movie's reviews as the movie_stats table holds them
+func (s *Store) movieStats(id int) models.MovieStats {
+	stats := models.MovieStats{MovieID: id}
+	for _, r := range s.reviews {
+		if r.MovieID != id {
+			continue
+		}
+		stats.ReviewCount++
+		stats.RatingSum += r.Rating
+		stats.Histogram[r.Rating-1]++
+		if stats.LastReviewedAt == nil || r.CreatedAt.After(*stats.LastReviewedAt) {
+			created := r.CreatedAt
+			stats.LastReviewedAt = &created
+		}
+	}
+	return stats
+}
+
+// tagNames lists a movie's tag names alphabetically, nil when it has none
+func (s *Store) tagNames(movieID int) []string {
+	var names []string
+	for _, tag := range s.movieTagList(movieID) {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+func (s *Store) movieTagList(movieID int) []models.Tag {
+	var tags []models.Tag
+	for _, tagID := range s.movieTags[movieID] {
+		tags = append(tags, *s.tags[tagID])
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags
+}
+
+func (s *Store) getOrCreateTag(name string) int {
+	for id, t := range s.tags {
+		if t.Name == name {
+			return id
+		}
+	}
+	id := s.nextID("tags")
+	s.tags[id] = &models.Tag{ID: id, Name: name}
+	return id
+}
+
+// linkTag attaches a tag to a movie, doing nothing when it already is
+func (s *Store) linkTag(movieID, tagID int) {
+	for _, id := range s.movieTags[movieID] {
+		if id == tagID {
+			return
+		}
+	}
+	s.movieTags[movieID] = append(s.movieTags[movieID], tagID)
+}
+
+// Tag operations
+func (s *Store) GetAllTags(ctx context.Context) ([]models.Tag, error) {
+	if err := database.ContextError(ctx, "tag"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tags := []models.Tag{}
+	for _, t := range s.tags {
+		tags = append(tags, *t)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+func (s *Store) GetTagByID(ctx context.Context, id int) (*models.Tag, error) {
+	if err := database.ContextError(ctx, "tag"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tags[id]
+	if !ok {
+		return nil, notFound("tag")
+	}
+	tag := *t
+	return &tag, nil
+}
+
+func (s *Store) CreateTag(ctx context.Context, name string) (*models.Tag, error) {
+	if err := database.ContextError(ctx, "tag"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tagNameTaken(name, 0) {
+		return nil, conflict("tag", "tags_name_key")
+	}
+	t := models.Tag{ID: s.nextID("tags"), Name: name}
+	stored := t
+	s.tags[t.ID] = &stored
+	return &t, nil
+}
+
+func (s *Store) UpdateTag(ctx context.Context, id int, name string) (*models.Tag, error) {
+	if err := database.ContextError(ctx, "tag"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	t, ok := s.tags[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, notFound("tag")
+	}
+	if s.tagNameTaken(name, id) {
+		s.mu.Unlock()
+		return nil, conflict("tag", "tags_name_key")
+	}
+	t.Name = name
+	tag := *t
+	s.mu.Unlock()
+
+	s.publish(events.Event{Type: events.TypeTagUpdated})
+	return &tag, nil
+}
+
+func (s *Store) DeleteTag(ctx context.Context, id int) error {
+	if err := database.ContextError(ctx, "tag"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if _, ok := s.tags[id]; !ok {
+		s.mu.Unlock()
+		return notFound("tag")
+	}
+	delete(s.tags, id)
+	for movieID, tagIDs := range s.movieTags {
+		kept := tagIDs[:0]
+		for _, tagID := range tagIDs {
+			if tagID != id {
+				kept = append(kept, tagID)
+			}
+		}
+		s.movieTags[movieID] = kept
+	}
+	s.mu.Unlock()
+
+	s.publish(events.Event{Type: events.TypeTagDeleted})
+	return nil
+}
+
+// tagNameTaken reports whether a tag other than exceptID already has name
+func (s *Store) tagNameTaken(name string, exceptID int) bool {
+	for id, t := range s.tags {
+		if id != exceptID && t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Batched lookups, newest first by id like their SQL counterparts
+
+func (s *Store) GetMoviesWithStatsByIDs(ctx context.Context, ids []int) (map[int]*models.MovieWithStats, error) {
+	if err := database.ContextError(ctx, "movie"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	movies := make(map[int]*models.MovieWithStats, len(ids))
+	for _, id := range ids {
+		if _, ok := s.movies[id]; ok {
+			m := s.movieWithStats(id)
+			movies[id] = &m
+		}
+	}
+	return movies, nil
+}
+
+func (s *Store) ListMoviesPage(ctx context.Context, search string, limit, afterID int) ([]models.MovieWithStats, error) {
+	if err := database.ContextError(ctx, "movie"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []int
+	for _, id := range sortedIDs(s.movies) {
+		if search == "" || s.movieMatches(id, search) {
+			ids = append(ids, id)
+		}
+	}
+
+	movies := []models.MovieWithStats{}
+	for _, id := range page(ids, limit, afterID) {
+		movies = append(movies, s.movieWithStats(id))
+	}
+	return movies, nil
+}
+
+func (s *Store) GetMoviePagesByTagIDs(ctx context.Context, tagIDs []int, limit, afterID int) (map[int][]models.MovieWithStats, error) {
+	if err := database.ContextError(ctx, "movie"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pages := make(map[int][]models.MovieWithStats, len(tagIDs))
+	seen := make(map[int]bool, len(tagIDs))
+	for _, tagID := range tagIDs {
+		if seen[tagID] {
+			continue
+		}
+		seen[tagID] = true
+		var ids []int
+		for _, movieID := range sortedIDs(s.movies) {
+			for _, id := range s.movieTags[movieID] {
+				if id == tagID {
+					ids = append(ids, movieID)
+					break
+				}
+			}
+		}
+		for _, movieID := range page(ids, limit, afterID) {
+			pages[tagID] = append(pages[tagID], s.movieWithStats(movieID))
+		}
+	}
+	return pages, nil
+}
+
+func (s *Store) GetTagsByMovieIDs(ctx context.Context, movieIDs []int) (map[int][]models.Tag, error) {
+	if err := database.ContextError(ctx, "tag"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tags := make(map[int][]models.Tag, len(movieIDs))
+	for _, id := range movieIDs {
+		if movieTags := s.movieTagList(id); len(movieTags) > 0 {
+			tags[id] = movieTags
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,359 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"cinerank/internal/database"
+	"cinerank/internal/events"
+	"cinerank/internal/models"
+)
+
+// Review operations
+func (s *Store) GetReviewsByMovieID(ctx context.Context, movieID int) ([]models.Review, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reviews := []models.Review{}
+	for _, r := range s.newestReviews() {
+		if r.MovieID == movieID {
+			r.User = &models.User{Username: s.users[r.UserID].Username}
+			r.SubRatings = s.subRatings(r.ID)
+			reviews = append(reviews, r)
+		}
+	}
+	return reviews, nil
+}
+
+func (s *Store) GetRecentReviews(ctx context.Context, limit int) ([]models.Review, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reviews := []models.Review{}
+	for _, r := range s.newestReviews() {
+		if len(reviews) == limit {
+			break
+		}
+		r.Movie = &models.Movie{Title: s.movies[r.MovieID].Title}
+		r.User = &models.User{Username: s.users[r.UserID].Username}
+		r.SubRatings = s.subRatings(r.ID)
+		reviews = append(reviews, r)
+	}
+	return reviews, nil
+}
+
+func (s *Store) GetReviewCountsByMonth(ctx context.Context, movieID int, since time.Time) ([]models.MonthlyCount, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byMonth := map[time.Time]int{}
+	for _, r := range s.reviews {
+		if r.MovieID != movieID || r.CreatedAt.Before(since) {
+			continue
+		}
+		created := r.CreatedAt.UTC()
+		byMonth[time.Date(created.Year(), created.Month(), 1, 0, 0, 0, 0, time.UTC)]++
+	}
+
+	counts := []models.MonthlyCount{}
+	for month, count := range byMonth {
+		counts = append(counts, models.MonthlyCount{Month: month, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Month.Before(counts[j].Month) })
+	return counts, nil
+}
+
+func (s *Store) GetSubRatingAverages(ctx context.Context, movieID int, dimensions []string) ([]models.SubRatingAverage, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	averages := s.subRatingAverages([]int{movieID}, dimensions)[movieID]
+	if averages == nil {
+		averages = []models.SubRatingAverage{}
+	}
+	return averages, nil
+}
+
+func (s *Store) GetSubRatingAveragesByMovieIDs(ctx context.Context, movieIDs []int, dimensions []string) (map[int][]models.SubRatingAverage, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.subRatingAverages(movieIDs, dimensions), nil
+}
+
+// subRatingAverages averages the sub-ratings per movie, leaving out movies without any
+func (s *Store) subRatingAverages(movieIDs []int, dimensions []string) map[int][]models.SubRatingAverage {
+	counts := map[int]map[string]int{}
+	sums := map[int]map[string]int{}
+	for id, ratings := range s.reviewRatings {
+		movieID := s.reviews[id].MovieID
+		if !slices.Contains(movieIDs, movieID) {
+			continue
+		}
+		if counts[movieID] == nil {
+			counts[movieID], sums[movieID] = map[string]int{}, map[string]int{}
+		}
+		for dimension, rating := range ratings {
+			counts[movieID][dimension]++
+			sums[movieID][dimension] += rating
+		}
+	}
+
+	byMovie := map[int][]models.SubRatingAverage{}
+	for movieID := range counts {
+		for _, d := range dimensions {
+			if n := counts[movieID][d]; n > 0 {
+				byMovie[movieID] = append(byMovie[movieID], models.SubRatingAverage{
+					Dimension:     d,
+					ReviewCount:   n,
+					AverageRating: float64(sums[movieID][d]) / float64(n),
+				})
+			}
+		}
+	}
+	return byMovie
+}
+
+func (s *Store) GetReviewByID(ctx context.Context, id int) (*models.Review, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.reviews[id]
+	if !ok {
+		return nil, notFound("review")
+	}
+	r := *stored
+	r.User = &models.User{Username: s.users[r.UserID].Username}
+	r.SubRatings = s.subRatings(r.ID)
+	return &r, nil
+}
+
+func (s *Store) CreateReview(ctx context.Context, req models.CreateReviewRequest, userID int) (*models.Review, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if err := checkRatings(req); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	movie, ok := s.movies[req.MovieID]
+	if !ok {
+		s.mu.Unlock()
+		return nil, violation("review", "reviews_movie_id_fkey")
+	}
+	user, ok := s.users[userID]
+	if !ok {
+		s.mu.Unlock()
+		return nil, violation("review", "reviews_user_id_fkey")
+	}
+
+	now := time.Now()
+	r := models.Review{
+		ID:        s.nextID("reviews"),
+		MovieID:   req.MovieID,
+		UserID:    userID,
+		Rating:    req.Rating,
+		Title:     req.Title,
+		Content:   req.Content,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	stored := r
+	s.reviews[r.ID] = &stored
+	s.setSubRatings(r.ID, req.SubRatings)
+	r.SubRatings = s.subRatings(r.ID)
+	s.enqueueEvent(models.EventReviewCreated, r)
+
+	stats := s.movieWithStats(r.MovieID)
+	live := r
+	live.User = &models.User{ID: userID, Username: user.Username}
+	live.Movie = &models.Movie{ID: movie.ID, Title: movie.Title}
+	s.mu.Unlock()
+
+	s.publish(events.Event{
+		Type:          events.TypeReviewCreated,
+		MovieID:       r.MovieID,
+		Review:        &live,
+		ReviewCount:   stats.ReviewCount,
+		AverageRating: stats.AverageRating,
+	})
+
+	return &r, nil
+}
+
+func (s *Store) UpdateReview(ctx context.Context, id int, req models.CreateReviewRequest) (*models.Review, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	stored, ok := s.reviews[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, notFound("review")
+	}
+	if err := checkRatings(req); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	stored.Rating = req.Rating
+	stored.Title = req.Title
+	stored.Content = req.Content
+	stored.UpdatedAt = time.Now()
+	s.setSubRatings(id, req.SubRatings)
+	r := *stored
+	r.SubRatings = s.subRatings(id)
+	s.mu.Unlock()
+
+	published := r
+	s.publish(events.Event{Type: events.TypeReviewUpdated, MovieID: r.MovieID, Review: &published})
+	return &r, nil
+}
+
+func (s *Store) DeleteReview(ctx context.Context, id int) error {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	r, ok := s.reviews[id]
+	if !ok {
+		s.mu.Unlock()
+		return notFound("review")
+	}
+	delete(s.reviews, id)
+	delete(s.reviewRatings, id)
+	s.mu.Unlock()
+
+	s.publish(events.Event{Type: events.TypeReviewDeleted, MovieID: r.MovieID})
+	return nil
+}
+
+// checkRatings enforces the check constraints of reviews and review_ratings
+func checkRatings(req models.CreateReviewRequest) error {
+	if req.Rating < 1 || req.Rating > 5 {
+		return violation("review", "reviews_rating_check")
+	}
+	for dimension, rating := range req.SubRatings {
+		if !slices.Contains(models.RatingDimensions, dimension) {
+			return violation("review", "review_ratings_dimension_check")
+		}
+		if rating < 1 || rating > 5 {
+			return violation("review", "review_ratings_rating_check")
+		}
+	}
+	return nil
+}
+
+// setSubRatings replaces a review's sub-ratings
+func (s *Store) setSubRatings(reviewID int, ratings map[string]int) {
+	if len(ratings) == 0 {
+		delete(s.reviewRatings, reviewID)
+		return
+	}
+	s.reviewRatings[reviewID] = maps.Clone(ratings)
+}
+
+func (s *Store) GetSubRatingsByReviewIDs(ctx context.Context, reviewIDs []int) (map[int]map[string]int, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ratings := map[int]map[string]int{}
+	for _, id := range reviewIDs {
+		if r := s.subRatings(id); r != nil {
+			ratings[id] = r
+		}
+	}
+	return ratings, nil
+}
+
+// subRatings copies a review's sub-ratings, nil when it has none
+func (s *Store) subRatings(reviewID int) map[string]int {
+	return maps.Clone(s.reviewRatings[reviewID])
+}
+
+// newestReviews copies every review, newest first
+func (s *Store) newestReviews() []models.Review {
+	reviews := make([]models.Review, 0, len(s.reviews))
+	for _, r := range s.reviews {
+		reviews = append(reviews, *r)
+	}
+	sort.Slice(reviews, newestFirst(
+		func(i int) time.Time { return reviews[i].CreatedAt },
+		func(i int) int { return reviews[i].ID },
+	))
+	return reviews
+}
+
+func (s *Store) GetReviewPagesByMovieIDs(ctx context.Context, movieIDs []int, limit, afterID int) (map[int][]models.Review, error) {
+	return s.reviewPages(ctx, func(r *models.Review) int { return r.MovieID }, movieIDs, limit, afterID)
+}
+
+func (s *Store) GetReviewPagesByUserIDs(ctx context.Context, userIDs []int, limit, afterID int) (map[int][]models.Review, error) {
+	return s.reviewPages(ctx, func(r *models.Review) int { return r.UserID }, userIDs, limit, afterID)
+}
+
+func (s *Store) ListReviewsPage(ctx context.Context, limit, afterID int) ([]models.Review, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reviews := []models.Review{}
+	for _, id := range page(sortedIDs(s.reviews), limit, afterID) {
+		reviews = append(reviews, *s.reviews[id])
+	}
+	return reviews, nil
+}
+
+// reviewPages pages reviews for each parent id, as returned by parentOf
+func (s *Store) reviewPages(ctx context.Context, parentOf func(r *models.Review) int, parentIDs []int, limit, afterID int) (map[int][]models.Review, error) {
+	if err := database.ContextError(ctx, "review"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byParent := make(map[int][]int)
+	for _, id := range sortedIDs(s.reviews) {
+		parentID := parentOf(s.reviews[id])
+		byParent[parentID] = append(byParent[parentID], id)
+	}
+
+	pages := make(map[int][]models.Review, len(parentIDs))
+	seen := make(map[int]bool, len(parentIDs))
+	for _, parentID := range parentIDs {
+		if seen[parentID] {
+			continue
+		}
+		seen[parentID] = true
+		for _, id := range page(byParent[parentID], limit, afterID) {
+			pages[parentID] = append(pages[parentID], *s.reviews[id])
+		}
+	}
+	return pages, nil
+}
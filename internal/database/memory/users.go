@@ -0,0 +1,435 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cinerank/internal/database"
+	"cinerank/internal/events"
+	"cinerank/internal/models"
+)
+
+// User operations
+func (s *Store) CreateUser(ctx context.Context, req models.RegisterRequest) (*models.User, error) {
+	return s.CreateUserWithRole(ctx, req, "user")
+}
+
+// CreateUserWithRole expects req.Password to already be hashed
+func (s *Store) CreateUserWithRole(ctx context.Context, req models.RegisterRequest, role string) (*models.User, error) {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.insertUser(req.Username, req.Email, req.Password, role)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Email == email {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, notFound("user")
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, notFound("user")
+	}
+	user := *u
+	user.PasswordHash = ""
+	return &user, nil
+}
+
+func (s *Store) GetAllUsers(ctx context.Context) ([]models.User, error) {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []models.User{}
+	for _, u := range s.users {
+		users = append(users, public(*u))
+	}
+	sort.Slice(users, newestFirst(
+		func(i int) time.Time { return users[i].CreatedAt },
+		func(i int) int { return users[i].ID },
+	))
+	return users, nil
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id int) error {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if _, ok := s.users[id]; !ok {
+		s.mu.Unlock()
+		return notFound("user")
+	}
+	delete(s.users, id)
+	for reviewID, r := range s.reviews {
+		if r.UserID == id {
+			delete(s.reviews, reviewID)
+			delete(s.reviewRatings, reviewID)
+		}
+	}
+	s.identities = deleteWhere(s.identities, func(i identity) bool { return i.userID == id })
+	s.recoveryCodes = deleteWhere(s.recoveryCodes, func(c recoveryCode) bool { return c.userID == id })
+	delete(s.totpSteps, id)
+	s.mu.Unlock()
+
+	s.publish(events.Event{Type: events.TypeUserDeleted})
+	return nil
+}
+
+func (s *Store) UpdateUser(ctx context.Context, id int, req models.UpdateUserRequest) (*models.User, error) {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	u, ok := s.users[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, notFound("user")
+	}
+	if err := s.checkUser(id, req.Username, req.Email, req.Role); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	u.Username = req.Username
+	u.Email = req.Email
+	u.Role = req.Role
+	u.UpdatedAt = time.Now()
+	user := public(*u)
+	s.mu.Unlock()
+
+	s.publish(events.Event{Type: events.TypeUserUpdated})
+	return &user, nil
+}
+
+func (s *Store) UsernameExists(ctx context.Context, username string) (bool, error) {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Username == username {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) GetUsersByIDs(ctx context.Context, ids []int) (map[int]*models.User, error) {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make(map[int]*models.User, len(ids))
+	for _, id := range ids {
+		if u, ok := s.users[id]; ok {
+			user := public(*u)
+			users[id] = &user
+		}
+	}
+	return users, nil
+}
+
+// insertUser adds a user after the checks the users table enforces
+func (s *Store) insertUser(username, email, passwordHash, role string) (models.User, error) {
+	if err := s.checkUser(0, username, email, role); err != nil {
+		return models.User{}, err
+	}
+	now := time.Now()
+	u := models.User{
+		ID:           s.nextID("users"),
+		Username:     username,
+		Email:        email,
+		Role:         role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		PasswordHash: passwordHash,
+	}
+	s.users[u.ID] = &u
+
+	created := u
+	created.PasswordHash = ""
+	return created, nil
+}
+
+// checkUser enforces the role check and the unique username and email, ignoring user exceptID
+func (s *Store) checkUser(exceptID int, username, email, role string) error {
+	if role != "user" && role != "admin" {
+		return violation("user", "users_role_check")
+	}
+	for id, u := range s.users {
+		if id == exceptID {
+			continue
+		}
+		if u.Username == username {
+			return conflict("user", "users_username_key")
+		}
+		if u.Email == email {
+			return conflict("user", "users_email_key")
+		}
+	}
+	return nil
+}
+
+// public strips the secrets listing queries leave out
+func public(u models.User) models.User {
+	u.PasswordHash = ""
+	u.TOTPSecret = ""
+	return u
+}
+
+func deleteWhere[T any](rows []T, match func(T) bool) []T {
+	kept := rows[:0]
+	for _, row := range rows {
+		if !match(row) {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+// External identity operations
+func (s *Store) GetUserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	if err := database.ContextError(ctx, "identity"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, i := range s.identities {
+		if i.issuer == issuer && i.subject == subject {
+			user := *s.users[i.userID]
+			user.PasswordHash = ""
+			return &user, nil
+		}
+	}
+	return nil, notFound("identity")
+}
+
+// LinkIdentity attaches an external identity to a user, refreshing its email if already linked
+func (s *Store) LinkIdentity(ctx context.Context, userID int, issuer, subject, email string) error {
+	if err := database.ContextError(ctx, "identity"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n, i := range s.identities {
+		if i.issuer == issuer && i.subject == subject {
+			s.identities[n].email = email
+			return nil
+		}
+	}
+	if _, ok := s.users[userID]; !ok {
+		return violation("identity", "user_identities_user_id_fkey")
+	}
+	s.identities = append(s.identities, identity{userID: userID, issuer: issuer, subject: subject, email: email})
+	return nil
+}
+
+// CreateExternalUser creates a user without a password, so it can only sign in through its identity provider
+func (s *Store) CreateExternalUser(ctx context.Context, username, email string) (*models.User, error) {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.insertUser(username, email, "", "user")
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Two-factor operations
+func (s *Store) SetTOTPSecret(ctx context.Context, userID int, secret string) error {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userID]; ok {
+		u.TOTPSecret = secret
+		u.TOTPEnabled = false
+		u.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *Store) EnableTOTP(ctx context.Context, userID int, recoveryCodeHashes []string) error {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.replaceRecoveryCodes(userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	if u, ok := s.users[userID]; ok {
+		u.TOTPEnabled = true
+		u.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *Store) DisableTOTP(ctx context.Context, userID int) error {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userID]; ok {
+		u.TOTPSecret = ""
+		u.TOTPEnabled = false
+		u.UpdatedAt = time.Now()
+	}
+	s.recoveryCodes = deleteWhere(s.recoveryCodes, func(c recoveryCode) bool { return c.userID == userID })
+	return nil
+}
+
+func (s *Store) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	if err := database.ContextError(ctx, "recovery code"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.replaceRecoveryCodes(userID, codeHashes)
+}
+
+func (s *Store) replaceRecoveryCodes(userID int, codeHashes []string) error {
+	if _, ok := s.users[userID]; !ok && len(codeHashes) > 0 {
+		return violation("recovery code", "recovery_codes_user_id_fkey")
+	}
+	s.recoveryCodes = deleteWhere(s.recoveryCodes, func(c recoveryCode) bool { return c.userID == userID })
+	for _, hash := range codeHashes {
+		s.recoveryCodes = append(s.recoveryCodes, recoveryCode{userID: userID, hash: hash})
+	}
+	return nil
+}
+
+// UseRecoveryCode marks a matching unused code as used and reports whether one was found
+func (s *Store) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	if err := database.ContextError(ctx, "recovery code"); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n, c := range s.recoveryCodes {
+		if c.userID == userID && c.hash == codeHash && !c.used {
+			s.recoveryCodes[n].used = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	if err := database.ContextError(ctx, "user"); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return false, nil
+	}
+	if last, ok := s.totpSteps[userID]; ok && last >= step {
+		return false, nil
+	}
+	s.totpSteps[userID] = step
+	return true, nil
+}
+
+func (s *Store) CountUnusedRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	if err := database.ContextError(ctx, "recovery code"); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, c := range s.recoveryCodes {
+		if c.userID == userID && !c.used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Settings operations
+func (s *Store) GetSetting(ctx context.Context, key string) (string, error) {
+	if err := database.ContextError(ctx, "setting"); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.settings[key], nil
+}
+
+func (s *Store) SetSetting(ctx context.Context, key, value string) error {
+	if err := database.ContextError(ctx, "setting"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings[key] = value
+	return nil
+}
+
+// RequireAdmin2FA reports whether admins must have 2FA enabled
+func (s *Store) RequireAdmin2FA(ctx context.Context) (bool, error) {
+	value, err := s.GetSetting(ctx, database.SettingRequireAdmin2FA)
+	if err != nil {
+		return false, err
+	}
+	return value == "true", nil
+}
+
+// RatingDimensions lists the enabled models.RatingDimensions in display order
+func (s *Store) RatingDimensions(ctx context.Context) ([]string, error) {
+	value, err := s.GetSetting(ctx, database.SettingRatingDimensions)
+	if err != nil {
+		return nil, err
+	}
+	return database.ParseRatingDimensions(value), nil
+}
@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"context"
+	"log"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"cinerank/internal/database"
+	"cinerank/internal/models"
+)
+
+// enqueueEvent queues a delivery for every active webhook subscribed to event
+func (s *Store) enqueueEvent(event string, data interface{}) {
+	payload, err := database.EncodeWebhookEvent(event, data)
+	if err != nil {
+		log.Printf("Error encoding %s webhook event: %v", event, err)
+		return
+	}
+
+	now := time.Now()
+	for _, id := range slices.Sorted(maps.Keys(s.webhooks)) {
+		wh := s.webhooks[id]
+		if !wh.Active || !slices.Contains(wh.Events, event) {
+			continue
+		}
+		s.deliveries = append(s.deliveries, models.WebhookDelivery{
+			ID:            s.nextID("webhook_deliveries"),
+			WebhookID:     wh.ID,
+			Event:         event,
+			Payload:       payload,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+}
+
+// Webhook operations
+func (s *Store) GetAllWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	if err := database.ContextError(ctx, "webhook"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhooks := []models.Webhook{}
+	for _, id := range slices.Sorted(maps.Keys(s.webhooks)) {
+		webhooks = append(webhooks, copyWebhook(s.webhooks[id]))
+	}
+	return webhooks, nil
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, req models.WebhookRequest) (*models.Webhook, error) {
+	if err := database.ContextError(ctx, "webhook"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wh := models.Webhook{
+		ID:        s.nextID("webhooks"),
+		URL:       req.URL,
+		Secret:    req.Secret,
+		Events:    slices.Clone(req.Events),
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+	s.webhooks[wh.ID] = &wh
+
+	created := copyWebhook(&wh)
+	return &created, nil
+}
+
+func (s *Store) SetWebhookActive(ctx context.Context, id int, active bool) error {
+	if err := database.ContextError(ctx, "webhook"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wh, ok := s.webhooks[id]
+	if !ok {
+		return notFound("webhook")
+	}
+	wh.Active = active
+	return nil
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, id int) error {
+	if err := database.ContextError(ctx, "webhook"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return notFound("webhook")
+	}
+	delete(s.webhooks, id)
+	s.deliveries = deleteWhere(s.deliveries, func(d models.WebhookDelivery) bool { return d.WebhookID == id })
+	return nil
+}
+
+// GetRecentDeliveries returns the delivery log, newest first
+func (s *Store) GetRecentDeliveries(ctx context.Context, limit int) ([]models.WebhookDelivery, error) {
+	if err := database.ContextError(ctx, "webhook delivery"); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := []models.WebhookDelivery{}
+	for _, d := range s.deliveries {
+		d.Payload = nil
+		d.URL = s.webhooks[d.WebhookID].URL
+		deliveries = append(deliveries, d)
+	}
+	sort.Slice(deliveries, newestFirst(
+		func(i int) time.Time { return deliveries[i].CreatedAt },
+		func(i int) int { return deliveries[i].ID },
+	))
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func copyWebhook(wh *models.Webhook) models.Webhook {
+	c := *wh
+	c.Events = slices.Clone(wh.Events)
+	return c
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"cinerank/internal/models"
+)
+
+// MovieRepository stores movies and the tags attached to them
+type MovieRepository interface {
+	// GetAllMoviesWithStats lists movies newest first, filtered by title or tag when search is set
+	GetAllMoviesWithStats(ctx context.Context, search string) ([]models.MovieWithStats, error)
+	GetMovieByID(ctx context.Context, id int) (*models.Movie, error)
+	// GetMovieStats returns zero stats for a movie without reviews
+	GetMovieStats(ctx context.Context, movieID int) (*models.MovieStats, error)
+	// CreateMovie and UpdateMovie create missing tags by name; UpdateMovie replaces the movie's tags
+	CreateMovie(ctx context.Context, req models.CreateMovieRequest) (*models.Movie, error)
+	UpdateMovie(ctx context.Context, id int, req models.CreateMovieRequest) (*models.Movie, error)
+	// DeleteMovie also deletes the movie's reviews
+	DeleteMovie(ctx context.Context, id int) error
+
+	GetAllTags(ctx context.Context) ([]models.Tag, error)
+	GetTagByID(ctx context.Context, id int) (*models.Tag, error)
+	CreateTag(ctx context.Context, name string) (*models.Tag, error)
+	UpdateTag(ctx context.Context, id int, name string) (*models.Tag, error)
+	DeleteTag(ctx context.Context, id int) error
+
+	GetMoviesWithStatsByIDs(ctx context.Context, ids []int) (map[int]*models.MovieWithStats, error)
+	ListMoviesPage(ctx context.Context, search string, limit, afterID int) ([]models.MovieWithStats, error)
+	GetMoviePagesByTagIDs(ctx context.Context, tagIDs []int, limit, afterID int) (map[int][]models.MovieWithStats, error)
+	GetTagsByMovieIDs(ctx context.Context, movieIDs []int) (map[int][]models.Tag, error)
+}
+
+// ReviewRepository stores reviews; reads fill in the author's username, and those of single reviews,
+// a movie's reviews and recent reviews the sub-ratings too
+type ReviewRepository interface {
+	GetReviewsByMovieID(ctx context.Context, movieID int) ([]models.Review, error)
+	GetRecentReviews(ctx context.Context, limit int) ([]models.Review, error)
+	// GetReviewCountsByMonth counts a movie's reviews written since the given time by UTC month,
+	// oldest first, leaving out months without reviews
+	GetReviewCountsByMonth(ctx context.Context, movieID int, since time.Time) ([]models.MonthlyCount, error)
+	// GetSubRatingAverages averages a movie's sub-ratings in the given dimensions, in their order,
+	// leaving out dimensions no review rated
+	GetSubRatingAverages(ctx context.Context, movieID int, dimensions []string) ([]models.SubRatingAverage, error)
+	GetReviewByID(ctx context.Context, id int) (*models.Review, error)
+	CreateReview(ctx context.Context, req models.CreateReviewRequest, userID int) (*models.Review, error)
+	// UpdateReview replaces the review's sub-ratings with those of req
+	UpdateReview(ctx context.Context, id int, req models.CreateReviewRequest) (*models.Review, error)
+	DeleteReview(ctx context.Context, id int) error
+
+	GetReviewPagesByMovieIDs(ctx context.Context, movieIDs []int, limit, afterID int) (map[int][]models.Review, error)
+	GetReviewPagesByUserIDs(ctx context.Context, userIDs []int, limit, afterID int) (map[int][]models.Review, error)
+	ListReviewsPage(ctx context.Context, limit, afterID int) ([]models.Review, error)
+	// GetSubRatingsByReviewIDs returns the sub-ratings of the reviews that have any
+	GetSubRatingsByReviewIDs(ctx context.Context, reviewIDs []int) (map[int]map[string]int, error)
+	// GetSubRatingAveragesByMovieIDs is GetSubRatingAverages for several movies, leaving out movies without any
+	GetSubRatingAveragesByMovieIDs(ctx context.Context, movieIDs []int, dimensions []string) (map[int][]models.SubRatingAverage, error)
+}
+
+// UserRepository stores users with their external identities and second factors
+type UserRepository interface {
+	CreateUser(ctx context.Context, req models.RegisterRequest) (*models.User, error)
+	CreateUserWithRole(ctx context.Context, req models.RegisterRequest, role string) (*models.User, error)
+	// GetUserByEmail is the only read that fills in PasswordHash
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByID(ctx context.Context, id int) (*models.User, error)
+	GetAllUsers(ctx context.Context) ([]models.User, error)
+	UpdateUser(ctx context.Context, id int, req models.UpdateUserRequest) (*models.User, error)
+	DeleteUser(ctx context.Context, id int) error
+	UsernameExists(ctx context.Context, username string) (bool, error)
+	GetUsersByIDs(ctx context.Context, ids []int) (map[int]*models.User, error)
+
+	CreateExternalUser(ctx context.Context, username, email string) (*models.User, error)
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error)
+	LinkIdentity(ctx context.Context, userID int, issuer, subject, email string) error
+
+	SetTOTPSecret(ctx context.Context, userID int, secret string) error
+	EnableTOTP(ctx context.Context, userID int, recoveryCodeHashes []string) error
+	DisableTOTP(ctx context.Context, userID int) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+	// UseTOTPStep records step as the user's last accepted TOTP time step and reports
+	// false, recording nothing, when it is not after the last one
+	UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	CountUnusedRecoveryCodes(ctx context.Context, userID int) (int, error)
+}
+
+// SettingsRepository stores site-wide settings; unset keys read as ""
+type SettingsRepository interface {
+	GetSetting(ctx context.Context, key string) (string, error)
+	SetSetting(ctx context.Context, key, value string) error
+	RequireAdmin2FA(ctx context.Context) (bool, error)
+	// RatingDimensions lists the enabled models.RatingDimensions in display order
+	RatingDimensions(ctx context.Context) ([]string, error)
+}
+
+// WebhookRepository stores webhooks and their delivery log
+type WebhookRepository interface {
+	GetAllWebhooks(ctx context.Context) ([]models.Webhook, error)
+	CreateWebhook(ctx context.Context, req models.WebhookRequest) (*models.Webhook, error)
+	SetWebhookActive(ctx context.Context, id int, active bool) error
+	DeleteWebhook(ctx context.Context, id int) error
+	GetRecentDeliveries(ctx context.Context, limit int) ([]models.WebhookDelivery, error)
+}
+
+// AnalyticsRepository aggregates site activity for the admin dashboard. Periods and months are
+// in UTC, and those without activity are left out.
+type AnalyticsRepository interface {
+	// GetActivity counts new users and reviews by models.PeriodDay or models.PeriodWeek since the given time
+	GetActivity(ctx context.Context, period string, since time.Time) ([]models.ActivityCount, error)
+	GetTopReviewers(ctx context.Context, limit int) ([]models.ReviewerStats, error)
+	// GetRankedMovies orders the movies with at least minReviews reviews by a models.Rank* ranking
+	GetRankedMovies(ctx context.Context, ranking string, minReviews, limit int) ([]models.MovieWithStats, error)
+	// GetTagPopularity orders tags by the reviews of their movies, then by how many movies they tag
+	GetTagPopularity(ctx context.Context, limit int) ([]models.TagStats, error)
+	// GetRatingTrend aggregates the ratings of reviews by the month they were written, since the given time
+	GetRatingTrend(ctx context.Context, since time.Time) ([]models.RatingTrend, error)
+}
+
+// Store is everything the web layer reads and writes. Every method runs under ctx and fails
+// with ErrCanceled or ErrTimeout when ctx ends first.
+type Store interface {
+	MovieRepository
+	ReviewRepository
+	UserRepository
+	SettingsRepository
+	WebhookRepository
+	AnalyticsRepository
+}
+
+var _ Store = (*DB)(nil)
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"cinerank/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// Review stats live in movie_stats. Review writes adjust a movie's row by deltas in their own
+// transaction; the row lock taken by the upsert serializes concurrent writers to the same movie.
+// RebuildMovieStats recomputes every row from the reviews, should the table ever drift.
+
+// bumpMovieStatsQuery adds $3 reviews rated $2 to movie $1, which may not have a row yet
+const bumpMovieStatsQuery = `
+	INSERT INTO movie_stats (movie_id, review_count, rating_sum, rating_1, rating_2, rating_3, rating_4, rating_5, last_reviewed_at)
+	VALUES ($1, $3::int, $2::int * $3::int,
+		CASE WHEN $2::int = 1 THEN $3::int ELSE 0 END, CASE WHEN $2::int = 2 THEN $3::int ELSE 0 END,
+		CASE WHEN $2::int = 3 THEN $3::int ELSE 0 END, CASE WHEN $2::int = 4 THEN $3::int ELSE 0 END,
+		CASE WHEN $2::int = 5 THEN $3::int ELSE 0 END,
+		(SELECT MAX(created_at) FROM reviews WHERE movie_id = $1))
+	ON CONFLICT (movie_id) DO UPDATE SET
+		review_count = movie_stats.review_count + EXCLUDED.review_count,
+		rating_sum = movie_stats.rating_sum + EXCLUDED.rating_sum,
+		rating_1 = movie_stats.rating_1 + EXCLUDED.rating_1,
+		rating_2 = movie_stats.rating_2 + EXCLUDED.rating_2,
+		rating_3 = movie_stats.rating_3 + EXCLUDED.rating_3,
+		rating_4 = movie_stats.rating_4 + EXCLUDED.rating_4,
+		rating_5 = movie_stats.rating_5 + EXCLUDED.rating_5,
+		last_reviewed_at = EXCLUDED.last_reviewed_at
+`
+
+// recomputeMovieStatsQuery rebuilds the rows of the movies matched by where from their reviews
+const recomputeMovieStatsQuery = `
+	INSERT INTO movie_stats (movie_id, review_count, rating_sum, rating_1, rating_2, rating_3, rating_4, rating_5, last_reviewed_at)
+	SELECT m.id, COUNT(r.id), COALESCE(SUM(r.rating), 0),
+		COUNT(*) FILTER (WHERE r.rating = 1), COUNT(*) FILTER (WHERE r.rating = 2),
+		COUNT(*) FILTER (WHERE r.rating = 3), COUNT(*) FILTER (WHERE r.rating = 4),
+		COUNT(*) FILTER (WHERE r.rating = 5), MAX(r.created_at)
+	FROM movies m
+	LEFT JOIN reviews r ON r.movie_id = m.id
+	%s
+	GROUP BY m.id
+	ON CONFLICT (movie_id) DO UPDATE SET
+		review_count = EXCLUDED.review_count,
+		rating_sum = EXCLUDED.rating_sum,
+		rating_1 = EXCLUDED.rating_1,
+		rating_2 = EXCLUDED.rating_2,
+		rating_3 = EXCLUDED.rating_3,
+		rating_4 = EXCLUDED.rating_4,
+		rating_5 = EXCLUDED.rating_5,
+		last_reviewed_at = EXCLUDED.last_reviewed_at
+`
+
+// bumpMovieStats counts delta reviews rated rating on the movie; a negative delta uncounts them
+func bumpMovieStats(ctx context.Context, tx *sql.Tx, movieID, rating, delta int) error {
+	_, err := tx.ExecContext(ctx, bumpMovieStatsQuery, movieID, rating, delta)
+	return err
+}
+
+// recomputeMovieStats rebuilds the stats of the given movies, for writes that touch too many
+// reviews to adjust one at a time
+func recomputeMovieStats(ctx context.Context, tx *sql.Tx, movieIDs []int) error {
+	if len(movieIDs) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(recomputeMovieStatsQuery, "WHERE m.id = ANY($1)"), pq.Array(movieIDs))
+	return err
+}
+
+func (db *DB) GetMovieStats(ctx context.Context, movieID int) (*models.MovieStats, error) {
+	ctx, end := db.begin(ctx, "GetMovieStats")
+	defer end()
+
+	query := `
+		SELECT m.id, COALESCE(s.review_count, 0), COALESCE(s.rating_sum, 0),
+			COALESCE(s.rating_1, 0), COALESCE(s.rating_2, 0), COALESCE(s.rating_3, 0),
+			COALESCE(s.rating_4, 0), COALESCE(s.rating_5, 0), s.last_reviewed_at
+		FROM movies m
+		LEFT JOIN movie_stats s ON s.movie_id = m.id
+		WHERE m.id = $1
+	`
+
+	var s models.MovieStats
+	h := &s.Histogram
+	err := db.QueryRowContext(ctx, query, movieID).Scan(
+		&s.MovieID, &s.ReviewCount, &s.RatingSum,
+		&h[0], &h[1], &h[2], &h[3], &h[4], &s.LastReviewedAt,
+	)
+	if err != nil {
+		return nil, wrapError(ctx, "movie", err)
+	}
+
+	return &s, nil
+}
+
+func (db *DB) GetReviewCountsByMonth(ctx context.Context, movieID int, since time.Time) ([]models.MonthlyCount, error) {
+	ctx, end := db.begin(ctx, "GetReviewCountsByMonth")
+	defer end()
+
+	query := `
+		SELECT date_trunc('month', created_at AT TIME ZONE 'UTC') AS month, COUNT(*)
+		FROM reviews
+		WHERE movie_id = $1 AND created_at >= $2
+		GROUP BY month
+		ORDER BY month
+	`
+
+	rows, err := db.QueryContext(ctx, query, movieID, since)
+	if err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	defer rows.Close()
+
+	counts := []models.MonthlyCount{}
+	for rows.Next() {
+		var c models.MonthlyCount
+		if err := rows.Scan(&c.Month, &c.Count); err != nil {
+			return nil, wrapError(ctx, "review", err)
+		}
+		c.Month = utcDate(c.Month)
+		counts = append(counts, c)
+	}
+
+	recordRows(ctx, len(counts))
+	return counts, wrapError(ctx, "review", rows.Err())
+}
+
+// RebuildMovieStats recomputes the stats of every movie from its reviews and returns how many
+// movies it covered. Review writes wait until it finishes.
+func (db *DB) RebuildMovieStats(ctx context.Context) (int, error) {
+	ctx, end := db.begin(ctx, "RebuildMovieStats")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, wrapError(ctx, "movie", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE reviews IN SHARE MODE"); err != nil {
+		return 0, wrapError(ctx, "movie", err)
+	}
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(recomputeMovieStatsQuery, ""))
+	if err != nil {
+		return 0, wrapError(ctx, "movie", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, wrapError(ctx, "movie", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, wrapError(ctx, "movie", err)
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"strings"
+
+	"cinerank/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// SettingRatingDimensions holds the enabled models.RatingDimensions, comma separated
+const SettingRatingDimensions = "rating_dimensions"
+
+// ParseRatingDimensions reads the rating dimensions setting in display order, skipping unknown names
+func ParseRatingDimensions(value string) []string {
+	enabled := strings.Split(value, ",")
+	dimensions := []string{}
+	for _, d := range models.RatingDimensions {
+		if slices.Contains(enabled, d) {
+			dimensions = append(dimensions, d)
+		}
+	}
+	return dimensions
+}
+
+// RatingDimensions returns the rating dimensions reviews may rate, in display order
+func (db *DB) RatingDimensions(ctx context.Context) ([]string, error) {
+	value, err := db.GetSetting(ctx, SettingRatingDimensions)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRatingDimensions(value), nil
+}
+
+// insertSubRatings stores a review's sub-ratings; review_ratings checks the dimensions and ratings
+func insertSubRatings(ctx context.Context, tx *sql.Tx, reviewID int, ratings map[string]int) error {
+	for _, d := range slices.Sorted(maps.Keys(ratings)) {
+		_, err := tx.ExecContext(ctx, "INSERT INTO review_ratings (review_id, dimension, rating) VALUES ($1, $2, $3)", reviewID, d, ratings[d])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillSubRatings loads the sub-ratings of the reviews in place
+func (db *DB) fillSubRatings(ctx context.Context, reviews []models.Review) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+	ids := make([]int, len(reviews))
+	for i := range reviews {
+		ids[i] = reviews[i].ID
+	}
+
+	ratings, err := db.subRatingsByReviewID(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range reviews {
+		reviews[i].SubRatings = ratings[reviews[i].ID]
+	}
+	return nil
+}
+
+func (db *DB) GetSubRatingsByReviewIDs(ctx context.Context, reviewIDs []int) (map[int]map[string]int, error) {
+	ctx, end := db.begin(ctx, "GetSubRatingsByReviewIDs")
+	defer end()
+
+	ratings, err := db.subRatingsByReviewID(ctx, reviewIDs)
+	if err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	recordRows(ctx, len(ratings))
+	return ratings, nil
+}
+
+func (db *DB) subRatingsByReviewID(ctx context.Context, reviewIDs []int) (map[int]map[string]int, error) {
+	rows, err := db.QueryContext(ctx, "SELECT review_id, dimension, rating FROM review_ratings WHERE review_id = ANY($1)", pq.Array(reviewIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := map[int]map[string]int{}
+	for rows.Next() {
+		var reviewID, rating int
+		var dimension string
+		if err := rows.Scan(&reviewID, &dimension, &rating); err != nil {
+			return nil, err
+		}
+		if ratings[reviewID] == nil {
+			ratings[reviewID] = map[string]int{}
+		}
+		ratings[reviewID][dimension] = rating
+	}
+	return ratings, rows.Err()
+}
+
+func (db *DB) GetSubRatingAverages(ctx context.Context, movieID int, dimensions []string) ([]models.SubRatingAverage, error) {
+	ctx, end := db.begin(ctx, "GetSubRatingAverages")
+	defer end()
+
+	byMovie, err := db.subRatingAverages(ctx, []int{movieID}, dimensions)
+	if err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	averages := byMovie[movieID]
+	if averages == nil {
+		averages = []models.SubRatingAverage{}
+	}
+	recordRows(ctx, len(averages))
+	return averages, nil
+}
+
+func (db *DB) GetSubRatingAveragesByMovieIDs(ctx context.Context, movieIDs []int, dimensions []string) (map[int][]models.SubRatingAverage, error) {
+	ctx, end := db.begin(ctx, "GetSubRatingAveragesByMovieIDs")
+	defer end()
+
+	byMovie, err := db.subRatingAverages(ctx, movieIDs, dimensions)
+	if err != nil {
+		return nil, wrapError(ctx, "review", err)
+	}
+	recordRows(ctx, len(byMovie))
+	return byMovie, nil
+}
+
+func (db *DB) subRatingAverages(ctx context.Context, movieIDs []int, dimensions []string) (map[int][]models.SubRatingAverage, error) {
+	query := `
+		SELECT r.movie_id, rr.dimension, COUNT(*), AVG(rr.rating::float)
+		FROM review_ratings rr
+		JOIN reviews r ON r.id = rr.review_id
+		WHERE r.movie_id = ANY($1) AND rr.dimension = ANY($2::text[])
+		GROUP BY r.movie_id, rr.dimension
+		ORDER BY r.movie_id, array_position($2::text[], rr.dimension::text)
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(movieIDs), pq.Array(dimensions))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byMovie := map[int][]models.SubRatingAverage{}
+	for rows.Next() {
+		var movieID int
+		var a models.SubRatingAverage
+		if err := rows.Scan(&movieID, &a.Dimension, &a.ReviewCount, &a.AverageRating); err != nil {
+			return nil, err
+		}
+		byMovie[movieID] = append(byMovie[movieID], a)
+	}
+	return byMovie, rows.Err()
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SettingRequireAdmin2FA forces admin accounts to enroll in 2FA before using the admin panel
+const SettingRequireAdmin2FA = "require_admin_2fa"
+
+// Two-factor operations
+func (db *DB) SetTOTPSecret(ctx context.Context, userID int, secret string) error {
+	ctx, end := db.begin(ctx, "SetTOTPSecret")
+	defer end()
+
+	_, err := db.ExecContext(ctx,
+		"UPDATE users SET totp_secret = $1, totp_enabled = FALSE, updated_at = NOW() WHERE id = $2",
+		secret, userID,
+	)
+	return wrapError(ctx, "user", err)
+}
+
+func (db *DB) EnableTOTP(ctx context.Context, userID int, recoveryCodeHashes []string) error {
+	ctx, end := db.begin(ctx, "EnableTOTP")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(ctx, "user", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE users SET totp_enabled = TRUE, updated_at = NOW() WHERE id = $1", userID)
+	if err != nil {
+		return wrapError(ctx, "user", err)
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return wrapError(ctx, "user", err)
+	}
+
+	return wrapError(ctx, "user", tx.Commit())
+}
+
+func (db *DB) DisableTOTP(ctx context.Context, userID int) error {
+	ctx, end := db.begin(ctx, "DisableTOTP")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(ctx, "user", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, updated_at = NOW() WHERE id = $1",
+		userID,
+	)
+	if err != nil {
+		return wrapError(ctx, "user", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID)
+	if err != nil {
+		return wrapError(ctx, "user", err)
+	}
+
+	return wrapError(ctx, "user", tx.Commit())
+}
+
+func (db *DB) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	ctx, end := db.begin(ctx, "ReplaceRecoveryCodes")
+	defer end()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapError(ctx, "user", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return wrapError(ctx, "user", err)
+	}
+
+	return wrapError(ctx, "user", tx.Commit())
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks a matching unused code as used and reports whether one was found
+func (db *DB) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	ctx, end := db.begin(ctx, "UseRecoveryCode")
+	defer end()
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, codeHash)
+	if err != nil {
+		return false, wrapError(ctx, "user", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapError(ctx, "user", err)
+	}
+	return n == 1, nil
+}
+
+func (db *DB) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	ctx, end := db.begin(ctx, "UseTOTPStep")
+	defer end()
+
+	// A single conditional update, so two requests racing with the same code cannot both win
+	result, err := db.ExecContext(ctx, `
+		UPDATE users SET totp_last_step = $2
+		WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)
+	`, userID, step)
+	if err != nil {
+		return false, wrapError(ctx, "user", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, wrapError(ctx, "user", err)
+	}
+	return n == 1, nil
+}
+
+func (db *DB) CountUnusedRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	ctx, end := db.begin(ctx, "CountUnusedRecoveryCodes")
+	defer end()
+
+	var count int
+	err := db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL",
+		userID,
+	).Scan(&count)
+	return count, wrapError(ctx, "user", err)
+}
+
+// Settings operations
+func (db *DB) GetSetting(ctx context.Context, key string) (string, error) {
+	ctx, end := db.begin(ctx, "GetSetting")
+	defer end()
+
+	var value string
+	err := db.QueryRowContext(ctx, "SELECT value FROM settings WHERE key = $1", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, wrapError(ctx, "setting", err)
+}
+
+func (db *DB) SetSetting(ctx context.Context, key, value string) error {
+	ctx, end := db.begin(ctx, "SetSetting")
+	defer end()
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO settings (key, value, updated_at) VALUES ($1, $2, NOW())
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
+	`, key, value)
+	return wrapError(ctx, "setting", err)
+}
+
+// RequireAdmin2FA reports whether admins must have 2FA enabled
+func (db *DB) RequireAdmin2FA(ctx context.Context) (bool, error) {
+	value, err := db.GetSetting(ctx, SettingRequireAdmin2FA)
+	if err != nil {
+		return false, err
+	}
+	return value == "true", nil
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"cinerank/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// webhookEvent is the JSON body sent to subscribers
+type webhookEvent struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// EncodeWebhookEvent builds the body delivered to webhooks subscribed to event
+func EncodeWebhookEvent(event string, data interface{}) ([]byte, error) {
+	return json.Marshal(webhookEvent{Event: event, CreatedAt: time.Now().UTC(), Data: data})
+}
+
+// enqueueEvent queues a delivery for every active webhook subscribed to event.
+// It runs inside the caller's transaction so events are only sent for committed changes.
+func enqueueEvent(ctx context.Context, tx *sql.Tx, event string, data interface{}) error {
+	payload, err := EncodeWebhookEvent(event, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload, created_at, next_attempt_at)
+		SELECT id, $1, $2, NOW(), NOW()
+		FROM webhooks
+		WHERE active AND $1 = ANY(events)
+	`, event, payload)
+	return err
+}
+
+// Webhook operations
+func (db *DB) GetAllWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, end := db.begin(ctx, "GetAllWebhooks")
+	defer end()
+
+	rows, err := db.QueryContext(ctx, "SELECT id, url, secret, events, active, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, wrapError(ctx, "webhook", err)
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var wh models.Webhook
+		err := rows.Scan(&wh.ID, &wh.URL, &wh.Secret, pq.Array(&wh.Events), &wh.Active, &wh.CreatedAt)
+		if err != nil {
+			return nil, wrapError(ctx, "webhook", err)
+		}
+		webhooks = append(webhooks, wh)
+	}
+
+	recordRows(ctx, len(webhooks))
+	return webhooks, wrapError(ctx, "webhook", rows.Err())
+}
+
+func (db *DB) CreateWebhook(ctx context.Context, req models.WebhookRequest) (*models.Webhook, error) {
+	ctx, end := db.begin(ctx, "CreateWebhook")
+	defer end()
+
+	query := `
+		INSERT INTO webhooks (url, secret, events, active, created_at)
+		VALUES ($1, $2, $3, TRUE, NOW())
+		RETURNING id, url, secret, events, active, created_at
+	`
+
+	var wh models.Webhook
+	err := db.QueryRowContext(ctx, query, req.URL, req.Secret, pq.Array(req.Events)).Scan(
+		&wh.ID, &wh.URL, &wh.Secret, pq.Array(&wh.Events), &wh.Active, &wh.CreatedAt,
+	)
+	if err != nil {
+		return nil, wrapError(ctx, "webhook", err)
+	}
+
+	return &wh, nil
+}
+
+func (db *DB) SetWebhookActive(ctx context.Context, id int, active bool) error {
+	ctx, end := db.begin(ctx, "SetWebhookActive")
+	defer end()
+
+	result, err := db.ExecContext(ctx, "UPDATE webhooks SET active = $2 WHERE id = $1", id, active)
+	if err != nil {
+		return wrapError(ctx, "webhook", err)
+	}
+	return notFoundIfNoRows("webhook", result)
+}
+
+func (db *DB) DeleteWebhook(ctx context.Context, id int) error {
+	ctx, end := db.begin(ctx, "DeleteWebhook")
+	defer end()
+
+	result, err := db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return wrapError(ctx, "webhook", err)
+	}
+	return notFoundIfNoRows("webhook", result)
+}
+
+// Delivery operations
+
+// ClaimDueDeliveries returns pending deliveries that are due and pushes their next attempt back by lease,
+// so another worker (or this one after a crash) only retries them once the lease runs out
+func (db *DB) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	ctx, end := db.begin(ctx, "ClaimDueDeliveries")
+	defer end()
+
+	query := `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts,
+			COALESCE(d.response_status, 0), d.last_error, d.next_attempt_at, d.created_at, d.delivered_at,
+			w.url, w.secret
+	`
+
+	rows, err := db.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		return nil, wrapError(ctx, "webhook delivery", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err := rows.Scan(
+			&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts,
+			&d.ResponseStatus, &d.LastError, &d.NextAttemptAt, &d.CreatedAt, &d.DeliveredAt,
+			&d.URL, &d.Secret,
+		)
+		if err != nil {
+			return nil, wrapError(ctx, "webhook delivery", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	recordRows(ctx, len(deliveries))
+	return deliveries, wrapError(ctx, "webhook delivery", rows.Err())
+}
+
+// RecordDeliveryAttempt stores the outcome of an attempt; d carries the new status, attempt count and next attempt time
+func (db *DB) RecordDeliveryAttempt(ctx context.Context, d models.WebhookDelivery) error {
+	ctx, end := db.begin(ctx, "RecordDeliveryAttempt")
+	defer end()
+
+	var responseStatus sql.NullInt64
+	if d.ResponseStatus != 0 {
+		responseStatus = sql.NullInt64{Int64: int64(d.ResponseStatus), Valid: true}
+	}
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, response_status = $4, last_error = $5,
+			next_attempt_at = $6, delivered_at = $7
+		WHERE id = $1
+	`, d.ID, d.Status, d.Attempts, responseStatus, d.LastError, d.NextAttemptAt, d.DeliveredAt)
+	return wrapError(ctx, "webhook delivery", err)
+}
+
+// GetRecentDeliveries returns the delivery log, newest first
+func (db *DB) GetRecentDeliveries(ctx context.Context, limit int) ([]models.WebhookDelivery, error) {
+	ctx, end := db.begin(ctx, "GetRecentDeliveries")
+	defer end()
+
+	query := `
+		SELECT d.id, d.webhook_id, d.event, d.status, d.attempts, COALESCE(d.response_status, 0),
+			d.last_error, d.next_attempt_at, d.created_at, d.delivered_at, w.url
+		FROM webhook_deliveries d
+		JOIN webhooks w ON d.webhook_id = w.id
+		ORDER BY d.created_at DESC, d.id DESC
+		LIMIT $1
+	`
+
+	rows, err := db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, wrapError(ctx, "webhook delivery", err)
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err := rows.Scan(
+			&d.ID, &d.WebhookID, &d.Event, &d.Status, &d.Attempts, &d.ResponseStatus,
+			&d.LastError, &d.NextAttemptAt, &d.CreatedAt, &d.DeliveredAt, &d.URL,
+		)
+		if err != nil {
+			return nil, wrapError(ctx, "webhook delivery", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	recordRows(ctx, len(deliveries))
+	return deliveries, wrapError(ctx, "webhook delivery", rows.Err())
+}
@@ -0,0 +1,107 @@
+// Package events carries domain events from database writes to subscribers such as live page streams.
+package events
+
+import (
+	"sync"
+
+	"cinerank/internal/models"
+)
+
+// Event types
+const (
+	TypeReviewCreated = "review.created"
+	TypeReviewUpdated = "review.updated"
+	TypeReviewDeleted = "review.deleted"
+	TypeMovieCreated  = "movie.created"
+	TypeMovieUpdated  = "movie.updated"
+	TypeMovieDeleted  = "movie.deleted"
+	// Tag and user changes carry no movie; they show up in movie tags and review authors
+	TypeTagUpdated  = "tag.updated"
+	TypeTagDeleted  = "tag.deleted"
+	TypeUserUpdated = "user.updated"
+	TypeUserDeleted = "user.deleted"
+)
+
+// subscriberBuffer is how many events a slow subscriber can lag behind before it starts missing them
+const subscriberBuffer = 16
+
+type Event struct {
+	Type    string         `json:"type"`
+	MovieID int            `json:"movie_id"`
+	Review  *models.Review `json:"review,omitempty"`
+	Movie   *models.Movie  `json:"movie,omitempty"`
+	// Movie stats after a review change
+	ReviewCount   int     `json:"review_count"`
+	AverageRating float64 `json:"average_rating"`
+}
+
+// Publisher accepts events; the database publishes to it after each committed write
+type Publisher interface {
+	Publish(e Event)
+}
+
+// Bus delivers published events to every subscriber
+type Bus interface {
+	Publisher
+	// Subscribe returns a channel of future events and a function that ends the subscription
+	Subscribe() (<-chan Event, func())
+	// Close ends every subscription, closing their channels; later subscriptions start closed
+	Close()
+}
+
+// MemoryBus is an in-process bus; subscribers only see events published by the same process
+type MemoryBus struct {
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	closed bool
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subs: make(map[chan Event]struct{})}
+}
+
+func (b *MemoryBus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		// Close may have ended the subscription already
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *MemoryBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// Publish delivers e to every subscriber without blocking; subscribers with a full buffer miss it
+func (b *MemoryBus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestMemoryBusFansOut(t *testing.T) {
+	b := NewMemoryBus()
+	first, cancelFirst := b.Subscribe()
+	second, cancelSecond := b.Subscribe()
+	defer cancelSecond()
+
+	b.Publish(Event{Type: TypeReviewCreated, MovieID: 1})
+
+	for _, ch := range []<-chan Event{first, second} {
+		if e := <-ch; e.MovieID != 1 {
+			t.Errorf("got %+v", e)
+		}
+	}
+
+	cancelFirst()
+	cancelFirst() // cancelling twice is harmless
+	if _, ok := <-first; ok {
+		t.Error("channel still open after cancel")
+	}
+
+	b.Publish(Event{Type: TypeReviewCreated, MovieID: 2})
+	if e := <-second; e.MovieID != 2 {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestMemoryBusDropsForSlowSubscribers(t *testing.T) {
+	b := NewMemoryBus()
+	ch, cancel := b.Subscribe()
+	defer cancel()
+
+	// Publish never blocks, even when nobody reads
+	for i := 0; i < subscriberBuffer*2; i++ {
+		b.Publish(Event{MovieID: i})
+	}
+
+	if len(ch) != subscriberBuffer {
+		t.Fatalf("buffered %d events, want %d", len(ch), subscriberBuffer)
+	}
+	if e := <-ch; e.MovieID != 0 {
+		t.Errorf("first buffered event = %+v, want the oldest", e)
+	}
+}
+
+func TestMemoryBusCloseEndsSubscriptions(t *testing.T) {
+	b := NewMemoryBus()
+	ch, cancel := b.Subscribe()
+
+	b.Close()
+	if _, ok := <-ch; ok {
+		t.Error("channel still open after Close")
+	}
+	cancel() // cancelling after Close is harmless
+
+	late, _ := b.Subscribe()
+	if _, ok := <-late; ok {
+		t.Error("subscription after Close is open")
+	}
+	b.Publish(Event{MovieID: 1})
+}
@@ -0,0 +1,186 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// NotifyChannel is the Postgres channel events travel on
+	NotifyChannel = "cinerank_events"
+	// Postgres rejects NOTIFY payloads of 8000 bytes or more
+	maxNotifyPayload = 7900
+
+	listenerMinReconnect = 10 * time.Second
+	listenerMaxReconnect = time.Minute
+	listenerPingInterval = 90 * time.Second
+)
+
+// PostgresBus relays events through Postgres LISTEN/NOTIFY, so subscribers on every instance
+// sharing the database receive them. Published events reach local subscribers on their way back
+// from Postgres, like everyone else's.
+type PostgresBus struct {
+	db       *sql.DB
+	listener *pq.Listener
+	local    *MemoryBus
+}
+
+// NewPostgresBus starts listening on NotifyChannel; dsn opens the dedicated listener connection.
+// Call Run to relay notifications to subscribers.
+func NewPostgresBus(db *sql.DB, dsn string) (*PostgresBus, error) {
+	listener := pq.NewListener(dsn, listenerMinReconnect, listenerMaxReconnect, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Event bus listener: %v", err)
+		}
+	})
+	if err := listener.Listen(NotifyChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen for events: %w", err)
+	}
+
+	return &PostgresBus{db: db, listener: listener, local: NewMemoryBus()}, nil
+}
+
+// Run relays notifications to local subscribers until ctx is cancelled, then closes the listener
+func (b *PostgresBus) Run(ctx context.Context) {
+	defer b.listener.Close()
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-b.listener.Notify:
+			// A nil notification means the connection was re-established; events sent meanwhile are lost
+			if n == nil {
+				continue
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil {
+				log.Printf("Error decoding event: %v", err)
+				continue
+			}
+			b.local.Publish(e)
+		case <-ping.C:
+			// Detects dead connections the listener would otherwise only notice on the next notification
+			go b.listener.Ping()
+		}
+	}
+}
+
+// Publish sends e with pg_notify on its own; failures are logged since events are best effort.
+// Writes send their events with Notify instead, inside their transaction.
+func (b *PostgresBus) Publish(e Event) {
+	payload, err := notifyPayload(e)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", e.Type, err)
+		return
+	}
+
+	if _, err := b.db.Exec("SELECT pg_notify($1, $2)", NotifyChannel, payload); err != nil {
+		log.Printf("Error publishing %s event: %v", e.Type, err)
+	}
+}
+
+// Notify sends e on NotifyChannel as part of tx. Postgres delivers it when tx commits, and never
+// if it rolls back, so listeners hear about every committed write and nothing else.
+func Notify(ctx context.Context, tx *sql.Tx, e Event) error {
+	payload, err := notifyPayload(e)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", NotifyChannel, payload)
+	return err
+}
+
+func (b *PostgresBus) Subscribe() (<-chan Event, func()) {
+	return b.local.Subscribe()
+}
+
+// Close ends local subscriptions; the listener closes when Run returns
+func (b *PostgresBus) Close() {
+	b.local.Close()
+}
+
+// notifyPayload encodes e to fit in a NOTIFY payload. Too long an event has its review content
+// or movie plot shortened, and if that is not enough, loses the review and movie altogether:
+// what is left still says what changed.
+func notifyPayload(e Event) (string, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	if len(payload) < maxNotifyPayload {
+		return string(payload), nil
+	}
+
+	// Copies, so the caller's review or movie is left alone
+	switch {
+	case e.Review != nil:
+		review := *e.Review
+		e.Review = &review
+		payload, err = shortenToFit(e, &review.Content)
+	case e.Movie != nil:
+		movie := *e.Movie
+		e.Movie = &movie
+		payload, err = shortenToFit(e, &movie.Plot)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(payload) < maxNotifyPayload {
+		return string(payload), nil
+	}
+
+	e.Review, e.Movie = nil, nil
+	if payload, err = json.Marshal(e); err != nil {
+		return "", err
+	}
+	if len(payload) >= maxNotifyPayload {
+		return "", fmt.Errorf("payload of %d bytes exceeds the NOTIFY limit", len(payload))
+	}
+	return string(payload), nil
+}
+
+// shortenToFit encodes e with the longest prefix of *text, marked with "…", that fits in a NOTIFY
+// payload. The result is still too long when even an empty text does not fit.
+func shortenToFit(e Event, text *string) ([]byte, error) {
+	// JSON escaping can make text grow by up to six times, so search for the longest prefix that fits
+	full := *text
+	lo, hi := 0, len(full)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		*text = truncateUTF8(full, mid) + "…"
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) < maxNotifyPayload {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	*text = truncateUTF8(full, lo) + "…"
+	return json.Marshal(e)
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,102 @@
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"cinerank/internal/models"
+)
+
+func TestNotifyPayloadRoundTrip(t *testing.T) {
+	e := Event{
+		Type:          TypeReviewCreated,
+		MovieID:       3,
+		Review:        &models.Review{ID: 9, MovieID: 3, Rating: 5, Title: "Ótimo", Content: "Vale a pena"},
+		ReviewCount:   4,
+		AverageRating: 4.25,
+	}
+
+	payload, err := notifyPayload(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Event
+	if err := json.Unmarshal([]byte(payload), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Review.Content != "Vale a pena" || got.AverageRating != 4.25 || got.MovieID != 3 {
+		t.Errorf("round trip = %+v", got)
+	}
+}
+
+func TestNotifyPayloadShortensLongReviews(t *testing.T) {
+	// Characters that grow when JSON-escaped, mixed with multi-byte runes
+	content := strings.Repeat("<ã>\"", 3000)
+	e := Event{Type: TypeReviewCreated, Review: &models.Review{Title: "Longa", Content: content}}
+
+	payload, err := notifyPayload(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) >= maxNotifyPayload {
+		t.Fatalf("payload is %d bytes", len(payload))
+	}
+
+	var got Event
+	if err := json.Unmarshal([]byte(payload), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(got.Review.Content, "…") || !utf8.ValidString(got.Review.Content) {
+		t.Errorf("content not shortened cleanly: ...%q", got.Review.Content[len(got.Review.Content)-20:])
+	}
+	if !strings.HasPrefix(content, strings.TrimSuffix(got.Review.Content, "…")) {
+		t.Error("shortened content is not a prefix of the original")
+	}
+	if e.Review.Content != content {
+		t.Error("the caller's review was modified")
+	}
+}
+
+func TestNotifyPayloadShortensLongPlots(t *testing.T) {
+	plot := strings.Repeat("Uma história longa. ", 1000)
+	e := Event{Type: TypeMovieUpdated, MovieID: 2, Movie: &models.Movie{ID: 2, Title: "Bacurau", Plot: plot}}
+
+	payload, err := notifyPayload(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Event
+	if err := json.Unmarshal([]byte(payload), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Movie == nil || got.Movie.Title != "Bacurau" || !strings.HasSuffix(got.Movie.Plot, "…") || len(payload) >= maxNotifyPayload {
+		t.Errorf("payload of %d bytes: %+v", len(payload), got.Movie)
+	}
+	if e.Movie.Plot != plot {
+		t.Error("the caller's movie was modified")
+	}
+}
+
+func TestNotifyPayloadFallsBackToIDs(t *testing.T) {
+	// Shortening the plot cannot help when the tags alone are too long
+	tags := make([]string, 100)
+	for i := range tags {
+		tags[i] = strings.Repeat("x", 100)
+	}
+	e := Event{Type: TypeMovieCreated, MovieID: 5, Movie: &models.Movie{ID: 5, Title: "Aquarius", Tags: tags}}
+
+	payload, err := notifyPayload(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Event
+	if err := json.Unmarshal([]byte(payload), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != TypeMovieCreated || got.MovieID != 5 || got.Movie != nil {
+		t.Errorf("fallback payload = %s", payload)
+	}
+}
@@ -0,0 +1,115 @@
+package gql
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+	cursorPrefix    = "cursor:"
+)
+
+// Cursors are opaque to clients; they wrap the id of the last row on a page
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	invalid := &Error{Message: "Invalid pagination cursor", Code: CodeInvalidCursor}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), cursorPrefix) {
+		return 0, invalid
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(string(raw), cursorPrefix))
+	if err != nil || id <= 0 {
+		return 0, invalid
+	}
+	return id, nil
+}
+
+var connectionArgs = graphql.FieldConfigArgument{
+	"first": &graphql.ArgumentConfig{
+		Type:         graphql.Int,
+		DefaultValue: defaultPageSize,
+		Description:  "Page size, at most 100",
+	},
+	"after": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "Return items after this cursor",
+	},
+}
+
+// pageArgs reads first/after and returns the row limit to query (one extra row tells whether a next page exists)
+func pageArgs(args map[string]interface{}) (limit, afterID int, err error) {
+	first, _ := args["first"].(int)
+	if first < 1 || first > maxPageSize {
+		return 0, 0, &Error{Message: "first must be between 1 and " + strconv.Itoa(maxPageSize), Code: CodeValidationFailed}
+	}
+	if after, ok := args["after"].(string); ok && after != "" {
+		if afterID, err = decodeCursor(after); err != nil {
+			return 0, 0, err
+		}
+	}
+	return first + 1, afterID, nil
+}
+
+type edge struct {
+	Cursor string
+	Node   interface{}
+}
+
+type pageInfo struct {
+	HasNextPage bool
+	EndCursor   *string
+}
+
+type connection struct {
+	Edges    []edge
+	PageInfo pageInfo
+}
+
+// newConnection trims the extra row fetched by pageArgs and builds the edges
+func newConnection[T any](rows []T, limit int, id func(*T) int) *connection {
+	conn := &connection{Edges: []edge{}}
+	if len(rows) == limit {
+		rows = rows[:limit-1]
+		conn.PageInfo.HasNextPage = true
+	}
+	for i := range rows {
+		conn.Edges = append(conn.Edges, edge{Cursor: encodeCursor(id(&rows[i])), Node: &rows[i]})
+	}
+	if n := len(conn.Edges); n > 0 {
+		conn.PageInfo.EndCursor = &conn.Edges[n-1].Cursor
+	}
+	return conn
+}
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"endCursor":   &graphql.Field{Type: graphql.String},
+	},
+})
+
+func connectionType(node *graphql.Object) *graphql.Object {
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: node.Name() + "Edge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: graphql.NewNonNull(node)},
+		},
+	})
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: node.Name() + "Connection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType)))},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+		},
+	})
+}
@@ -0,0 +1,145 @@
+package gql
+
+import (
+	"context"
+	"errors"
+
+	"cinerank/internal/database"
+	"cinerank/internal/models"
+	"cinerank/internal/validation"
+)
+
+// Stable error codes in the "extensions" of GraphQL errors, matching the REST problem codes
+const (
+	CodeUnauthorized     = "unauthorized"
+	CodeNotFound         = "not_found"
+	CodeValidationFailed = "validation_failed"
+	CodeInvalidCursor    = "invalid_cursor"
+	CodeTimeout          = "timeout"
+	CodeCanceled         = "canceled"
+	CodeInternal         = "internal_error"
+)
+
+// Error is a GraphQL error carrying a machine-readable code
+type Error struct {
+	Message string
+	Code    string
+	Fields  validation.Errors
+	// cause is the hidden error behind an internal error, logged by Execute with the request's logger
+	cause error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.Code}
+	if len(e.Fields) > 0 {
+		ext["errors"] = e.Fields
+	}
+	return ext
+}
+
+// publicError maps domain errors onto GraphQL errors without leaking internals
+func publicError(err error) error {
+	var gqlErr *Error
+	var fieldErrs validation.Errors
+	switch {
+	case errors.As(err, &gqlErr):
+		return gqlErr
+	case errors.As(err, &fieldErrs):
+		return &Error{Message: "The input contains invalid fields", Code: CodeValidationFailed, Fields: fieldErrs}
+	case errors.Is(err, database.ErrNotFound), errors.Is(err, database.ErrConstraint):
+		return &Error{Message: "The referenced resource does not exist", Code: CodeNotFound}
+	case errors.Is(err, database.ErrTimeout):
+		return &Error{Message: "The request took too long; try again later", Code: CodeTimeout}
+	case errors.Is(err, database.ErrCanceled):
+		// The client went away, so nobody reads this and there is nothing to log
+		return &Error{Message: "The request was canceled", Code: CodeCanceled}
+	default:
+		return &Error{Message: "An unexpected error occurred", Code: CodeInternal, cause: err}
+	}
+}
+
+type pageKey struct {
+	ParentID int
+	Limit    int
+	AfterID  int
+}
+
+// request holds the per-request state resolvers need: the DB, the viewer and the loaders
+type request struct {
+	db     database.Store
+	viewer *models.User
+
+	movies       *Loader[int, *models.MovieWithStats]
+	users        *Loader[int, *models.User]
+	movieTags    *Loader[int, []models.Tag]
+	movieReviews *Loader[pageKey, []models.Review]
+	userReviews  *Loader[pageKey, []models.Review]
+	tagMovies    *Loader[pageKey, []models.MovieWithStats]
+
+	reviewSubRatings *Loader[int, map[string]int]
+	movieSubRatings  *Loader[int, []models.SubRatingAverage]
+}
+
+type contextKey struct{}
+
+// WithRequest attaches fresh loaders and the signed-in user (nil when anonymous) to ctx
+func WithRequest(ctx context.Context, db database.Store, viewer *models.User) context.Context {
+	req := &request{
+		db:        db,
+		viewer:    viewer,
+		movies:    NewLoader(boundTo(ctx, db.GetMoviesWithStatsByIDs)),
+		users:     NewLoader(boundTo(ctx, db.GetUsersByIDs)),
+		movieTags: NewLoader(boundTo(ctx, db.GetTagsByMovieIDs)),
+	}
+	req.movieReviews = NewLoader(pagedBy(ctx, db.GetReviewPagesByMovieIDs))
+	req.userReviews = NewLoader(pagedBy(ctx, db.GetReviewPagesByUserIDs))
+	req.tagMovies = NewLoader(pagedBy(ctx, db.GetMoviePagesByTagIDs))
+	req.reviewSubRatings = NewLoader(boundTo(ctx, db.GetSubRatingsByReviewIDs))
+	req.movieSubRatings = NewLoader(func(movieIDs []int) (map[int][]models.SubRatingAverage, error) {
+		dimensions, err := db.RatingDimensions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return db.GetSubRatingAveragesByMovieIDs(ctx, movieIDs, dimensions)
+	})
+	return context.WithValue(ctx, contextKey{}, req)
+}
+
+func fromContext(ctx context.Context) *request {
+	return ctx.Value(contextKey{}).(*request)
+}
+
+// boundTo runs a batch query under the request's ctx, so loads stop when the request does
+func boundTo[K comparable, V any](ctx context.Context, fetch func(ctx context.Context, keys []K) (map[K]V, error)) func([]K) (map[K]V, error) {
+	return func(keys []K) (map[K]V, error) {
+		return fetch(ctx, keys)
+	}
+}
+
+// pagedBy adapts a per-parent page query to page keys, running one query per distinct (limit, after) pair under ctx
+func pagedBy[V any](ctx context.Context, fetch func(ctx context.Context, parentIDs []int, limit, afterID int) (map[int][]V, error)) func([]pageKey) (map[pageKey][]V, error) {
+	return func(keys []pageKey) (map[pageKey][]V, error) {
+		type window struct{ limit, afterID int }
+		groups := make(map[window][]int)
+		for _, key := range keys {
+			w := window{key.Limit, key.AfterID}
+			groups[w] = append(groups[w], key.ParentID)
+		}
+
+		result := make(map[pageKey][]V, len(keys))
+		for w, parentIDs := range groups {
+			pages, err := fetch(ctx, parentIDs, w.limit, w.afterID)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range parentIDs {
+				result[pageKey{ParentID: id, Limit: w.limit, AfterID: w.afterID}] = pages[id]
+			}
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,56 @@
+package gql
+
+// Loader batches lookups made while one level of a query is resolved.
+// Load queues a key and returns a thunk; the first thunk to run fetches every
+// queued key in one call. graphql-go runs thunks breadth-first, so sibling
+// fields (e.g. the reviewer of every review in a list) share a single query.
+// A Loader lives for one request and is not safe for concurrent use.
+type Loader[K comparable, V any] struct {
+	fetch   func(keys []K) (map[K]V, error)
+	pending []K
+	queued  map[K]bool
+	results map[K]V
+	errs    map[K]error
+}
+
+func NewLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{
+		fetch:   fetch,
+		queued:  make(map[K]bool),
+		results: make(map[K]V),
+		errs:    make(map[K]error),
+	}
+}
+
+// Load queues key for the next batch; keys missing from the fetch result resolve to the zero value
+func (l *Loader[K, V]) Load(key K) func() (V, error) {
+	if _, done := l.results[key]; !done && !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+
+	return func() (V, error) {
+		if l.queued[key] {
+			l.dispatch()
+		}
+		return l.results[key], l.errs[key]
+	}
+}
+
+func (l *Loader[K, V]) dispatch() {
+	keys := l.pending
+	l.pending = nil
+	for _, key := range keys {
+		delete(l.queued, key)
+	}
+
+	found, err := l.fetch(keys)
+	for _, key := range keys {
+		if err != nil {
+			l.errs[key] = err
+			continue
+		}
+		l.results[key] = found[key]
+		delete(l.errs, key)
+	}
+}
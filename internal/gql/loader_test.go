@@ -0,0 +1,137 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestLoaderBatchesQueuedKeys(t *testing.T) {
+	var calls [][]int
+	loader := NewLoader(func(keys []int) (map[int]string, error) {
+		batch := append([]int(nil), keys...)
+		sort.Ints(batch)
+		calls = append(calls, batch)
+		found := make(map[int]string)
+		for _, k := range keys {
+			if k != 3 {
+				found[k] = string(rune('a' + k))
+			}
+		}
+		return found, nil
+	})
+
+	first := loader.Load(1)
+	second := loader.Load(2)
+	missing := loader.Load(3)
+	duplicate := loader.Load(1)
+
+	for _, tt := range []struct {
+		thunk func() (string, error)
+		want  string
+	}{{first, "b"}, {second, "c"}, {missing, ""}, {duplicate, "b"}} {
+		got, err := tt.thunk()
+		if err != nil || got != tt.want {
+			t.Errorf("got (%q, %v), want %q", got, err, tt.want)
+		}
+	}
+	if want := [][]int{{1, 2, 3}}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("fetch calls = %v, want %v", calls, want)
+	}
+
+	// Cached keys are not fetched again; new keys start a new batch
+	cached, _ := loader.Load(2)()
+	fresh, _ := loader.Load(4)()
+	if cached != "c" || fresh != "e" {
+		t.Errorf("cached = %q, fresh = %q", cached, fresh)
+	}
+	if want := [][]int{{1, 2, 3}, {4}}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("fetch calls = %v, want %v", calls, want)
+	}
+}
+
+func TestLoaderSharesBatchError(t *testing.T) {
+	boom := errors.New("boom")
+	calls := 0
+	loader := NewLoader(func(keys []int) (map[int]int, error) {
+		calls++
+		return nil, boom
+	})
+
+	a, b := loader.Load(1), loader.Load(2)
+	if _, err := a(); !errors.Is(err, boom) {
+		t.Errorf("a error = %v", err)
+	}
+	if _, err := b(); !errors.Is(err, boom) {
+		t.Errorf("b error = %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("fetch called %d times, want 1", calls)
+	}
+}
+
+func TestPagedByGroupsByWindow(t *testing.T) {
+	type call struct {
+		ids            []int
+		limit, afterID int
+	}
+	var calls []call
+	fetch := pagedBy(t.Context(), func(_ context.Context, ids []int, limit, afterID int) (map[int][]int, error) {
+		sorted := append([]int(nil), ids...)
+		sort.Ints(sorted)
+		calls = append(calls, call{sorted, limit, afterID})
+		pages := make(map[int][]int)
+		for _, id := range ids {
+			pages[id] = []int{id * 10}
+		}
+		return pages, nil
+	})
+
+	result, err := fetch([]pageKey{
+		{ParentID: 1, Limit: 11},
+		{ParentID: 2, Limit: 11},
+		{ParentID: 1, Limit: 6, AfterID: 40},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("got %d queries, want one per window: %v", len(calls), calls)
+	}
+	if got := result[pageKey{ParentID: 2, Limit: 11}]; !reflect.DeepEqual(got, []int{20}) {
+		t.Errorf("page for parent 2 = %v", got)
+	}
+	if got := result[pageKey{ParentID: 1, Limit: 6, AfterID: 40}]; !reflect.DeepEqual(got, []int{10}) {
+		t.Errorf("page for parent 1 after 40 = %v", got)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	id, err := decodeCursor(encodeCursor(42))
+	if err != nil || id != 42 {
+		t.Fatalf("decodeCursor = (%d, %v)", id, err)
+	}
+	for _, bad := range []string{"42", "!!", encodeCursor(0), "Y3Vyc29yOmFiYw"} {
+		if _, err := decodeCursor(bad); err == nil {
+			t.Errorf("decodeCursor(%q) accepted an invalid cursor", bad)
+		}
+	}
+}
+
+func TestNewConnectionTrimsExtraRow(t *testing.T) {
+	rows := []int{9, 8, 7}
+	conn := newConnection(rows, 3, func(v *int) int { return *v })
+	if !conn.PageInfo.HasNextPage || len(conn.Edges) != 2 {
+		t.Fatalf("hasNextPage = %v, edges = %d", conn.PageInfo.HasNextPage, len(conn.Edges))
+	}
+	if *conn.PageInfo.EndCursor != encodeCursor(8) {
+		t.Errorf("endCursor points at the wrong row")
+	}
+
+	empty := newConnection([]int{}, 3, func(v *int) int { return *v })
+	if empty.PageInfo.HasNextPage || empty.PageInfo.EndCursor != nil || empty.Edges == nil {
+		t.Errorf("empty connection = %+v", empty)
+	}
+}
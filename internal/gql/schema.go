@@ -0,0 +1,519 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"cinerank/internal/database"
+	"cinerank/internal/logging"
+	"cinerank/internal/models"
+	"cinerank/internal/validation"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// NewSchema builds the GraphQL schema; resolvers read the DB and loaders from the context set by WithRequest
+func NewSchema() (graphql.Schema, error) {
+	var movieType, reviewType, userType, tagType *graphql.Object
+	var movieConnection, reviewConnection *graphql.Object
+
+	subRatingType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "SubRating",
+		Description: "A review's rating of one aspect of the movie",
+		Fields: graphql.Fields{
+			"dimension": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Description: "story, acting, cinematography, soundtrack or rewatchability"},
+			"rating":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "1 to 5 stars"},
+		},
+	})
+
+	subRatingAverageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "SubRatingAverage",
+		Fields: graphql.Fields{
+			"dimension": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"reviewCount": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(models.SubRatingAverage).ReviewCount, nil
+				},
+			},
+			"averageRating": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Float),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(models.SubRatingAverage).AverageRating, nil
+				},
+			},
+		},
+	})
+
+	movieType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Movie",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":            movieField(graphql.NewNonNull(graphql.Int), func(m *models.MovieWithStats) interface{} { return m.ID }),
+				"title":         movieField(graphql.NewNonNull(graphql.String), func(m *models.MovieWithStats) interface{} { return m.Title }),
+				"director":      movieField(graphql.NewNonNull(graphql.String), func(m *models.MovieWithStats) interface{} { return m.Director }),
+				"year":          movieField(graphql.NewNonNull(graphql.Int), func(m *models.MovieWithStats) interface{} { return m.Year }),
+				"plot":          movieField(graphql.NewNonNull(graphql.String), func(m *models.MovieWithStats) interface{} { return m.Plot }),
+				"posterUrl":     movieField(graphql.NewNonNull(graphql.String), func(m *models.MovieWithStats) interface{} { return m.PosterURL }),
+				"imdbRating":    movieField(graphql.NewNonNull(graphql.Float), func(m *models.MovieWithStats) interface{} { return m.IMDBRating }),
+				"createdAt":     movieField(graphql.NewNonNull(graphql.DateTime), func(m *models.MovieWithStats) interface{} { return m.CreatedAt }),
+				"updatedAt":     movieField(graphql.NewNonNull(graphql.DateTime), func(m *models.MovieWithStats) interface{} { return m.UpdatedAt }),
+				"reviewCount":   movieField(graphql.NewNonNull(graphql.Int), func(m *models.MovieWithStats) interface{} { return m.ReviewCount }),
+				"averageRating": movieField(graphql.NewNonNull(graphql.Float), func(m *models.MovieWithStats) interface{} { return m.AverageRating }),
+				"tags": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tagType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						load := fromContext(p.Context).movieTags.Load(p.Source.(*models.MovieWithStats).ID)
+						return func() (interface{}, error) {
+							tags, err := load()
+							if err != nil {
+								return nil, publicError(err)
+							}
+							if tags == nil {
+								tags = []models.Tag{}
+							}
+							return tags, nil
+						}, nil
+					},
+				},
+				"subRatingAverages": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(subRatingAverageType))),
+					Description: "Average sub-rating in each enabled dimension that reviews rated",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						load := fromContext(p.Context).movieSubRatings.Load(p.Source.(*models.MovieWithStats).ID)
+						return func() (interface{}, error) {
+							averages, err := load()
+							if err != nil {
+								return nil, publicError(err)
+							}
+							if averages == nil {
+								averages = []models.SubRatingAverage{}
+							}
+							return averages, nil
+						}, nil
+					},
+				},
+				"reviews": &graphql.Field{
+					Type:        graphql.NewNonNull(reviewConnection),
+					Description: "Reviews of this movie, newest first",
+					Args:        connectionArgs,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return pagedField(p, fromContext(p.Context).movieReviews, p.Source.(*models.MovieWithStats).ID, reviewID)
+					},
+				},
+			}
+		}),
+	})
+
+	reviewType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Review",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"movieId":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"userId":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"rating":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "1 to 5 stars"},
+				"title":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"content":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"updatedAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"subRatings": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(subRatingType))),
+					Description: "Optional ratings of aspects of the movie, in display order",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						load := fromContext(p.Context).reviewSubRatings.Load(p.Source.(*models.Review).ID)
+						return func() (interface{}, error) {
+							ratings, err := load()
+							if err != nil {
+								return nil, publicError(err)
+							}
+							return subRatingList(ratings), nil
+						}, nil
+					},
+				},
+				"movie": &graphql.Field{
+					Type: graphql.NewNonNull(movieType),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return required(fromContext(p.Context).movies.Load(p.Source.(*models.Review).MovieID)), nil
+					},
+				},
+				"user": &graphql.Field{
+					Type:        graphql.NewNonNull(userType),
+					Description: "The reviewer",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return required(fromContext(p.Context).users.Load(p.Source.(*models.Review).UserID)), nil
+					},
+				},
+			}
+		}),
+	})
+
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"username":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"role":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"email": &graphql.Field{
+					Type:        graphql.String,
+					Description: "Only visible to the user themselves and to admins",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						user := p.Source.(*models.User)
+						viewer := fromContext(p.Context).viewer
+						if viewer == nil || (viewer.ID != user.ID && viewer.Role != "admin") {
+							return nil, nil
+						}
+						return user.Email, nil
+					},
+				},
+				"reviews": &graphql.Field{
+					Type:        graphql.NewNonNull(reviewConnection),
+					Description: "Reviews written by this user, newest first",
+					Args:        connectionArgs,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return pagedField(p, fromContext(p.Context).userReviews, p.Source.(*models.User).ID, reviewID)
+					},
+				},
+			}
+		}),
+	})
+
+	tagType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Tag",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"movies": &graphql.Field{
+					Type:        graphql.NewNonNull(movieConnection),
+					Description: "Movies with this tag, newest first",
+					Args:        connectionArgs,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return pagedField(p, fromContext(p.Context).tagMovies, tagID(p.Source), movieID)
+					},
+				},
+			}
+		}),
+	})
+
+	movieConnection = connectionType(movieType)
+	reviewConnection = connectionType(reviewType)
+
+	idArg := graphql.FieldConfigArgument{
+		"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"movie": &graphql.Field{
+				Type: movieType,
+				Args: idArg,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return optional(fromContext(p.Context).movies.Load(p.Args["id"].(int))), nil
+				},
+			},
+			"movies": &graphql.Field{
+				Type:        graphql.NewNonNull(movieConnection),
+				Description: "Movies, newest first, optionally filtered by title or tag",
+				Args: graphql.FieldConfigArgument{
+					"query": &graphql.ArgumentConfig{Type: graphql.String},
+					"first": connectionArgs["first"],
+					"after": connectionArgs["after"],
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					limit, afterID, err := pageArgs(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					search, _ := p.Args["query"].(string)
+					movies, err := fromContext(p.Context).db.ListMoviesPage(p.Context, search, limit, afterID)
+					if err != nil {
+						return nil, publicError(err)
+					}
+					return newConnection(movies, limit, movieID), nil
+				},
+			},
+			"review": &graphql.Field{
+				Type: reviewType,
+				Args: idArg,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					review, err := fromContext(p.Context).db.GetReviewByID(p.Context, p.Args["id"].(int))
+					if errors.Is(err, database.ErrNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, publicError(err)
+					}
+					return review, nil
+				},
+			},
+			"reviews": &graphql.Field{
+				Type:        graphql.NewNonNull(reviewConnection),
+				Description: "Reviews across all movies, newest first",
+				Args:        connectionArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					limit, afterID, err := pageArgs(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					reviews, err := fromContext(p.Context).db.ListReviewsPage(p.Context, limit, afterID)
+					if err != nil {
+						return nil, publicError(err)
+					}
+					return newConnection(reviews, limit, reviewID), nil
+				},
+			},
+			"user": &graphql.Field{
+				Type: userType,
+				Args: idArg,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return optional(fromContext(p.Context).users.Load(p.Args["id"].(int))), nil
+				},
+			},
+			"viewer": &graphql.Field{
+				Type:        userType,
+				Description: "The signed-in user, or null",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if viewer := fromContext(p.Context).viewer; viewer != nil {
+						return viewer, nil
+					}
+					return nil, nil
+				},
+			},
+			"tag": &graphql.Field{
+				Type: tagType,
+				Args: idArg,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					tag, err := fromContext(p.Context).db.GetTagByID(p.Context, p.Args["id"].(int))
+					if errors.Is(err, database.ErrNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, publicError(err)
+					}
+					return tag, nil
+				},
+			},
+			"tags": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tagType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					tags, err := fromContext(p.Context).db.GetAllTags(p.Context)
+					if err != nil {
+						return nil, publicError(err)
+					}
+					return tags, nil
+				},
+			},
+		},
+	})
+
+	subRatingInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "SubRatingInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"dimension": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"rating":    &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	createReviewInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CreateReviewInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"movieId": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"rating":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"title":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"content": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"subRatings": &graphql.InputObjectFieldConfig{
+				Type:        graphql.NewList(graphql.NewNonNull(subRatingInput)),
+				Description: "Ratings of enabled aspects; a rating of 0 leaves the aspect unrated",
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createReview": &graphql.Field{
+				Type:        graphql.NewNonNull(reviewType),
+				Description: "Create a review as the signed-in user",
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createReviewInput)},
+				},
+				Resolve: createReview,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// Execute runs a request against schema. The caller must have attached WithRequest to ctx.
+func Execute(ctx context.Context, schema graphql.Schema, query, operationName string, variables map[string]interface{}) *graphql.Result {
+	result := graphql.Do(graphql.Params{
+		Schema:         schema,
+		RequestString:  query,
+		OperationName:  operationName,
+		VariableValues: variables,
+		Context:        ctx,
+	})
+
+	// Errors raised inside thunks lose their extensions on the way out of graphql-go; restore them
+	for i, formatted := range result.Errors {
+		if gqlErr := findError(formatted); gqlErr != nil {
+			result.Errors[i].Extensions = gqlErr.Extensions()
+			if gqlErr.cause != nil {
+				logging.FromContext(ctx).Error("GraphQL resolver error", "path", formatted.Path, "error", gqlErr.cause)
+			}
+		}
+	}
+	return result
+}
+
+func findError(err error) *Error {
+	for err != nil {
+		switch e := err.(type) {
+		case *Error:
+			return e
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			err = errors.Unwrap(err)
+		}
+	}
+	return nil
+}
+
+// Field names in validation errors, translated to the input names of the schema; sub-rating
+// errors are named after their dimension, as in subRatings.story
+var reviewInputFields = map[string]string{"movie_id": "movieId"}
+
+func createReview(p graphql.ResolveParams) (interface{}, error) {
+	req := fromContext(p.Context)
+	if req.viewer == nil {
+		return nil, &Error{Message: "Sign in to create a review", Code: CodeUnauthorized}
+	}
+
+	input := p.Args["input"].(map[string]interface{})
+	review := models.CreateReviewRequest{
+		MovieID: input["movieId"].(int),
+		Rating:  input["rating"].(int),
+		Title:   input["title"].(string),
+	}
+	review.Content, _ = input["content"].(string)
+	subRatings, _ := input["subRatings"].([]interface{})
+	for _, item := range subRatings {
+		sub := item.(map[string]interface{})
+		if review.SubRatings == nil {
+			review.SubRatings = map[string]int{}
+		}
+		review.SubRatings[sub["dimension"].(string)] = sub["rating"].(int)
+	}
+
+	dimensions, err := req.db.RatingDimensions(p.Context)
+	if err != nil {
+		return nil, publicError(err)
+	}
+
+	errs := validation.Review(&review)
+	errs = append(errs, validation.SubRatings(review.SubRatings, dimensions, nil)...)
+	if len(errs) > 0 {
+		for i := range errs {
+			if name, ok := reviewInputFields[errs[i].Field]; ok {
+				errs[i].Field = name
+			} else if dimension, ok := strings.CutPrefix(errs[i].Field, "sub_ratings."); ok {
+				errs[i].Field = "subRatings." + dimension
+			}
+		}
+		return nil, publicError(errs)
+	}
+
+	created, err := req.db.CreateReview(p.Context, review, req.viewer.ID)
+	if err != nil {
+		return nil, publicError(err)
+	}
+	return created, nil
+}
+
+// subRatingList lists sub-ratings in the display order of models.RatingDimensions
+func subRatingList(ratings map[string]int) []map[string]interface{} {
+	list := []map[string]interface{}{}
+	for _, d := range models.RatingDimensions {
+		if rating, ok := ratings[d]; ok {
+			list = append(list, map[string]interface{}{"dimension": d, "rating": rating})
+		}
+	}
+	return list
+}
+
+func movieField(t graphql.Output, get func(*models.MovieWithStats) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: t,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(*models.MovieWithStats)), nil
+		},
+	}
+}
+
+// pagedField resolves a connection field through a page loader
+func pagedField[V any](p graphql.ResolveParams, loader *Loader[pageKey, []V], parentID int, id func(*V) int) (interface{}, error) {
+	limit, afterID, err := pageArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	load := loader.Load(pageKey{ParentID: parentID, Limit: limit, AfterID: afterID})
+	// Returning a func defers the load so graphql-go can batch sibling fields
+	return func() (interface{}, error) {
+		rows, err := load()
+		if err != nil {
+			return nil, publicError(err)
+		}
+		return newConnection(rows, limit, id), nil
+	}, nil
+}
+
+// required resolves a loaded pointer, failing when the row is missing
+func required[V any](load func() (*V, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		v, err := load()
+		if err != nil {
+			return nil, publicError(err)
+		}
+		if v == nil {
+			return nil, &Error{Message: "The referenced resource does not exist", Code: CodeNotFound}
+		}
+		return v, nil
+	}
+}
+
+// optional resolves a loaded pointer, returning null when the row is missing
+func optional[V any](load func() (*V, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		v, err := load()
+		if err != nil {
+			return nil, publicError(err)
+		}
+		if v == nil {
+			return nil, nil
+		}
+		return v, nil
+	}
+}
+
+func movieID(m *models.MovieWithStats) int { return m.ID }
+func reviewID(r *models.Review) int        { return r.ID }
+
+func tagID(source interface{}) int {
+	switch t := source.(type) {
+	case *models.Tag:
+		return t.ID
+	case models.Tag:
+		return t.ID
+	}
+	return 0
+}
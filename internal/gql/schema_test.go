@@ -0,0 +1,170 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"cinerank/internal/database"
+	"cinerank/internal/database/memory"
+	"cinerank/internal/models"
+	"cinerank/internal/validation"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// execute runs query against an empty in-memory store
+func execute(t *testing.T, viewer *models.User, query string) map[string]interface{} {
+	t.Helper()
+	return executeOn(t, memory.New(), viewer, query)
+}
+
+func executeOn(t *testing.T, db database.Store, viewer *models.User, query string) map[string]interface{} {
+	t.Helper()
+	schema, err := NewSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := Execute(WithRequest(context.Background(), db, viewer), schema, query, "", nil)
+
+	out := map[string]interface{}{"data": result.Data}
+	if len(result.Errors) > 0 {
+		out["error"] = result.Errors[0]
+	}
+	return out
+}
+
+func TestViewer(t *testing.T) {
+	viewer := &models.User{ID: 7, Username: "ana", Email: "ana@example.com", Role: "user"}
+
+	out := execute(t, viewer, `{ viewer { id username email } }`)
+	got := out["data"].(map[string]interface{})["viewer"].(map[string]interface{})
+	if got["username"] != "ana" || got["email"] != "ana@example.com" || got["id"] != 7 {
+		t.Errorf("viewer = %v", got)
+	}
+
+	out = execute(t, nil, `{ viewer { id } }`)
+	if v := out["data"].(map[string]interface{})["viewer"]; v != nil {
+		t.Errorf("anonymous viewer = %v", v)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	viewer := &models.User{ID: 7, Username: "ana", Role: "user"}
+
+	tests := []struct {
+		name   string
+		viewer *models.User
+		query  string
+		code   string
+	}{
+		{"anonymous mutation", nil, `mutation { createReview(input: {movieId: 1, rating: 5, title: "Boa"}) { id } }`, CodeUnauthorized},
+		{"invalid review", viewer, `mutation { createReview(input: {movieId: 0, rating: 9, title: " "}) { id } }`, CodeValidationFailed},
+		{"invalid cursor", nil, `{ movies(after: "nope") { edges { cursor } } }`, CodeInvalidCursor},
+		{"page too large", nil, `{ reviews(first: 500) { edges { cursor } } }`, CodeValidationFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := execute(t, tt.viewer, tt.query)
+			err, ok := out["error"]
+			if !ok {
+				t.Fatalf("expected an error, got %v", out["data"])
+			}
+			ext := extensions(err)
+			if ext["code"] != tt.code {
+				t.Errorf("code = %v, want %s (%v)", ext["code"], tt.code, err)
+			}
+		})
+	}
+}
+
+func TestValidationErrorsUseInputFieldNames(t *testing.T) {
+	out := execute(t, &models.User{ID: 1}, `mutation { createReview(input: {movieId: 0, rating: 3, title: "Ok"}) { id } }`)
+	fields, _ := extensions(out["error"])["errors"].(validation.Errors)
+	if len(fields) != 1 || fields[0].Field != "movieId" {
+		t.Errorf("field errors = %v", fields)
+	}
+}
+
+func extensions(err interface{}) map[string]interface{} {
+	formatted, _ := err.(gqlerrors.FormattedError)
+	return formatted.Extensions
+}
+
+func TestMoviesResolveThroughLoaders(t *testing.T) {
+	store := memory.New()
+	user, err := store.CreateUser(t.Context(), models.RegisterRequest{Username: "ana", Email: "ana@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"Cidade de Deus", "Central do Brasil"} {
+		movie, err := store.CreateMovie(t.Context(), models.CreateMovieRequest{Title: title, Director: "Diretor", Year: 2000, Tags: []string{"Drama"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.CreateReview(t.Context(), models.CreateReviewRequest{MovieID: movie.ID, Rating: 4, Title: "Boa"}, user.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := executeOn(t, store, nil, `{
+		movies(first: 1) {
+			edges { node { title tags { name } reviews { edges { node { rating user { username } } } } } }
+			pageInfo { hasNextPage }
+		}
+	}`)
+	if e, ok := out["error"]; ok {
+		t.Fatal(e)
+	}
+
+	got, _ := json.Marshal(out["data"])
+	want := `{"movies":{"edges":[{"node":{"reviews":{"edges":[{"node":{"rating":4,"user":{"username":"ana"}}}]},` +
+		`"tags":[{"name":"Drama"}],"title":"Central do Brasil"}}],"pageInfo":{"hasNextPage":true}}}`
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestReviewSubRatings(t *testing.T) {
+	store := memory.New()
+	viewer, err := store.CreateUser(t.Context(), models.RegisterRequest{Username: "ana", Email: "ana@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateMovie(t.Context(), models.CreateMovieRequest{Title: "Cidade de Deus", Director: "Fernando Meirelles", Year: 2002}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := executeOn(t, store, viewer, `mutation {
+		createReview(input: {movieId: 1, rating: 5, title: "Boa", subRatings: [{dimension: "story", rating: 4}, {dimension: "acting", rating: 0}]}) {
+			subRatings { dimension rating }
+		}
+	}`)
+	if e, ok := out["error"]; ok {
+		t.Fatal(e)
+	}
+	if review, _ := store.GetReviewByID(t.Context(), 1); len(review.SubRatings) != 1 || review.SubRatings["story"] != 4 {
+		t.Errorf("stored sub-ratings = %v", review.SubRatings)
+	}
+
+	out = executeOn(t, store, nil, `{
+		review(id: 1) { subRatings { dimension rating } }
+		movie(id: 1) { subRatingAverages { dimension reviewCount averageRating } }
+	}`)
+	if e, ok := out["error"]; ok {
+		t.Fatal(e)
+	}
+	got, _ := json.Marshal(out["data"])
+	want := `{"movie":{"subRatingAverages":[{"averageRating":4,"dimension":"story","reviewCount":1}]},` +
+		`"review":{"subRatings":[{"dimension":"story","rating":4}]}}`
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	out = executeOn(t, store, viewer, `mutation { createReview(input: {movieId: 1, rating: 3, title: "Ok", subRatings: [{dimension: "plot", rating: 3}]}) { id } }`)
+	fields, _ := extensions(out["error"])["errors"].(validation.Errors)
+	if len(fields) != 1 || fields[0].Field != "subRatings.plot" {
+		t.Errorf("field errors = %v", fields)
+	}
+}
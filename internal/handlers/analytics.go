@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cinerank/internal/database"
+	"cinerank/internal/logging"
+	"cinerank/internal/models"
+	"cinerank/internal/ui"
+)
+
+const (
+	// analyticsTop is how many reviewers, movies and tags each ranking lists
+	analyticsTop = 10
+	// minRankedReviews keeps movies with a review or two out of the best and worst rated
+	minRankedReviews = 3
+	analyticsMonths  = 12
+)
+
+// activityPeriods is how many days or weeks the activity chart covers
+var activityPeriods = map[string]int{models.PeriodDay: 30, models.PeriodWeek: 12}
+
+// analyticsLoader fills one part of the dashboard for the period ending now
+type analyticsLoader func(h *Handler, ctx context.Context, a *models.Analytics, now time.Time) error
+
+// analytics gathers the dashboard for the period ending now; callers check period first
+func (h *Handler) analytics(ctx context.Context, period string, now time.Time) (*models.Analytics, error) {
+	a := &models.Analytics{Period: period}
+	loaders := []analyticsLoader{
+		(*Handler).loadActivity, (*Handler).loadRatingTrend, (*Handler).loadTopReviewers,
+		(*Handler).loadMostReviewed, (*Handler).loadHighestRated, (*Handler).loadLowestRated, (*Handler).loadTags,
+	}
+	for _, load := range loaders {
+		if err := load(h, ctx, a, now); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Periods and months without activity are missing from the queries and show up as zero
+func (h *Handler) loadActivity(ctx context.Context, a *models.Analytics, now time.Time) error {
+	current := database.TruncateToPeriod(now, a.Period)
+	first := current.AddDate(0, 0, -(activityPeriods[a.Period]-1)*periodDays(a.Period))
+	activity, err := h.DB.GetActivity(ctx, a.Period, first)
+	if err != nil {
+		return err
+	}
+	byStart := make(map[time.Time]models.ActivityCount, len(activity))
+	for _, c := range activity {
+		byStart[c.Start] = c
+	}
+	for start := first; !start.After(current); start = start.AddDate(0, 0, periodDays(a.Period)) {
+		a.Activity = append(a.Activity, models.ActivityCount{Start: start, NewUsers: byStart[start].NewUsers, Reviews: byStart[start].Reviews})
+	}
+	return nil
+}
+
+func (h *Handler) loadRatingTrend(ctx context.Context, a *models.Analytics, now time.Time) error {
+	now = now.UTC()
+	firstMonth := time.Date(now.Year(), now.Month()-analyticsMonths+1, 1, 0, 0, 0, 0, time.UTC)
+	trend, err := h.DB.GetRatingTrend(ctx, firstMonth)
+	if err != nil {
+		return err
+	}
+	byMonth := make(map[time.Time]models.RatingTrend, len(trend))
+	for _, t := range trend {
+		byMonth[t.Month] = t
+	}
+	for i := 0; i < analyticsMonths; i++ {
+		month := firstMonth.AddDate(0, i, 0)
+		t := byMonth[month]
+		t.Month = month
+		a.RatingTrend = append(a.RatingTrend, t)
+	}
+	return nil
+}
+
+func (h *Handler) loadTopReviewers(ctx context.Context, a *models.Analytics, _ time.Time) (err error) {
+	a.TopReviewers, err = h.DB.GetTopReviewers(ctx, analyticsTop)
+	return err
+}
+
+func (h *Handler) loadMostReviewed(ctx context.Context, a *models.Analytics, _ time.Time) (err error) {
+	a.MostReviewed, err = h.DB.GetRankedMovies(ctx, models.RankMostReviewed, 1, analyticsTop)
+	return err
+}
+
+func (h *Handler) loadHighestRated(ctx context.Context, a *models.Analytics, _ time.Time) (err error) {
+	a.HighestRated, err = h.DB.GetRankedMovies(ctx, models.RankHighestRated, minRankedReviews, analyticsTop)
+	return err
+}
+
+func (h *Handler) loadLowestRated(ctx context.Context, a *models.Analytics, _ time.Time) (err error) {
+	a.LowestRated, err = h.DB.GetRankedMovies(ctx, models.RankLowestRated, minRankedReviews, analyticsTop)
+	return err
+}
+
+func (h *Handler) loadTags(ctx context.Context, a *models.Analytics, _ time.Time) (err error) {
+	a.Tags, err = h.DB.GetTagPopularity(ctx, analyticsTop)
+	return err
+}
+
+func periodDays(period string) int {
+	if period == models.PeriodWeek {
+		return 7
+	}
+	return 1
+}
+
+// analyticsPeriod reads the period query parameter, a day unless told otherwise
+func analyticsPeriod(r *http.Request) (string, bool) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = models.PeriodDay
+	}
+	_, ok := activityPeriods[period]
+	return period, ok
+}
+
+// Site analytics dashboard (admin)
+func (h *Handler) AdminAnalytics(w http.ResponseWriter, r *http.Request) {
+	period, ok := analyticsPeriod(r)
+	if !ok {
+		httpError(w, r, "Invalid period", http.StatusBadRequest)
+		return
+	}
+
+	a, err := h.analytics(r.Context(), period, time.Now())
+	if err != nil {
+		dbError(w, r, "Error fetching analytics", err)
+		return
+	}
+
+	if err := render(r.Context(), w, "AdminAnalytics", ui.AdminAnalytics(a, currentUser(r))); err != nil {
+		httpError(w, r, "Error rendering analytics", http.StatusInternalServerError)
+	}
+}
+
+// analyticsSection is a part of the dashboard that can be exported: the loader that queries it
+// and how it turns into CSV records, header first
+type analyticsSection struct {
+	load    analyticsLoader
+	records func(a *models.Analytics) [][]string
+}
+
+var analyticsSections = map[string]analyticsSection{
+	"activity": {(*Handler).loadActivity, func(a *models.Analytics) [][]string {
+		records := [][]string{{a.Period, "new_users", "reviews"}}
+		for _, c := range a.Activity {
+			records = append(records, []string{c.Start.Format(time.DateOnly), strconv.Itoa(c.NewUsers), strconv.Itoa(c.Reviews)})
+		}
+		return records
+	}},
+	"reviewers": {(*Handler).loadTopReviewers, func(a *models.Analytics) [][]string {
+		records := [][]string{{"user_id", "username", "review_count", "average_rating", "last_reviewed_at"}}
+		for _, rs := range a.TopReviewers {
+			records = append(records, []string{
+				strconv.Itoa(rs.UserID), csvText(rs.Username), strconv.Itoa(rs.ReviewCount),
+				formatRating(rs.AverageRating), rs.LastReviewedAt.UTC().Format(time.RFC3339),
+			})
+		}
+		return records
+	}},
+	"most-reviewed": {(*Handler).loadMostReviewed, func(a *models.Analytics) [][]string { return movieRecords(a.MostReviewed) }},
+	"highest-rated": {(*Handler).loadHighestRated, func(a *models.Analytics) [][]string { return movieRecords(a.HighestRated) }},
+	"lowest-rated":  {(*Handler).loadLowestRated, func(a *models.Analytics) [][]string { return movieRecords(a.LowestRated) }},
+	"tags": {(*Handler).loadTags, func(a *models.Analytics) [][]string {
+		records := [][]string{{"tag_id", "name", "movie_count", "review_count", "average_rating"}}
+		for _, ts := range a.Tags {
+			records = append(records, []string{
+				strconv.Itoa(ts.TagID), csvText(ts.Name), strconv.Itoa(ts.MovieCount),
+				strconv.Itoa(ts.ReviewCount), formatRating(ts.AverageRating),
+			})
+		}
+		return records
+	}},
+	"ratings": {(*Handler).loadRatingTrend, func(a *models.Analytics) [][]string {
+		records := [][]string{{"month", "review_count", "average_rating", "five_star_count"}}
+		for _, t := range a.RatingTrend {
+			records = append(records, []string{
+				t.Month.Format("2006-01"), strconv.Itoa(t.ReviewCount),
+				formatRating(t.AverageRating), strconv.Itoa(t.FiveStarCount),
+			})
+		}
+		return records
+	}},
+}
+
+func movieRecords(movies []models.MovieWithStats) [][]string {
+	records := [][]string{{"movie_id", "title", "year", "review_count", "average_rating"}}
+	for _, m := range movies {
+		records = append(records, []string{
+			strconv.Itoa(m.ID), csvText(m.Title), strconv.Itoa(m.Year),
+			strconv.Itoa(m.ReviewCount), formatRating(m.AverageRating),
+		})
+	}
+	return records
+}
+
+// csvText keeps user-written text from running as a formula when the export is opened in a spreadsheet
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func formatRating(rating float64) string {
+	return strconv.FormatFloat(rating, 'f', 2, 64)
+}
+
+// Download one part of the analytics dashboard as CSV (admin)
+func (h *Handler) ExportAnalytics(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("section")
+	section, ok := analyticsSections[name]
+	if !ok {
+		httpError(w, r, "Unknown analytics section", http.StatusNotFound)
+		return
+	}
+	period, ok := analyticsPeriod(r)
+	if !ok {
+		httpError(w, r, "Invalid period", http.StatusBadRequest)
+		return
+	}
+
+	// Only the query behind this section runs
+	now := time.Now()
+	a := &models.Analytics{Period: period}
+	if err := section.load(h, r.Context(), a, now); err != nil {
+		dbError(w, r, "Error fetching analytics", err)
+		return
+	}
+
+	filename := fmt.Sprintf("cinerank-%s-%s.csv", name, now.UTC().Format(time.DateOnly))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(section.records(a)); err != nil {
+		// The response has started, so the client just gets a short download
+		logging.FromContext(r.Context()).Warn("Error writing analytics CSV", "error", err)
+	}
+}
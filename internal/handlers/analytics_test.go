@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cinerank/internal/database"
+	"cinerank/internal/models"
+)
+
+// analyticsFixture has three movies: one loved, one disliked, both tagged Drama, and one with a
+// single review. The third reviewer's name looks like a spreadsheet formula.
+func analyticsFixture(t *testing.T) *fixture {
+	f := newFixture(t)
+	loved := f.createMovie(t, "Cidade de Deus", "Drama")
+	disliked := f.createMovie(t, "Tropa de Elite 3", "Drama", "Crime")
+	once := f.createMovie(t, "Central do Brasil")
+	critic := f.createUser(t, "=HYPERLINK(1)", "critica@example.com", "user", "critic-session")
+
+	for _, r := range []struct{ movieID, userID, rating int }{
+		{loved.ID, f.user.ID, 5}, {loved.ID, f.admin.ID, 5}, {loved.ID, critic.ID, 4},
+		{disliked.ID, f.user.ID, 1}, {disliked.ID, f.admin.ID, 2}, {disliked.ID, critic.ID, 2},
+		{once.ID, f.user.ID, 3},
+	} {
+		f.createReview(t, r.movieID, r.userID, r.rating, "ok")
+	}
+	return f
+}
+
+// exportCSV downloads one dashboard section as an admin
+func exportCSV(t *testing.T, f *fixture, section, query string) [][]string {
+	t.Helper()
+	rec := f.serve(withSession(httptest.NewRequest(http.MethodGet, "/admin/analytics/export/"+section+query, nil), adminSession))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("%s: status = %d, Content-Type = %q", section, rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Disposition"), `attachment; filename="cinerank-`+section+`-`) {
+		t.Errorf("%s: Content-Disposition = %q", section, rec.Header().Get("Content-Disposition"))
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestAdminAnalyticsDashboard(t *testing.T) {
+	f := analyticsFixture(t)
+
+	for _, period := range []string{"", "?period=week"} {
+		rec := f.serve(withSession(httptest.NewRequest(http.MethodGet, "/admin/analytics"+period, nil), adminSession))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: status = %d", period, rec.Code)
+		}
+		for _, want := range []string{"Avaliadores mais ativos", "Cidade de Deus", "Tropa de Elite 3", "Drama", "Exportar CSV"} {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("%q: dashboard missing %q", period, want)
+			}
+		}
+	}
+
+	if rec := f.serve(withSession(httptest.NewRequest(http.MethodGet, "/admin/analytics?period=month", nil), adminSession)); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown period: status = %d", rec.Code)
+	}
+	if rec := f.serve(withSession(httptest.NewRequest(http.MethodGet, "/admin/analytics", nil), userSession)); rec.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d", rec.Code)
+	}
+}
+
+func TestExportAnalyticsSections(t *testing.T) {
+	f := analyticsFixture(t)
+
+	tests := []struct {
+		section string
+		want    [][]string
+	}{
+		{"reviewers", [][]string{
+			{"user_id", "username", "review_count", "average_rating"},
+			{"2", "MovieBuff", "3", "3.00"},
+			{"1", "Admin", "2", "3.50"},
+			{"3", "'=HYPERLINK(1)", "2", "3.00"},
+		}},
+		{"most-reviewed", [][]string{
+			{"movie_id", "title", "year", "review_count", "average_rating"},
+			{"2", "Tropa de Elite 3", "2002", "3", "1.67"},
+			{"1", "Cidade de Deus", "2002", "3", "4.67"},
+			{"3", "Central do Brasil", "2002", "1", "3.00"},
+		}},
+		// Central do Brasil has too few reviews to be ranked by rating
+		{"highest-rated", [][]string{
+			{"movie_id", "title", "year", "review_count", "average_rating"},
+			{"1", "Cidade de Deus", "2002", "3", "4.67"},
+			{"2", "Tropa de Elite 3", "2002", "3", "1.67"},
+		}},
+		{"lowest-rated", [][]string{
+			{"movie_id", "title", "year", "review_count", "average_rating"},
+			{"2", "Tropa de Elite 3", "2002", "3", "1.67"},
+			{"1", "Cidade de Deus", "2002", "3", "4.67"},
+		}},
+		{"tags", [][]string{
+			{"tag_id", "name", "movie_count", "review_count", "average_rating"},
+			{"1", "Drama", "2", "6", "3.17"},
+			{"2", "Crime", "1", "3", "1.67"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.section, func(t *testing.T) {
+			got := exportCSV(t, f, tt.section, "")
+			if len(got) != len(tt.want) {
+				t.Fatalf("records = %q", got)
+			}
+			for i, want := range tt.want {
+				// Compare the leading columns; timestamps vary between runs
+				if strings.Join(got[i][:len(want)], ",") != strings.Join(want, ",") {
+					t.Errorf("record %d = %q, want %q", i, got[i], want)
+				}
+			}
+		})
+	}
+
+	// Everything happened today and this month, which come last
+	activity := exportCSV(t, f, "activity", "")
+	if len(activity) != 31 || strings.Join(activity[30][1:], ",") != "3,7" || activity[1][1] != "0" {
+		t.Errorf("activity = %q", activity)
+	}
+	if weeks := exportCSV(t, f, "activity", "?period=week"); len(weeks) != 13 || weeks[0][0] != "week" {
+		t.Errorf("weekly activity = %q", weeks)
+	}
+	ratings := exportCSV(t, f, "ratings", "")
+	if len(ratings) != 13 || strings.Join(ratings[12][1:], ",") != "7,3.14,2" {
+		t.Errorf("ratings = %q", ratings)
+	}
+
+	if rec := f.serve(withSession(httptest.NewRequest(http.MethodGet, "/admin/analytics/export/passwords", nil), adminSession)); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown section: status = %d", rec.Code)
+	}
+}
+
+// analyticsQueries records which analytics queries reach the store
+type analyticsQueries struct {
+	database.Store
+	queries []string
+}
+
+func (s *analyticsQueries) GetActivity(ctx context.Context, period string, since time.Time) ([]models.ActivityCount, error) {
+	s.queries = append(s.queries, "activity")
+	return s.Store.GetActivity(ctx, period, since)
+}
+
+func (s *analyticsQueries) GetTopReviewers(ctx context.Context, limit int) ([]models.ReviewerStats, error) {
+	s.queries = append(s.queries, "reviewers")
+	return s.Store.GetTopReviewers(ctx, limit)
+}
+
+func (s *analyticsQueries) GetRankedMovies(ctx context.Context, ranking string, minReviews, limit int) ([]models.MovieWithStats, error) {
+	s.queries = append(s.queries, ranking)
+	return s.Store.GetRankedMovies(ctx, ranking, minReviews, limit)
+}
+
+func (s *analyticsQueries) GetTagPopularity(ctx context.Context, limit int) ([]models.TagStats, error) {
+	s.queries = append(s.queries, "tags")
+	return s.Store.GetTagPopularity(ctx, limit)
+}
+
+func (s *analyticsQueries) GetRatingTrend(ctx context.Context, since time.Time) ([]models.RatingTrend, error) {
+	s.queries = append(s.queries, "ratings")
+	return s.Store.GetRatingTrend(ctx, since)
+}
+
+func TestExportAnalyticsRunsOnlyTheSectionsQuery(t *testing.T) {
+	f := analyticsFixture(t)
+	store := &analyticsQueries{Store: f.store}
+	f.h.DB = store
+
+	for section, want := range map[string]string{
+		"activity":      "activity",
+		"reviewers":     "reviewers",
+		"most-reviewed": models.RankMostReviewed,
+		"highest-rated": models.RankHighestRated,
+		"lowest-rated":  models.RankLowestRated,
+		"tags":          "tags",
+		"ratings":       "ratings",
+	} {
+		store.queries = nil
+		exportCSV(t, f, section, "")
+		if len(store.queries) != 1 || store.queries[0] != want {
+			t.Errorf("%s export ran %q", section, store.queries)
+		}
+	}
+}
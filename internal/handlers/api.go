@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Deprecated marks a legacy /api route, pointing clients at its /api/v1 successor
+func Deprecated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		successor := "/api/v1" + strings.TrimPrefix(r.URL.Path, "/api")
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+		next(w, r)
+	}
+}
+
+// Helper to write a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Helper to decode a JSON body, writing a 400 problem on failure
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}, what string) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidJSON, "Request body must be a valid JSON "+what+" object")
+		return false
+	}
+	return true
+}
+
+// Helper to parse an integer path wildcard, writing a 400 problem on failure
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Path parameter "+name+" must be an integer")
+		return 0, false
+	}
+	return id, true
+}
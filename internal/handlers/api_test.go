@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func withSession(req *http.Request, sessionID string) *http.Request {
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: sessionID})
+	return req
+}
+
+func TestAPIV1ErrorResponsesConformToSpec(t *testing.T) {
+	doc := loadSpec(t)
+	f := newFixture(t)
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{
+			name:   "get movie invalid id",
+			req:    httptest.NewRequest(http.MethodGet, "/api/v1/movies/abc", nil),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "create movie unauthenticated",
+			req:    httptest.NewRequest(http.MethodPost, "/api/v1/movies", strings.NewReader(`{"title":"x"}`)),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "replace movie invalid id",
+			req:    withSession(httptest.NewRequest(http.MethodPut, "/api/v1/movies/x", nil), adminSession),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "patch movie unauthenticated",
+			req:    httptest.NewRequest(http.MethodPatch, "/api/v1/movies/1", strings.NewReader(`{}`)),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "delete movie unauthenticated",
+			req:    httptest.NewRequest(http.MethodDelete, "/api/v1/movies/1", nil),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "movie reviews invalid id",
+			req:    httptest.NewRequest(http.MethodGet, "/api/v1/movies/abc/reviews", nil),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "reviews invalid movie id",
+			req:    httptest.NewRequest(http.MethodGet, "/api/v1/reviews?movie_id=x", nil),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "reviews limit out of range",
+			req:    httptest.NewRequest(http.MethodGet, "/api/v1/reviews?limit=500", nil),
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "create review unauthenticated",
+			req:    httptest.NewRequest(http.MethodPost, "/api/v1/reviews", strings.NewReader(`{"movie_id":1}`)),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "update review unauthenticated",
+			req:    httptest.NewRequest(http.MethodPatch, "/api/v1/reviews/3", nil),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "delete review invalid id",
+			req:    withSession(httptest.NewRequest(http.MethodDelete, "/api/v1/reviews/-", nil), userSession),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "create tag unauthenticated",
+			req:    httptest.NewRequest(http.MethodPost, "/api/v1/tags", strings.NewReader(`{"name":"Noir"}`)),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "get tag invalid id",
+			req:    httptest.NewRequest(http.MethodGet, "/api/v1/tags/noir", nil),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "list users unauthenticated",
+			req:    httptest.NewRequest(http.MethodGet, "/api/v1/users", nil),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "get user with expired session",
+			req:    withSession(httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil), "unknown"),
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "delete user unauthenticated",
+			req:    httptest.NewRequest(http.MethodDelete, "/api/v1/users/1", nil),
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := f.serve(tt.req)
+			assertConforms(t, doc, tt.req.Method, tt.req, rec, tt.status)
+		})
+	}
+}
+
+func TestRouterAnswersAPIMethodsWithProblems(t *testing.T) {
+	doc := loadSpec(t)
+	f := newFixture(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tags/1", nil)
+	rec := f.serve(req)
+	if allow := rec.Header().Get("Allow"); allow != "DELETE, GET, HEAD, PATCH, PUT" {
+		t.Errorf("Allow = %q", allow)
+	}
+	assertConforms(t, doc, http.MethodGet, req, rec, http.StatusMethodNotAllowed)
+
+	rec = f.serve(httptest.NewRequest(http.MethodGet, "/api/v1/directors", nil))
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != problemContentType {
+		t.Errorf("unknown API path: status = %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	// Pages keep the mux's own answers
+	rec = f.serve(httptest.NewRequest(http.MethodGet, "/admin/delete-movie/1", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Content-Type") == problemContentType {
+		t.Errorf("page with wrong method: status = %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rec = f.serve(httptest.NewRequest(http.MethodGet, "/filmes", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown page: status = %d", rec.Code)
+	}
+}
+
+func TestRoutesDemandTheirAccess(t *testing.T) {
+	f := newFixture(t)
+
+	tests := []struct {
+		name     string
+		req      *http.Request
+		status   int
+		location string
+	}{
+		{"page signed out", httptest.NewRequest(http.MethodGet, "/add-movie", nil), http.StatusSeeOther, "/login"},
+		{"page signed in", withSession(httptest.NewRequest(http.MethodGet, "/add-movie", nil), userSession), http.StatusOK, ""},
+		{"admin page as user", withSession(httptest.NewRequest(http.MethodGet, "/admin", nil), userSession), http.StatusForbidden, ""},
+		{"admin page as admin", withSession(httptest.NewRequest(http.MethodGet, "/admin", nil), adminSession), http.StatusOK, ""},
+		{"API signed out", httptest.NewRequest(http.MethodPost, "/api/v1/reviews", nil), http.StatusUnauthorized, ""},
+		{"admin API as user", withSession(httptest.NewRequest(http.MethodGet, "/api/v1/users", nil), userSession), http.StatusForbidden, ""},
+		{"other user as user", withSession(httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil), userSession), http.StatusForbidden, ""},
+		{"other user as admin", withSession(httptest.NewRequest(http.MethodGet, "/api/v1/users/2", nil), adminSession), http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := f.serve(tt.req)
+			if rec.Code != tt.status || rec.Header().Get("Location") != tt.location {
+				t.Errorf("status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestDeprecatedPointsToSuccessor(t *testing.T) {
+	tests := []struct {
+		path      string
+		successor string
+	}{
+		{"/api/movies", "</api/v1/movies>; rel=\"successor-version\""},
+		{"/api/movies/7", "</api/v1/movies/7>; rel=\"successor-version\""},
+		{"/api/reviews", "</api/v1/reviews>; rel=\"successor-version\""},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		Deprecated(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})(rec, httptest.NewRequest(http.MethodGet, tt.path+"?query=x", nil))
+
+		if rec.Code != http.StatusTeapot {
+			t.Errorf("%s: wrapped handler not called", tt.path)
+		}
+		if got := rec.Header().Get("Deprecation"); got != "true" {
+			t.Errorf("%s: Deprecation = %q", tt.path, got)
+		}
+		if got := rec.Header().Get("Link"); got != tt.successor {
+			t.Errorf("%s: Link = %q, want %q", tt.path, got, tt.successor)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"cinerank/internal/logging"
+	"cinerank/internal/openapi"
+	"cinerank/internal/ui"
+)
+
+// OpenAPI document
+func (h *Handler) APIOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	openapi.ServeSpec(w, r)
+}
+
+// API documentation page rendered from the OpenAPI document
+func (h *Handler) APIDocs(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	doc, err := openapi.Load()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error loading OpenAPI document", "error", err)
+		httpError(w, r, "Error loading API docs", http.StatusInternalServerError)
+		return
+	}
+
+	if err := render(r.Context(), w, "APIDocs", ui.APIDocs(doc.Info, doc.Operations(), doc.Schemas(), user)); err != nil {
+		httpError(w, r, "Error rendering page", http.StatusInternalServerError)
+	}
+}
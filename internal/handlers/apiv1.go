@@ -0,0 +1,506 @@
+package handlers
+
+import (
+	"maps"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cinerank/internal/models"
+	"cinerank/internal/validation"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultReviewLimit = 10
+	maxReviewLimit     = 100
+)
+
+// Movies
+
+func (h *Handler) APIV1ListMovies(w http.ResponseWriter, r *http.Request) {
+	movies, err := h.DB.GetAllMoviesWithStats(r.Context(), r.URL.Query().Get("query"))
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, movies)
+}
+
+func (h *Handler) APIV1GetMovie(w http.ResponseWriter, r *http.Request) {
+	movieID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	movie, err := h.DB.GetMovieByID(r.Context(), movieID)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, movie)
+}
+
+func (h *Handler) APIV1CreateMovie(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateMovieRequest
+	if !decodeJSON(w, r, &req, "movie") {
+		return
+	}
+	if errs := validation.Movie(&req); len(errs) > 0 {
+		writeAPIError(w, r, errs)
+		return
+	}
+
+	movie, err := h.DB.CreateMovie(r.Context(), req)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, movie)
+}
+
+// Replace (PUT) or partially update (PATCH) a movie (admin); PATCH keeps fields missing from the body
+func (h *Handler) APIV1UpdateMovie(w http.ResponseWriter, r *http.Request) {
+	movieID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req models.CreateMovieRequest
+	if r.Method == http.MethodPatch {
+		movie, err := h.DB.GetMovieByID(r.Context(), movieID)
+		if err != nil {
+			writeAPIError(w, r, err)
+			return
+		}
+		req = models.CreateMovieRequest{
+			Title:      movie.Title,
+			Director:   movie.Director,
+			Year:       movie.Year,
+			Tags:       movie.Tags,
+			Plot:       movie.Plot,
+			PosterURL:  movie.PosterURL,
+			IMDBRating: movie.IMDBRating,
+		}
+	}
+	if !decodeJSON(w, r, &req, "movie") {
+		return
+	}
+	if errs := validation.Movie(&req); len(errs) > 0 {
+		writeAPIError(w, r, errs)
+		return
+	}
+
+	movie, err := h.DB.UpdateMovie(r.Context(), movieID, req)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, movie)
+}
+
+func (h *Handler) APIV1DeleteMovie(w http.ResponseWriter, r *http.Request) {
+	movieID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.DB.DeleteMovie(r.Context(), movieID); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) APIV1ListMovieReviews(w http.ResponseWriter, r *http.Request) {
+	movieID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if _, err := h.DB.GetMovieByID(r.Context(), movieID); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+
+	reviews, err := h.DB.GetReviewsByMovieID(r.Context(), movieID)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reviews)
+}
+
+// Rating distribution, median, spread and monthly reviews of a movie
+func (h *Handler) APIV1GetMovieStats(w http.ResponseWriter, r *http.Request) {
+	movieID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	movie, err := h.DB.GetMovieByID(r.Context(), movieID)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+
+	report, err := h.movieStatsReport(r.Context(), movie, time.Now())
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// Reviews
+
+// List reviews of one movie, or the most recent reviews across all movies
+func (h *Handler) APIV1ListReviews(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if movieIDStr := query.Get("movie_id"); movieIDStr != "" {
+		movieID, err := strconv.Atoi(movieIDStr)
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "movie_id must be an integer")
+			return
+		}
+		reviews, err := h.DB.GetReviewsByMovieID(r.Context(), movieID)
+		if err != nil {
+			writeAPIError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, reviews)
+		return
+	}
+
+	limit := defaultReviewLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 || n > maxReviewLimit {
+			var errs validation.Errors
+			errs.Add("limit", validation.CodeRange, "must be between 1 and "+strconv.Itoa(maxReviewLimit))
+			writeAPIError(w, r, errs)
+			return
+		}
+		limit = n
+	}
+
+	reviews, err := h.DB.GetRecentReviews(r.Context(), limit)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reviews)
+}
+
+func (h *Handler) APIV1GetReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	review, err := h.DB.GetReviewByID(r.Context(), reviewID)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, review)
+}
+
+// Create a review as the signed-in user
+func (h *Handler) APIV1CreateReview(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	var req models.CreateReviewRequest
+	if !decodeJSON(w, r, &req, "review") {
+		return
+	}
+	dimensions, err := h.DB.RatingDimensions(r.Context())
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	errs := validation.Review(&req)
+	errs = append(errs, validation.SubRatings(req.SubRatings, dimensions, nil)...)
+	if len(errs) > 0 {
+		writeAPIError(w, r, errs)
+		return
+	}
+
+	review, err := h.DB.CreateReview(r.Context(), req, user.ID)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, review)
+}
+
+// Replace (PUT) or partially update (PATCH) a review; only its author or an admin may do so
+func (h *Handler) APIV1UpdateReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	user := currentUser(r)
+
+	review, err := h.DB.GetReviewByID(r.Context(), reviewID)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if !canModifyReview(user, review) {
+		writeProblem(w, r, http.StatusForbidden, CodeForbidden, "Only the author or an admin can change this review")
+		return
+	}
+
+	// PATCH merges the sub-ratings it sends into the review's; 0 clears one
+	var req models.CreateReviewRequest
+	if r.Method == http.MethodPatch {
+		req = models.CreateReviewRequest{Rating: review.Rating, Title: review.Title, Content: review.Content, SubRatings: maps.Clone(review.SubRatings)}
+	}
+	if !decodeJSON(w, r, &req, "review") {
+		return
+	}
+	dimensions, err := h.DB.RatingDimensions(r.Context())
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	// A review cannot be moved to another movie
+	req.MovieID = review.MovieID
+	errs := validation.Review(&req)
+	errs = append(errs, validation.SubRatings(req.SubRatings, dimensions, review.SubRatings)...)
+	if len(errs) > 0 {
+		writeAPIError(w, r, errs)
+		return
+	}
+
+	updated, err := h.DB.UpdateReview(r.Context(), reviewID, req)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) APIV1DeleteReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	user := currentUser(r)
+
+	review, err := h.DB.GetReviewByID(r.Context(), reviewID)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	if !canModifyReview(user, review) {
+		writeProblem(w, r, http.StatusForbidden, CodeForbidden, "Only the author or an admin can delete this review")
+		return
+	}
+
+	if err := h.DB.DeleteReview(r.Context(), reviewID); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func canModifyReview(user *models.User, review *models.Review) bool {
+	return user.ID == review.UserID || user.Role == "admin"
+}
+
+// Tags
+
+func (h *Handler) APIV1ListTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.DB.GetAllTags(r.Context())
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+func (h *Handler) APIV1GetTag(w http.ResponseWriter, r *http.Request) {
+	tagID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	tag, err := h.DB.GetTagByID(r.Context(), tagID)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tag)
+}
+
+func (h *Handler) APIV1CreateTag(w http.ResponseWriter, r *http.Request) {
+	var req models.TagRequest
+	if !decodeJSON(w, r, &req, "tag") {
+		return
+	}
+	if errs := validation.Tag(&req); len(errs) > 0 {
+		writeAPIError(w, r, errs)
+		return
+	}
+
+	tag, err := h.DB.CreateTag(r.Context(), req.Name)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, tag)
+}
+
+// Rename a tag (admin); PUT and PATCH behave the same since name is the only field
+func (h *Handler) APIV1UpdateTag(w http.ResponseWriter, r *http.Request) {
+	tagID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var req models.TagRequest
+	if !decodeJSON(w, r, &req, "tag") {
+		return
+	}
+	if errs := validation.Tag(&req); len(errs) > 0 {
+		writeAPIError(w, r, errs)
+		return
+	}
+
+	tag, err := h.DB.UpdateTag(r.Context(), tagID, req.Name)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tag)
+}
+
+func (h *Handler) APIV1DeleteTag(w http.ResponseWriter, r *http.Request) {
+	tagID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.DB.DeleteTag(r.Context(), tagID); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Users
+
+func (h *Handler) APIV1ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.DB.GetAllUsers(r.Context())
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+// Get a user; admins can read anyone, other users only themselves
+func (h *Handler) APIV1GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	current := currentUser(r)
+	if current.ID == userID {
+		writeJSON(w, http.StatusOK, current)
+		return
+	}
+	if !h.authorize(w, r, current, Admin) {
+		return
+	}
+
+	user, err := h.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (h *Handler) APIV1CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateUserRequest
+	if !decodeJSON(w, r, &req, "user") {
+		return
+	}
+	if errs := validation.NewUser(&req); len(errs) > 0 {
+		writeAPIError(w, r, errs)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+
+	user, err := h.DB.CreateUserWithRole(r.Context(), models.RegisterRequest{
+		Username: req.Username,
+		Email:    req.Email,
+		Password: string(hashedPassword),
+	}, req.Role)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, user)
+}
+
+// Replace (PUT) or partially update (PATCH) a user's profile and role (admin)
+func (h *Handler) APIV1UpdateUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	admin := currentUser(r)
+
+	var req models.UpdateUserRequest
+	if r.Method == http.MethodPatch {
+		user, err := h.DB.GetUserByID(r.Context(), userID)
+		if err != nil {
+			writeAPIError(w, r, err)
+			return
+		}
+		req = models.UpdateUserRequest{Username: user.Username, Email: user.Email, Role: user.Role}
+	}
+	if !decodeJSON(w, r, &req, "user") {
+		return
+	}
+	if errs := validation.User(&req); len(errs) > 0 {
+		writeAPIError(w, r, errs)
+		return
+	}
+	if userID == admin.ID && req.Role != validation.RoleAdmin {
+		writeProblem(w, r, http.StatusForbidden, CodeForbidden, "You cannot remove your own admin role")
+		return
+	}
+
+	user, err := h.DB.UpdateUser(r.Context(), userID, req)
+	if err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (h *Handler) APIV1DeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	admin := currentUser(r)
+	if userID == admin.ID {
+		writeProblem(w, r, http.StatusForbidden, CodeForbidden, "You cannot delete yourself")
+		return
+	}
+
+	if err := h.DB.DeleteUser(r.Context(), userID); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"cinerank/internal/cache"
+	"cinerank/internal/models"
+)
+
+// cached loads key through h.Cache, counting the lookup under name for the hit rate
+func cached[T any](ctx context.Context, h *Handler, name, key string, load func(context.Context) (T, error)) (cache.Entry[T], error) {
+	entry, hit, err := cache.Load(ctx, h.Cache, key, h.CacheTTL, load)
+	if h.Cache != nil && err == nil {
+		h.Metrics.CacheLookup(name, hit)
+	}
+	return entry, err
+}
+
+// moviesWithStats lists movies like GetAllMoviesWithStats; only the unfiltered list is cached, as
+// searches are too varied to be worth keeping
+func (h *Handler) moviesWithStats(ctx context.Context, search string) (cache.Entry[[]models.MovieWithStats], error) {
+	load := func(ctx context.Context) ([]models.MovieWithStats, error) {
+		return h.DB.GetAllMoviesWithStats(ctx, search)
+	}
+	if search != "" {
+		entry, _, err := cache.Load(ctx, nil, "", 0, load)
+		return entry, err
+	}
+	return cached(ctx, h, "movies", "movies", load)
+}
+
+func (h *Handler) recentReviews(ctx context.Context, limit int) (cache.Entry[[]models.Review], error) {
+	return cached(ctx, h, "recent_reviews", "reviews:recent:"+strconv.Itoa(limit), func(ctx context.Context) ([]models.Review, error) {
+		return h.DB.GetRecentReviews(ctx, limit)
+	})
+}
+
+func (h *Handler) movie(ctx context.Context, id int) (cache.Entry[*models.Movie], error) {
+	return cached(ctx, h, "movie", "movie:"+strconv.Itoa(id), func(ctx context.Context) (*models.Movie, error) {
+		return h.DB.GetMovieByID(ctx, id)
+	})
+}
+
+// writeConditionalJSON writes the entry's value as JSON with validators, answering 304 Not Modified
+// when the client's copy is current. The ETag is weak because compression changes the bytes sent.
+// Clients are asked to revalidate every time, since a write can change the value at any moment.
+func writeConditionalJSON[T any](w http.ResponseWriter, r *http.Request, entry cache.Entry[T]) {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(entry.Value); err != nil {
+		writeAPIError(w, r, err)
+		return
+	}
+	sum := sha256.Sum256(body.Bytes())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `W/"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", entry.Loaded, bytes.NewReader(body.Bytes()))
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cinerank/internal/cache"
+	"cinerank/internal/metrics"
+	"cinerank/internal/models"
+)
+
+// withCache makes f serve cached reads, cleared by the store's events as in the server
+func withCache(f *fixture) *fixture {
+	lru := cache.NewLRU(100)
+	f.h.Cache = lru
+	f.h.CacheTTL = time.Minute
+	f.h.Metrics = metrics.New()
+	f.store.Events = cache.Invalidating(lru, nil)
+	return f
+}
+
+func TestAPIMoviesAnswerConditionalRequests(t *testing.T) {
+	f := withCache(newFixture(t))
+	movie := f.createMovie(t, "Cidade de Deus")
+
+	for _, path := range []string{"/api/movies", "/api/movies/1"} {
+		t.Run(path, func(t *testing.T) {
+			rec := f.serve(httptest.NewRequest(http.MethodGet, path, nil))
+			etag, modified := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+			if rec.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) || modified == "" {
+				t.Fatalf("status = %d, ETag = %q, Last-Modified = %q", rec.Code, etag, modified)
+			}
+			if rec.Header().Get("Content-Type") != "application/json" || rec.Header().Get("Deprecation") != "true" {
+				t.Errorf("headers = %v", rec.Header())
+			}
+
+			for name, value := range map[string]string{"If-None-Match": etag, "If-Modified-Since": modified} {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.Header.Set(name, value)
+				if rec := f.serve(req); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+					t.Errorf("%s: status = %d, body = %q", name, rec.Code, rec.Body)
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("If-None-Match", `W/"stale"`)
+			if rec := f.serve(req); rec.Code != http.StatusOK {
+				t.Errorf("stale ETag: status = %d", rec.Code)
+			}
+		})
+	}
+
+	// A write clears the cache, so the list and its ETag change at once
+	rec := f.serve(httptest.NewRequest(http.MethodGet, "/api/movies", nil))
+	etag := rec.Header().Get("ETag")
+	f.createReview(t, movie.ID, f.user.ID, 5, "Obra-prima")
+	req := httptest.NewRequest(http.MethodGet, "/api/movies", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = f.serve(req)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag || !strings.Contains(rec.Body.String(), `"review_count":1`) {
+		t.Errorf("after a review: status = %d, ETag = %q, body = %s", rec.Code, rec.Header().Get("ETag"), rec.Body)
+	}
+
+	if rec := f.serve(httptest.NewRequest(http.MethodGet, "/api/movies/99", nil)); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown movie: status = %d", rec.Code)
+	}
+}
+
+func TestHomePageServesCachedAggregates(t *testing.T) {
+	f := withCache(newFixture(t))
+	movie := f.createMovie(t, "Cidade de Deus")
+
+	for i := 0; i < 3; i++ {
+		if rec := f.serve(httptest.NewRequest(http.MethodGet, "/", nil)); rec.Code != http.StatusOK {
+			t.Fatalf("status = %d", rec.Code)
+		}
+	}
+
+	// Writes through the store show up on the next request
+	f.createReview(t, movie.ID, f.user.ID, 4, "Muito bom")
+	if _, err := f.store.UpdateMovie(t.Context(), movie.ID, models.CreateMovieRequest{Title: "Tropa de Elite", Director: "Padilha", Year: 2007}); err != nil {
+		t.Fatal(err)
+	}
+	body := f.serve(httptest.NewRequest(http.MethodGet, "/", nil)).Body.String()
+	if !strings.Contains(body, "Muito bom") || !strings.Contains(body, "Tropa de Elite") {
+		t.Errorf("home page is stale: %s", body)
+	}
+
+	rec := httptest.NewRecorder()
+	f.h.Metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`cinerank_cache_lookups_total{cache="movies",result="hit"} 2`,
+		`cinerank_cache_lookups_total{cache="movies",result="miss"} 2`,
+		`cinerank_cache_lookups_total{cache="recent_reviews",result="hit"} 2`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
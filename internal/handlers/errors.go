@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strings"
+
+	"cinerank/internal/logging"
+	"cinerank/internal/ui"
+)
+
+// httpError answers a failed request the way its client reads errors: a problem for the API and
+// clients asking for JSON, an error fragment for HTMX, and an error page within the layout otherwise
+func httpError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if wantsJSON(r) {
+		writeProblem(w, r, status, problemCode(status), message)
+		return
+	}
+
+	name, page := "ErrorPage", ui.ErrorPage(status, message, currentUser(r))
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Retarget", "#htmx-error")
+		w.Header().Set("HX-Reswap", "innerHTML")
+		name, page = "ErrorFragment", ui.ErrorFragment(status, message)
+	}
+
+	var buf bytes.Buffer
+	if err := render(r.Context(), &buf, name, page); err != nil {
+		logging.FromContext(r.Context()).Error("Error rendering error page", "error", err)
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// ServerError answers a request whose handler panicked
+func ServerError(w http.ResponseWriter, r *http.Request) {
+	httpError(w, r, "An unexpected error occurred", http.StatusInternalServerError)
+}
+
+// wantsJSON reports whether errors for r should be problems: always under the API, and elsewhere
+// when the client accepts JSON but not HTML
+func wantsJSON(r *http.Request) bool {
+	if apiPath(r.URL.Path) {
+		return true
+	}
+
+	json, html := false, false
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		switch {
+		case mediaType == "text/html":
+			html = true
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			json = true
+		}
+	}
+	return json && !html
+}
+
+// problemCode picks the problem code for errors that carry only a status
+func problemCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusServiceUnavailable:
+		return CodeTimeout
+	default:
+		if status >= http.StatusInternalServerError {
+			return CodeInternal
+		}
+		return CodeBadRequest
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorsAnswerEachClientInItsFormat(t *testing.T) {
+	f := newFixture(t)
+
+	tests := []struct {
+		name        string
+		req         *http.Request
+		header      map[string]string
+		status      int
+		contentType string
+		body        []string
+	}{
+		{"unknown page", httptest.NewRequest(http.MethodGet, "/nowhere", nil), nil,
+			http.StatusNotFound, "text/html", []string{"<html", "Página não encontrada", "Voltar para a Home"}},
+		{"unknown movie", httptest.NewRequest(http.MethodGet, "/movie/99", nil), nil,
+			http.StatusNotFound, "text/html", []string{"<html", "Página não encontrada"}},
+		{"admin page as user", withSession(httptest.NewRequest(http.MethodGet, "/admin", nil), userSession), nil,
+			http.StatusForbidden, "text/html", []string{"<html", "Acesso negado", "Logout"}},
+		{"htmx request", httptest.NewRequest(http.MethodGet, "/movie/99", nil), map[string]string{"HX-Request": "true"},
+			http.StatusNotFound, "text/html", []string{`role="alert"`, "Página não encontrada"}},
+		{"json client on a page", httptest.NewRequest(http.MethodGet, "/movie/99", nil), map[string]string{"Accept": "application/json"},
+			http.StatusNotFound, "application/problem+json", []string{`"code":"not_found"`}},
+		{"api path", httptest.NewRequest(http.MethodGet, "/api/v1/nowhere", nil), map[string]string{"Accept": "text/html"},
+			http.StatusNotFound, "application/problem+json", []string{`"code":"not_found"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.header {
+				tt.req.Header.Set(k, v)
+			}
+			rec := f.serve(tt.req)
+			if rec.Code != tt.status || !strings.HasPrefix(rec.Header().Get("Content-Type"), tt.contentType) {
+				t.Fatalf("status = %d, content type = %q", rec.Code, rec.Header().Get("Content-Type"))
+			}
+			for _, want := range tt.body {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("body missing %q: %s", want, rec.Body)
+				}
+			}
+			if tt.header["HX-Request"] != "" {
+				if strings.Contains(rec.Body.String(), "<html") || rec.Header().Get("HX-Retarget") != "#htmx-error" {
+					t.Errorf("htmx error should be a retargeted fragment, HX-Retarget = %q", rec.Header().Get("HX-Retarget"))
+				}
+			}
+		})
+	}
+}
+
+func TestServerErrorHidesDetails(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ServerError(rec, httptest.NewRequest(http.MethodGet, "/movie/1", nil))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "Algo deu errado") {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "An unexpected error occurred") {
+		t.Error("server error pages should keep the message in the log")
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cinerank/internal/events"
+	"cinerank/internal/logging"
+	"cinerank/internal/ui"
+
+	"github.com/a-h/templ"
+)
+
+// Comment lines keep idle streams open through proxies that drop silent connections
+const sseHeartbeat = 25 * time.Second
+
+// sseMessage is one server-sent event; Data is HTML for the HTMX sse extension to swap in
+type sseMessage struct {
+	Event string
+	Data  templ.Component
+}
+
+// Live updates for a movie page: new reviews and the movie's updated stats
+func (h *Handler) MovieEvents(w http.ResponseWriter, r *http.Request) {
+	movieID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, "Invalid movie ID", http.StatusBadRequest)
+		return
+	}
+
+	viewer := currentUser(r)
+	h.streamEvents(w, r, func(e events.Event) []sseMessage {
+		if e.Type != events.TypeReviewCreated || e.MovieID != movieID {
+			return nil
+		}
+		messages := []sseMessage{{Event: "stats", Data: ui.MovieStats(e.ReviewCount, e.AverageRating)}}
+		// The author's page already shows the review from its own form response. Events too large
+		// for the Postgres bus arrive without the review; the stats still update.
+		if e.Review != nil && (viewer == nil || viewer.ID != e.Review.UserID) {
+			messages = append(messages, sseMessage{Event: "review", Data: ui.ReviewItem(*e.Review)})
+		}
+		return messages
+	})
+}
+
+// Live updates for the home page's recent reviews
+func (h *Handler) ReviewEvents(w http.ResponseWriter, r *http.Request) {
+	h.streamEvents(w, r, func(e events.Event) []sseMessage {
+		if e.Type != events.TypeReviewCreated || e.Review == nil {
+			return nil
+		}
+		return []sseMessage{{Event: "review", Data: ui.RecentReviewItem(*e.Review)}}
+	})
+}
+
+// streamEvents subscribes to the broker and writes the messages for each event until the client goes away
+func (h *Handler) streamEvents(w http.ResponseWriter, r *http.Request, messagesFor func(events.Event) []sseMessage) {
+	if h.Events == nil {
+		http.NotFound(w, r)
+		return
+	}
+	// Subscribe before the headers go out so events published right after the client connects are not lost
+	sub, cancel := h.Events.Subscribe()
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	// Streams outlive the server's write timeout; heartbeats notice dead clients instead
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logging.FromContext(r.Context()).Error("Streaming not supported", "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub:
+			if !ok {
+				return
+			}
+			for _, msg := range messagesFor(e) {
+				if err := writeSSE(r.Context(), w, msg); err != nil {
+					return
+				}
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeSSE(ctx context.Context, w http.ResponseWriter, msg sseMessage) error {
+	var html bytes.Buffer
+	if err := render(ctx, &html, "sse."+msg.Event, msg.Data); err != nil {
+		return err
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "event: %s\n", msg.Event)
+	for _, line := range strings.Split(html.String(), "\n") {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteString("\n")
+
+	_, err := fmt.Fprint(w, buf.String())
+	return err
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cinerank/internal/events"
+	"cinerank/internal/models"
+)
+
+// readSSE collects the next n events from a stream as name -> data
+func readSSE(t *testing.T, scanner *bufio.Scanner, n int) map[string]string {
+	t.Helper()
+	got := make(map[string]string)
+	var name string
+	var data []string
+	for len(got) < n && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		case line == "" && name != "":
+			got[name] = strings.Join(data, "\n")
+			name, data = "", nil
+		}
+	}
+	if len(got) < n {
+		t.Fatalf("stream ended after %d of %d events: %v", len(got), n, scanner.Err())
+	}
+	return got
+}
+
+func TestMovieEventsStreamsReviewsForThatMovie(t *testing.T) {
+	broker := events.NewMemoryBus()
+	h := &Handler{Sessions: make(map[string]SessionData), Events: broker}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events/movie/{id}", h.MovieEvents)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(server.URL + "/events/movie/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	review := func(movieID int, title string) events.Event {
+		return events.Event{
+			Type:    events.TypeReviewCreated,
+			MovieID: movieID,
+			Review: &models.Review{
+				ID: 1, MovieID: movieID, UserID: 5, Rating: 4, Title: title,
+				User: &models.User{ID: 5, Username: "ana"},
+			},
+			ReviewCount:   2,
+			AverageRating: 3.5,
+		}
+	}
+	scanner := bufio.NewScanner(resp.Body)
+
+	// Events too large for a NOTIFY payload arrive without their review
+	broker.Publish(events.Event{Type: events.TypeReviewCreated, MovieID: 1, ReviewCount: 1, AverageRating: 3})
+	if got := readSSE(t, scanner, 1); got["stats"] == "" {
+		t.Errorf("events without a review = %v", got)
+	}
+
+	broker.Publish(review(2, "Other movie"))
+	broker.Publish(review(1, "Great movie"))
+
+	got := readSSE(t, scanner, 2)
+	if !strings.Contains(got["review"], "Great movie") || !strings.Contains(got["review"], "ana") {
+		t.Errorf("review event = %q", got["review"])
+	}
+	if strings.Contains(got["review"], "Other movie") {
+		t.Errorf("received a review for another movie")
+	}
+	if !strings.Contains(got["stats"], "3.5 de 5 (2 avaliações)") {
+		t.Errorf("stats event = %q", got["stats"])
+	}
+}
+
+func TestEventStreamsDisabledWithoutBus(t *testing.T) {
+	h := &Handler{}
+	rec := httptest.NewRecorder()
+	h.ReviewEvents(rec, httptest.NewRequest(http.MethodGet, "/events/reviews", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestEventStreamsOutliveWriteTimeoutAndEndOnBusClose(t *testing.T) {
+	broker := events.NewMemoryBus()
+	h := &Handler{Events: broker}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(h.ReviewEvents))
+	server.Config.WriteTimeout = 50 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := (&http.Client{Timeout: 5 * time.Second}).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	time.Sleep(150 * time.Millisecond)
+	broker.Publish(events.Event{
+		Type:   events.TypeReviewCreated,
+		Review: &models.Review{ID: 1, Rating: 5, Title: "Late review", User: &models.User{Username: "ana"}, Movie: &models.Movie{Title: "Filme"}},
+	})
+	scanner := bufio.NewScanner(resp.Body)
+	if got := readSSE(t, scanner, 1); !strings.Contains(got["review"], "Late review") {
+		t.Errorf("review event = %q", got["review"])
+	}
+
+	broker.Close()
+	for scanner.Scan() {
+	}
+	if err := scanner.Err(); err != nil {
+		t.Errorf("stream did not end cleanly: %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+
+	"cinerank/internal/gql"
+)
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQL endpoint; only JSON POSTs are accepted so cookie-authenticated mutations cannot be sent cross-site without CORS
+func (h *Handler) GraphQL(w http.ResponseWriter, r *http.Request) {
+	if h.GraphQLSchema == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeProblem(w, r, http.StatusUnsupportedMediaType, CodeInvalidJSON, "Content-Type must be application/json")
+		return
+	}
+
+	var req graphQLRequest
+	if !decodeJSON(w, r, &req, "GraphQL request") {
+		return
+	}
+
+	ctx := gql.WithRequest(r.Context(), h.DB, currentUser(r))
+	result := gql.Execute(ctx, *h.GraphQLSchema, req.Query, req.OperationName, req.Variables)
+	writeJSON(w, http.StatusOK, result)
+}
@@ -1,25 +1,63 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"cinerank/internal/auth"
+	"cinerank/internal/cache"
 	"cinerank/internal/database"
+	"cinerank/internal/events"
+	"cinerank/internal/logging"
+	"cinerank/internal/metrics"
 	"cinerank/internal/models"
+	"cinerank/internal/tracing"
 	"cinerank/internal/ui"
+	"cinerank/internal/validation"
 
+	"github.com/a-h/templ"
 	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Handler struct {
-	DB       *database.DB
-	Sessions map[string]SessionData
+	DB database.Store
+	// Sessions is guarded by sessionsMu once the server is running
+	Sessions   map[string]SessionData
+	sessionsMu sync.Mutex
+	// PendingLogins holds users who passed the password check but still owe a 2FA code; sessionsMu guards it too
+	PendingLogins map[string]PendingLogin
+	// IdentityProvider enables external (OIDC) login when set
+	IdentityProvider auth.IdentityProvider
+	// OIDCStates holds external logins waiting for the provider's callback; sessionsMu guards it too
+	OIDCStates map[string]OIDCState
+	// GraphQLSchema serves /graphql when set
+	GraphQLSchema *graphql.Schema
+	// Events feeds the live update streams when set
+	Events events.Bus
+	// SessionLifetime is how long a sign-in lasts
+	SessionLifetime time.Duration
+	// HomeRecentReviews and APIRecentReviews are how many recent reviews the home page and /api/reviews list
+	HomeRecentReviews int
+	APIRecentReviews  int
+	// ReadinessChecks must all pass for /readyz to report ready
+	ReadinessChecks []ReadinessCheck
+	// Metrics counts failed logins and cache lookups when set
+	Metrics *metrics.Metrics
+	// Cache keeps the movie list, recent reviews and single movies for CacheTTL when set
+	Cache    cache.Cache
+	CacheTTL time.Duration
 }
 
 type SessionData struct {
@@ -27,311 +65,339 @@ type SessionData struct {
 	ExpiresAt time.Time
 }
 
-func NewHandler(db *database.DB) *Handler {
+func NewHandler(db database.Store) *Handler {
 	return &Handler{
-		DB:       db,
-		Sessions: make(map[string]SessionData),
+		DB:            db,
+		Sessions:      make(map[string]SessionData),
+		PendingLogins: make(map[string]PendingLogin),
+		OIDCStates:    make(map[string]OIDCState),
+
+		SessionLifetime:   24 * time.Hour,
+		HomeRecentReviews: 5,
+		APIRecentReviews:  10,
 	}
 }
 
-// Middleware to check authentication
-func (h *Handler) requireAuth(next func(http.ResponseWriter, *http.Request, *models.User)) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		sessionID, err := r.Cookie("session_id")
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-
-		session, exists := h.Sessions[sessionID.Value]
-		if !exists || session.ExpiresAt.Before(time.Now()) {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-
-		user, err := h.DB.GetUserByID(session.UserID)
-		if err != nil {
-			http.Error(w, "User not found", http.StatusInternalServerError)
-			return
-		}
-
-		next(w, r, user)
+// dbError answers a failed database call on an HTML route: a bare 499 when the client went away,
+// 503 when the query timed out (the database layer logs those) and a logged 500 otherwise
+func dbError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	switch {
+	case errors.Is(err, database.ErrCanceled):
+		w.WriteHeader(statusClientClosedRequest)
+	case errors.Is(err, database.ErrTimeout):
+		httpError(w, r, "The server is busy, try again in a moment", http.StatusServiceUnavailable)
+	default:
+		logging.FromContext(r.Context()).Error(message, "error", err)
+		httpError(w, r, message, http.StatusInternalServerError)
 	}
 }
 
-// Middleware to check admin
-func (h *Handler) requireAdmin(next func(http.ResponseWriter, *http.Request, *models.User)) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		sessionID, err := r.Cookie("session_id")
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-
-		session, exists := h.Sessions[sessionID.Value]
-		if !exists || session.ExpiresAt.Before(time.Now()) {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-
-		user, err := h.DB.GetUserByID(session.UserID)
-		if err != nil || user.Role != "admin" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
+// render writes c to w within a span, so slow templates show up in traces. The output is buffered so
+// a template that fails or panics halfway leaves w untouched for the error page.
+func render(ctx context.Context, w io.Writer, name string, c templ.Component) error {
+	ctx, span := tracing.Start(ctx, "render "+name)
+	defer span.End()
 
-		next(w, r, user)
+	var buf bytes.Buffer
+	if err := c.Render(ctx, &buf); err != nil {
+		tracing.Fail(span, err)
+		return err
 	}
+	_, err := w.Write(buf.Bytes())
+	return err
 }
 
 // Home page
 func (h *Handler) HomePage(w http.ResponseWriter, r *http.Request) {
-	user := h.getUserFromSession(r)
+	user := currentUser(r)
 
 	searchQuery := r.URL.Query().Get("query")
-	movies, err := h.DB.GetAllMoviesWithStats(searchQuery)
+	movies, err := h.moviesWithStats(r.Context(), searchQuery)
 	if err != nil {
-		log.Printf("Error fetching movies: %v", err)
-		movies = []models.MovieWithStats{}
+		logging.FromContext(r.Context()).Error("Error fetching movies", "error", err)
+		movies.Value = []models.MovieWithStats{}
 	}
 
-	recentReviews, err := h.DB.GetRecentReviews(5)
+	recentReviews, err := h.recentReviews(r.Context(), h.HomeRecentReviews)
 	if err != nil {
-		log.Printf("Error fetching recent reviews: %v", err)
-		recentReviews = []models.Review{}
+		logging.FromContext(r.Context()).Error("Error fetching recent reviews", "error", err)
+		recentReviews.Value = []models.Review{}
 	}
 
-	if err := ui.HomePage(movies, recentReviews, user, searchQuery).Render(r.Context(), w); err != nil {
-		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	if err := render(r.Context(), w, "HomePage", ui.HomePage(movies.Value, recentReviews.Value, user, searchQuery)); err != nil {
+		httpError(w, r, "Error rendering page", http.StatusInternalServerError)
 		return
 	}
 }
 
 // Search movies (HTMX partial)
 func (h *Handler) SearchMovies(w http.ResponseWriter, r *http.Request) {
+	// Clearing the search box asks for the full list, which comes from the cache
 	searchQuery := r.URL.Query().Get("query")
-	movies, err := h.DB.GetAllMoviesWithStats(searchQuery)
+	movies, err := h.moviesWithStats(r.Context(), searchQuery)
 	if err != nil {
-		log.Printf("Error fetching movies: %v", err)
-		movies = []models.MovieWithStats{}
+		logging.FromContext(r.Context()).Error("Error fetching movies", "error", err)
+		movies.Value = []models.MovieWithStats{}
 	}
 
-	if err := ui.MovieList(movies).Render(r.Context(), w); err != nil {
-		http.Error(w, "Error rendering movie list", http.StatusInternalServerError)
+	if err := render(r.Context(), w, "MovieList", ui.MovieList(movies.Value)); err != nil {
+		httpError(w, r, "Error rendering movie list", http.StatusInternalServerError)
 	}
 }
 
 // Movie detail page
 func (h *Handler) MoviePage(w http.ResponseWriter, r *http.Request) {
-	user := h.getUserFromSession(r)
+	user := currentUser(r)
 
-	movieIDStr := strings.TrimPrefix(r.URL.Path, "/movie/")
-	movieID, err := strconv.Atoi(movieIDStr)
+	movieID, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, "Invalid movie ID", http.StatusBadRequest)
+		httpError(w, r, "Invalid movie ID", http.StatusBadRequest)
 		return
 	}
 
-	movie, err := h.DB.GetMovieByID(movieID)
-	if err != nil {
-		http.Error(w, "Movie not found", http.StatusNotFound)
+	movie, err := h.DB.GetMovieByID(r.Context(), movieID)
+	if errors.Is(err, database.ErrNotFound) {
+		httpError(w, r, "Movie not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		dbError(w, r, "Error fetching movie", err)
 		return
 	}
 
-	reviews, err := h.DB.GetReviewsByMovieID(movieID)
+	reviews, err := h.DB.GetReviewsByMovieID(r.Context(), movieID)
 	if err != nil {
-		log.Printf("Error fetching reviews: %v", err)
+		logging.FromContext(r.Context()).Error("Error fetching reviews", "error", err)
 		reviews = []models.Review{}
 	}
 
-	if err := ui.MoviePage(movie, reviews, user).Render(r.Context(), w); err != nil {
-		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	stats, err := h.movieStatsReport(r.Context(), movie, time.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching movie stats", "error", err)
+		stats = &models.MovieStatsReport{MovieID: movieID, IMDBRating: movie.IMDBRating}
+	}
+
+	if err := render(r.Context(), w, "MoviePage", ui.MoviePage(movie, *stats, reviews, user)); err != nil {
+		httpError(w, r, "Error rendering page", http.StatusInternalServerError)
 		return
 	}
 }
 
+// Movie stats panel, reloaded by the movie page when a review is posted
+func (h *Handler) MovieStatsPanel(w http.ResponseWriter, r *http.Request) {
+	movieID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, "Invalid movie ID", http.StatusBadRequest)
+		return
+	}
+
+	movie, err := h.DB.GetMovieByID(r.Context(), movieID)
+	if errors.Is(err, database.ErrNotFound) {
+		httpError(w, r, "Movie not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		dbError(w, r, "Error fetching movie", err)
+		return
+	}
+
+	stats, err := h.movieStatsReport(r.Context(), movie, time.Now())
+	if err != nil {
+		dbError(w, r, "Error fetching movie stats", err)
+		return
+	}
+
+	if err := render(r.Context(), w, "MovieStatsPanel", ui.MovieStatsPanel(*stats)); err != nil {
+		httpError(w, r, "Error rendering movie stats", http.StatusInternalServerError)
+	}
+}
+
 // Add movie form
 func (h *Handler) AddMovieForm(w http.ResponseWriter, r *http.Request) {
-	h.requireAuth(func(w http.ResponseWriter, r *http.Request, user *models.User) {
-		if err := ui.AddMovieForm(user).Render(r.Context(), w); err != nil {
-			http.Error(w, "Error rendering form", http.StatusInternalServerError)
-			return
-		}
-	})(w, r)
+	if err := render(r.Context(), w, "AddMovieForm", ui.AddMovieForm(currentUser(r), url.Values{}, nil)); err != nil {
+		httpError(w, r, "Error rendering form", http.StatusInternalServerError)
+		return
+	}
 }
 
 // Create movie
 func (h *Handler) CreateMovie(w http.ResponseWriter, r *http.Request) {
-	h.requireAuth(func(w http.ResponseWriter, r *http.Request, user *models.User) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+	user := currentUser(r)
 
-		err := r.ParseForm()
-		if err != nil {
-			http.Error(w, "Error parsing form", http.StatusBadRequest)
-			return
-		}
+	err := r.ParseForm()
+	if err != nil {
+		httpError(w, r, "Error parsing form", http.StatusBadRequest)
+		return
+	}
 
-		year, err := strconv.Atoi(r.Form.Get("year"))
-		if err != nil {
-			http.Error(w, "Invalid year", http.StatusBadRequest)
-			return
-		}
+	// Unparseable numbers fall through to validation as out-of-range values
+	year, err := strconv.Atoi(strings.TrimSpace(r.Form.Get("year")))
+	if err != nil {
+		year = 0
+	}
 
-		imdbRating, err := strconv.ParseFloat(r.Form.Get("imdb_rating"), 64)
+	imdbRating := 0.0 // Optional field
+	if raw := strings.TrimSpace(r.Form.Get("imdb_rating")); raw != "" {
+		imdbRating, err = strconv.ParseFloat(raw, 64)
 		if err != nil {
-			imdbRating = 0.0 // Optional field
+			imdbRating = -1
 		}
+	}
 
-		tagsStr := r.Form.Get("tags")
-		tags := strings.Split(tagsStr, ",")
-		for i := range tags {
-			tags[i] = strings.TrimSpace(tags[i])
-		}
+	req := models.CreateMovieRequest{
+		Title:      r.Form.Get("title"),
+		Director:   r.Form.Get("director"),
+		Year:       year,
+		Tags:       strings.Split(r.Form.Get("tags"), ","),
+		Plot:       r.Form.Get("plot"),
+		PosterURL:  r.Form.Get("poster_url"),
+		IMDBRating: imdbRating,
+	}
 
-		req := models.CreateMovieRequest{
-			Title:      r.Form.Get("title"),
-			Director:   r.Form.Get("director"),
-			Year:       year,
-			Tags:       tags,
-			Plot:       r.Form.Get("plot"),
-			PosterURL:  r.Form.Get("poster_url"),
-			IMDBRating: imdbRating,
+	if errs := validation.Movie(&req); len(errs) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		if err := render(r.Context(), w, "AddMovieForm", ui.AddMovieForm(user, r.Form, errs.Map())); err != nil {
+			httpError(w, r, "Error rendering form", http.StatusInternalServerError)
 		}
+		return
+	}
 
-		movie, err := h.DB.CreateMovie(req)
-		if err != nil {
-			log.Printf("Error creating movie: %v", err)
-			http.Error(w, "Error creating movie", http.StatusInternalServerError)
-			return
-		}
+	movie, err := h.DB.CreateMovie(r.Context(), req)
+	if err != nil {
+		dbError(w, r, "Error creating movie", err)
+		return
+	}
 
-		// Return success message or redirect
-		w.Header().Set("HX-Redirect", fmt.Sprintf("/movie/%d", movie.ID))
+	movieURL := fmt.Sprintf("/movie/%d", movie.ID)
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", movieURL)
 		w.WriteHeader(http.StatusCreated)
-	})(w, r)
+		return
+	}
+	http.Redirect(w, r, movieURL, http.StatusSeeOther)
 }
 
 // Add review form (HTMX partial)
 func (h *Handler) AddReviewForm(w http.ResponseWriter, r *http.Request) {
-	h.requireAuth(func(w http.ResponseWriter, r *http.Request, user *models.User) {
-		movieIDStr := r.URL.Query().Get("movie_id")
-		movieID, err := strconv.Atoi(movieIDStr)
-		if err != nil {
-			http.Error(w, "Invalid movie ID", http.StatusBadRequest)
-			return
-		}
+	movieIDStr := r.URL.Query().Get("movie_id")
+	movieID, err := strconv.Atoi(movieIDStr)
+	if err != nil {
+		httpError(w, r, "Invalid movie ID", http.StatusBadRequest)
+		return
+	}
 
-		if err := ui.ReviewForm(movieID).Render(r.Context(), w); err != nil {
-			http.Error(w, "Error rendering form", http.StatusInternalServerError)
-			return
-		}
-	})(w, r)
+	dimensions, err := h.DB.RatingDimensions(r.Context())
+	if err != nil {
+		dbError(w, r, "Error reading rating dimensions", err)
+		return
+	}
+
+	if err := render(r.Context(), w, "ReviewForm", ui.ReviewForm(movieID, dimensions, url.Values{}, nil)); err != nil {
+		httpError(w, r, "Error rendering form", http.StatusInternalServerError)
+		return
+	}
 }
 
 // Create review
 func (h *Handler) CreateReview(w http.ResponseWriter, r *http.Request) {
-	h.requireAuth(func(w http.ResponseWriter, r *http.Request, user *models.User) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+	user := currentUser(r)
 
-		err := r.ParseForm()
-		if err != nil {
-			http.Error(w, "Error parsing form", http.StatusBadRequest)
-			return
-		}
+	err := r.ParseForm()
+	if err != nil {
+		httpError(w, r, "Error parsing form", http.StatusBadRequest)
+		return
+	}
 
-		movieID, err := strconv.Atoi(r.Form.Get("movie_id"))
-		if err != nil {
-			http.Error(w, "Invalid movie ID", http.StatusBadRequest)
-			return
-		}
+	movieID, err := strconv.Atoi(r.Form.Get("movie_id"))
+	if err != nil {
+		httpError(w, r, "Invalid movie ID", http.StatusBadRequest)
+		return
+	}
 
-		rating, err := strconv.Atoi(r.Form.Get("rating"))
-		if err != nil || rating < 1 || rating > 5 {
-			http.Error(w, "Invalid rating (must be 1-5)", http.StatusBadRequest)
-			return
-		}
+	rating, _ := strconv.Atoi(r.Form.Get("rating"))
 
-		req := models.CreateReviewRequest{
-			MovieID: movieID,
-			Rating:  rating,
-			Title:   r.Form.Get("title"),
-			Content: r.Form.Get("content"),
-		}
+	dimensions, err := h.DB.RatingDimensions(r.Context())
+	if err != nil {
+		dbError(w, r, "Error reading rating dimensions", err)
+		return
+	}
 
-		review, err := h.DB.CreateReview(req, user.ID)
-		if err != nil {
-			log.Printf("Error creating review: %v", err)
-			http.Error(w, "Error creating review", http.StatusInternalServerError)
-			return
+	req := models.CreateReviewRequest{
+		MovieID:    movieID,
+		Rating:     rating,
+		Title:      r.Form.Get("title"),
+		Content:    r.Form.Get("content"),
+		SubRatings: formSubRatings(r.Form, dimensions),
+	}
+
+	errs := validation.Review(&req)
+	errs = append(errs, validation.SubRatings(req.SubRatings, dimensions, nil)...)
+	if len(errs) > 0 {
+		// HTMX only swaps 2xx responses, so re-render the form into its container
+		w.Header().Set("HX-Retarget", "#review-form")
+		w.Header().Set("HX-Reswap", "innerHTML")
+		if err := render(r.Context(), w, "ReviewForm", ui.ReviewForm(movieID, dimensions, r.Form, errs.Map())); err != nil {
+			httpError(w, r, "Error rendering form", http.StatusInternalServerError)
 		}
+		return
+	}
 
-		review.User = user
+	review, err := h.DB.CreateReview(r.Context(), req, user.ID)
+	if errors.Is(err, database.ErrConstraint) {
+		httpError(w, r, "Movie not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		dbError(w, r, "Error creating review", err)
+		return
+	}
 
-		// Return the new review as HTMX response
-		if err := ui.ReviewItem(*review).Render(r.Context(), w); err != nil {
-			http.Error(w, "Error rendering review", http.StatusInternalServerError)
-			return
-		}
-	})(w, r)
+	review.User = user
+
+	// Return the new review as HTMX response
+	if err := render(r.Context(), w, "ReviewItem", ui.ReviewItem(*review)); err != nil {
+		httpError(w, r, "Error rendering review", http.StatusInternalServerError)
+		return
+	}
 }
 
 // Login form
 func (h *Handler) LoginForm(w http.ResponseWriter, r *http.Request) {
-	if err := ui.LoginForm().Render(r.Context(), w); err != nil {
-		http.Error(w, "Error rendering form", http.StatusInternalServerError)
+	providerName := ""
+	if h.IdentityProvider != nil {
+		providerName = h.IdentityProvider.Name()
+	}
+
+	if err := render(r.Context(), w, "LoginForm", ui.LoginForm(providerName)); err != nil {
+		httpError(w, r, "Error rendering form", http.StatusInternalServerError)
 	}
 }
 
 // Login
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	err := r.ParseForm()
 	if err != nil {
-		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		httpError(w, r, "Error parsing form", http.StatusBadRequest)
 		return
 	}
 
 	email := r.Form.Get("email")
 	password := r.Form.Get("password")
 
-	user, err := h.DB.GetUserByEmail(email)
+	user, err := h.DB.GetUserByEmail(r.Context(), email)
 	if err != nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		h.Metrics.LoginFailed(metrics.LoginBadPassword)
+		httpError(w, r, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// Create session
-	sessionID := uuid.New().String()
-	h.Sessions[sessionID] = SessionData{
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
-	}
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sessionID,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-	})
-
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	h.completeLogin(w, r, user)
 }
 
 // Logout
 func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
 	sessionID, err := r.Cookie("session_id")
 	if err == nil {
+		h.sessionsMu.Lock()
 		delete(h.Sessions, sessionID.Value)
+		h.sessionsMu.Unlock()
 	}
 
 	http.SetCookie(w, &http.Cookie{
@@ -346,192 +412,265 @@ func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
 
 // Register form
 func (h *Handler) RegisterForm(w http.ResponseWriter, r *http.Request) {
-	if err := ui.RegisterForm().Render(r.Context(), w); err != nil {
-		http.Error(w, "Error rendering form", http.StatusInternalServerError)
+	if err := render(r.Context(), w, "RegisterForm", ui.RegisterForm(url.Values{}, nil)); err != nil {
+		httpError(w, r, "Error rendering form", http.StatusInternalServerError)
 	}
 }
 
 // Register
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	err := r.ParseForm()
 	if err != nil {
-		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		httpError(w, r, "Error parsing form", http.StatusBadRequest)
 		return
 	}
 
-	username := r.Form.Get("username")
-	email := r.Form.Get("email")
-	password := r.Form.Get("password")
+	req := models.RegisterRequest{
+		Username: r.Form.Get("username"),
+		Email:    r.Form.Get("email"),
+		Password: r.Form.Get("password"),
+	}
+
+	errs := validation.Register(&req)
+	if len(errs) == 0 {
+		errs, err = h.checkRegistrationAvailable(r.Context(), req)
+		if err != nil {
+			dbError(w, r, "Error creating user", err)
+			return
+		}
+	}
+	if len(errs) > 0 {
+		// Never echo the password back into the form
+		r.Form.Del("password")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		if err := render(r.Context(), w, "RegisterForm", ui.RegisterForm(r.Form, errs.Map())); err != nil {
+			httpError(w, r, "Error rendering form", http.StatusInternalServerError)
+		}
+		return
+	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		httpError(w, r, "Error hashing password", http.StatusInternalServerError)
 		return
 	}
 
-	user, err := h.DB.CreateUser(models.RegisterRequest{
-		Username: username,
-		Email:    email,
-		Password: string(hash),
-	})
+	req.Password = string(hash)
+	user, err := h.DB.CreateUser(r.Context(), req)
 	if err != nil {
-		log.Printf("Error creating user: %v", err)
-		http.Error(w, "Error creating user", http.StatusInternalServerError)
+		dbError(w, r, "Error creating user", err)
 		return
 	}
 
-	// Create session
-	sessionID := uuid.New().String()
-	h.Sessions[sessionID] = SessionData{
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
+	h.createSession(w, user.ID)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Helper to report usernames and emails that are already registered
+func (h *Handler) checkRegistrationAvailable(ctx context.Context, req models.RegisterRequest) (validation.Errors, error) {
+	var errs validation.Errors
+
+	exists, err := h.DB.UsernameExists(ctx, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		errs.Add("username", validation.CodeTaken, "is already taken")
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sessionID,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-	})
+	_, err = h.DB.GetUserByEmail(ctx, req.Email)
+	if err == nil {
+		errs.Add("email", validation.CodeTaken, "is already registered")
+	} else if !errors.Is(err, database.ErrNotFound) {
+		return nil, err
+	}
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	return errs, nil
 }
 
 // Admin panel
 func (h *Handler) AdminPanel(w http.ResponseWriter, r *http.Request) {
-	h.requireAdmin(func(w http.ResponseWriter, r *http.Request, user *models.User) {
-		users, err := h.DB.GetAllUsers()
-		if err != nil {
-			log.Printf("Error fetching users: %v", err)
-		}
+	user := currentUser(r)
 
-		movies, err := h.DB.GetAllMoviesWithStats("")
-		if err != nil {
-			log.Printf("Error fetching movies: %v", err)
-		}
+	users, err := h.DB.GetAllUsers(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching users", "error", err)
+	}
 
-		if err := ui.AdminPanel(users, movies, user).Render(r.Context(), w); err != nil {
-			http.Error(w, "Error rendering admin panel", http.StatusInternalServerError)
-		}
-	})(w, r)
+	movies, err := h.DB.GetAllMoviesWithStats(r.Context(), "")
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching movies", "error", err)
+	}
+
+	require2FA, err := h.DB.RequireAdmin2FA(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error reading 2FA setting", "error", err)
+	}
+
+	dimensions, err := h.DB.RatingDimensions(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error reading rating dimensions", "error", err)
+	}
+
+	if err := render(r.Context(), w, "AdminPanel", ui.AdminPanel(users, movies, user, require2FA, dimensions)); err != nil {
+		httpError(w, r, "Error rendering admin panel", http.StatusInternalServerError)
+	}
 }
 
 // Delete user (admin)
 func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	h.requireAdmin(func(w http.ResponseWriter, r *http.Request, user *models.User) {
-		userIDStr := strings.TrimPrefix(r.URL.Path, "/admin/delete-user/")
-		userID, err := strconv.Atoi(userIDStr)
-		if err != nil {
-			http.Error(w, "Invalid user ID", http.StatusBadRequest)
-			return
-		}
+	user := currentUser(r)
 
-		if userID == user.ID {
-			http.Error(w, "Cannot delete yourself", http.StatusBadRequest)
-			return
-		}
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
 
-		err = h.DB.DeleteUser(userID)
-		if err != nil {
-			http.Error(w, "Error deleting user", http.StatusInternalServerError)
-			return
-		}
+	if userID == user.ID {
+		httpError(w, r, "Cannot delete yourself", http.StatusBadRequest)
+		return
+	}
 
-		http.Redirect(w, r, "/admin", http.StatusSeeOther)
-	})(w, r)
+	err = h.DB.DeleteUser(r.Context(), userID)
+	if errors.Is(err, database.ErrNotFound) {
+		httpError(w, r, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		dbError(w, r, "Error deleting user", err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
 // Delete movie (admin)
 func (h *Handler) DeleteMovie(w http.ResponseWriter, r *http.Request) {
-	h.requireAdmin(func(w http.ResponseWriter, r *http.Request, user *models.User) {
-		movieIDStr := strings.TrimPrefix(r.URL.Path, "/admin/delete-movie/")
-		movieID, err := strconv.Atoi(movieIDStr)
-		if err != nil {
-			http.Error(w, "Invalid movie ID", http.StatusBadRequest)
-			return
-		}
+	movieID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, "Invalid movie ID", http.StatusBadRequest)
+		return
+	}
 
-		err = h.DB.DeleteMovie(movieID)
-		if err != nil {
-			http.Error(w, "Error deleting movie", http.StatusInternalServerError)
-			return
-		}
+	err = h.DB.DeleteMovie(r.Context(), movieID)
+	if errors.Is(err, database.ErrNotFound) {
+		httpError(w, r, "Movie not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		dbError(w, r, "Error deleting movie", err)
+		return
+	}
 
-		http.Redirect(w, r, "/admin", http.StatusSeeOther)
-	})(w, r)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
-// Helper to get user from session
-func (h *Handler) getUserFromSession(r *http.Request) *models.User {
-	sessionID, err := r.Cookie("session_id")
-	if err != nil {
-		return nil
+// Helper to create a session and set its cookie
+func (h *Handler) createSession(w http.ResponseWriter, userID int) {
+	sessionID := uuid.New().String()
+	expiresAt := time.Now().Add(h.SessionLifetime)
+	h.sessionsMu.Lock()
+	h.Sessions[sessionID] = SessionData{
+		UserID:    userID,
+		ExpiresAt: expiresAt,
 	}
+	h.sessionsMu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    sessionID,
+		Expires:  expiresAt,
+		HttpOnly: true,
+	})
+}
+
+// lookupSession returns the session with id unless it is missing or expired
+func (h *Handler) lookupSession(id string) (SessionData, bool) {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+
+	session, exists := h.Sessions[id]
+	return session, exists && session.ExpiresAt.After(time.Now())
+}
 
-	session, exists := h.Sessions[sessionID.Value]
-	if !exists || session.ExpiresAt.Before(time.Now()) {
-		return nil
+// ActiveSessions counts the sessions that have not expired
+func (h *Handler) ActiveSessions() int {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+
+	now := time.Now()
+	count := 0
+	for _, session := range h.Sessions {
+		if session.ExpiresAt.After(now) {
+			count++
+		}
 	}
+	return count
+}
 
-	user, err := h.DB.GetUserByID(session.UserID)
+// sessionUser loads the user signed in with the request's session cookie, or nil when there is none.
+// A session whose user has since been deleted counts as none.
+func (h *Handler) sessionUser(r *http.Request) (*models.User, error) {
+	sessionID, err := r.Cookie("session_id")
 	if err != nil {
-		return nil
+		return nil, nil
 	}
 
-	return user
+	session, exists := h.lookupSession(sessionID.Value)
+	if !exists {
+		return nil, nil
+	}
+	logging.SetUserID(r.Context(), session.UserID)
+
+	user, err := h.DB.GetUserByID(r.Context(), session.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	return user, err
 }
 
 // API endpoints for JSON responses
 func (h *Handler) APIGetMovies(w http.ResponseWriter, r *http.Request) {
 	searchQuery := r.URL.Query().Get("query")
-	movies, err := h.DB.GetAllMoviesWithStats(searchQuery)
+	movies, err := h.moviesWithStats(r.Context(), searchQuery)
 	if err != nil {
-		http.Error(w, "Error fetching movies", http.StatusInternalServerError)
+		writeAPIError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(movies)
+	writeConditionalJSON(w, r, movies)
 }
 
 func (h *Handler) APIGetMovie(w http.ResponseWriter, r *http.Request) {
-	movieIDStr := strings.TrimPrefix(r.URL.Path, "/api/movies/")
-	movieID, err := strconv.Atoi(movieIDStr)
+	movieID, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, "Invalid movie ID", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Movie ID must be an integer")
 		return
 	}
 
-	movie, err := h.DB.GetMovieByID(movieID)
+	movie, err := h.movie(r.Context(), movieID)
 	if err != nil {
-		http.Error(w, "Movie not found", http.StatusNotFound)
+		writeAPIError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(movie)
+	writeConditionalJSON(w, r, movie)
 }
 
 func (h *Handler) APICreateMovie(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	var req models.CreateMovieRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidJSON, "Request body must be a valid JSON movie object")
 		return
 	}
 
-	var req models.CreateMovieRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if errs := validation.Movie(&req); len(errs) > 0 {
+		writeAPIError(w, r, errs)
 		return
 	}
 
-	movie, err := h.DB.CreateMovie(req)
+	movie, err := h.DB.CreateMovie(r.Context(), req)
 	if err != nil {
-		http.Error(w, "Error creating movie", http.StatusInternalServerError)
+		writeAPIError(w, r, err)
 		return
 	}
 
@@ -544,9 +683,9 @@ func (h *Handler) APIGetReviews(w http.ResponseWriter, r *http.Request) {
 	movieIDStr := r.URL.Query().Get("movie_id")
 	if movieIDStr == "" {
 		// Get recent reviews
-		reviews, err := h.DB.GetRecentReviews(10)
+		reviews, err := h.DB.GetRecentReviews(r.Context(), h.APIRecentReviews)
 		if err != nil {
-			http.Error(w, "Error fetching reviews", http.StatusInternalServerError)
+			writeAPIError(w, r, err)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -556,13 +695,13 @@ func (h *Handler) APIGetReviews(w http.ResponseWriter, r *http.Request) {
 
 	movieID, err := strconv.Atoi(movieIDStr)
 	if err != nil {
-		http.Error(w, "Invalid movie ID", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidID, "movie_id must be an integer")
 		return
 	}
 
-	reviews, err := h.DB.GetReviewsByMovieID(movieID)
+	reviews, err := h.DB.GetReviewsByMovieID(r.Context(), movieID)
 	if err != nil {
-		http.Error(w, "Error fetching reviews", http.StatusInternalServerError)
+		writeAPIError(w, r, err)
 		return
 	}
 
@@ -571,31 +710,28 @@ func (h *Handler) APIGetReviews(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) APICreateReview(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var req models.CreateReviewRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, CodeInvalidJSON, "Request body must be a valid JSON review object")
 		return
 	}
 
-	if req.Rating < 1 || req.Rating > 5 {
-		http.Error(w, "Rating must be between 1 and 5", http.StatusBadRequest)
+	// Sub-ratings are only part of /api/v1
+	req.SubRatings = nil
+	if errs := validation.Review(&req); len(errs) > 0 {
+		writeAPIError(w, r, errs)
 		return
 	}
 
 	// Note: API would need user authentication (e.g., JWT). For simplicity, assuming user_id is provided
 	userID := 1 // Placeholder; should be extracted from auth token
-	review, err := h.DB.CreateReview(req, userID)
+	review, err := h.DB.CreateReview(r.Context(), req, userID)
 	if err != nil {
-		http.Error(w, "Error creating review", http.StatusInternalServerError)
+		writeAPIError(w, r, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(review)
-}
\ No newline at end of file
+}
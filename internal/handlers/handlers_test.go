@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"cinerank/internal/database"
+	"cinerank/internal/database/memory"
+	"cinerank/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	adminSession = "admin-session"
+	userSession  = "user-session"
+	testPassword = "password123"
+)
+
+// fixture is a handler backed by the in-memory store, with an admin and a regular user signed in
+type fixture struct {
+	h     *Handler
+	store *memory.Store
+	admin *models.User
+	user  *models.User
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	store := memory.New()
+	f := &fixture{h: NewHandler(store), store: store}
+	f.admin = f.createUser(t, "Admin", "admin@example.com", "admin", adminSession)
+	f.user = f.createUser(t, "MovieBuff", "buff@example.com", "user", userSession)
+	return f
+}
+
+func (f *fixture) createUser(t *testing.T, username, email, role, sessionID string) *models.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := f.store.CreateUserWithRole(t.Context(), models.RegisterRequest{Username: username, Email: email, Password: string(hash)}, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.h.Sessions[sessionID] = SessionData{UserID: u.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	return u
+}
+
+func (f *fixture) createMovie(t *testing.T, title string, tags ...string) *models.Movie {
+	t.Helper()
+	m, err := f.store.CreateMovie(t.Context(), models.CreateMovieRequest{Title: title, Director: "Diretor", Year: 2002, Tags: tags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func (f *fixture) createReview(t *testing.T, movieID, userID, rating int, title string) *models.Review {
+	t.Helper()
+	r, err := f.store.CreateReview(t.Context(), models.CreateReviewRequest{MovieID: movieID, Rating: rating, Title: title}, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// serve sends req through the router, as the server would
+func (f *fixture) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	f.h.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func postForm(path string, form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestHomePageListsMoviesAndRecentReviews(t *testing.T) {
+	f := newFixture(t)
+	movie := f.createMovie(t, "Cidade de Deus", "Crime")
+	f.createReview(t, movie.ID, f.user.ID, 5, "Obra-prima")
+
+	rec := httptest.NewRecorder()
+	f.h.HomePage(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	for _, want := range []string{"Cidade de Deus", "Crime", "Obra-prima", "MovieBuff"} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("home page is missing %q", want)
+		}
+	}
+}
+
+func TestSearchMoviesMatchesTitlesAndTags(t *testing.T) {
+	f := newFixture(t)
+	f.createMovie(t, "Cidade de Deus", "Crime")
+	f.createMovie(t, "Central do Brasil", "Drama")
+
+	for query, want := range map[string]string{"cidade": "Cidade de Deus", "drama": "Central do Brasil"} {
+		rec := httptest.NewRecorder()
+		f.h.SearchMovies(rec, httptest.NewRequest(http.MethodGet, "/search?query="+query, nil))
+
+		body := rec.Body.String()
+		if !strings.Contains(body, want) {
+			t.Errorf("search %q is missing %q", query, want)
+		}
+		if strings.Count(body, "/movie/") != 1 {
+			t.Errorf("search %q should match one movie: %s", query, body)
+		}
+	}
+}
+
+func TestMoviePage(t *testing.T) {
+	f := newFixture(t)
+	movie := f.createMovie(t, "Cidade de Deus")
+	f.createReview(t, movie.ID, f.user.ID, 4, "Muito bom")
+
+	rec := f.serve(httptest.NewRequest(http.MethodGet, "/movie/1", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Muito bom") {
+		t.Errorf("status = %d, body missing the review", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "4.0 de 5 (1 avaliações)") {
+		t.Error("body missing the movie's stats")
+	}
+
+	rec = f.serve(httptest.NewRequest(http.MethodGet, "/movie/99", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown movie: status = %d", rec.Code)
+	}
+}
+
+func TestCreateMovieFromForm(t *testing.T) {
+	f := newFixture(t)
+
+	form := url.Values{"title": {"Tropa de Elite"}, "director": {"José Padilha"}, "year": {"2007"}, "tags": {" Ação, Crime ,ação"}}
+	rec := f.serve(withSession(postForm("/movies", form), userSession))
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/movie/1" {
+		t.Fatalf("status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+	movie, err := f.store.GetMovieByID(t.Context(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(movie.Tags, ",") != "Ação,Crime" {
+		t.Errorf("tags = %q", movie.Tags)
+	}
+
+	form.Set("year", "1800")
+	rec = f.serve(withSession(postForm("/movies", form), userSession))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid year: status = %d", rec.Code)
+	}
+}
+
+func TestCreateReviewFromForm(t *testing.T) {
+	f := newFixture(t)
+	movie := f.createMovie(t, "Cidade de Deus")
+
+	form := url.Values{"movie_id": {"1"}, "rating": {"5"}, "title": {"Imperdível"}, "content": {"Assistam."}}
+	rec := f.serve(withSession(postForm("/reviews", form), userSession))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Imperdível") {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	reviews, _ := f.store.GetReviewsByMovieID(t.Context(), movie.ID)
+	if len(reviews) != 1 || reviews[0].UserID != f.user.ID {
+		t.Errorf("reviews = %+v", reviews)
+	}
+
+	form.Set("movie_id", "42")
+	rec = f.serve(withSession(postForm("/reviews", form), userSession))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown movie: status = %d", rec.Code)
+	}
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	f := newFixture(t)
+
+	form := url.Values{"username": {"novato"}, "email": {"novato@example.com"}, "password": {testPassword}}
+	rec := httptest.NewRecorder()
+	f.h.Register(rec, postForm("/register", form))
+	if rec.Code != http.StatusSeeOther || len(rec.Result().Cookies()) == 0 {
+		t.Fatalf("register: status = %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	f.h.Register(rec, postForm("/register", form))
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "already") {
+		t.Errorf("duplicate register: status = %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	f.h.Login(rec, postForm("/login", url.Values{"email": {"novato@example.com"}, "password": {testPassword}}))
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("login: status = %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	f.h.Login(rec, postForm("/login", url.Values{"email": {"novato@example.com"}, "password": {"wrong-password"}}))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: status = %d", rec.Code)
+	}
+}
+
+func TestAdminDeleteMovieRemovesItsReviews(t *testing.T) {
+	f := newFixture(t)
+	movie := f.createMovie(t, "Cidade de Deus")
+	review := f.createReview(t, movie.ID, f.user.ID, 5, "Obra-prima")
+
+	rec := f.serve(withSession(httptest.NewRequest(http.MethodPost, "/admin/delete-movie/1", nil), userSession))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d", rec.Code)
+	}
+
+	rec = f.serve(withSession(httptest.NewRequest(http.MethodPost, "/admin/delete-movie/1", nil), adminSession))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("admin: status = %d", rec.Code)
+	}
+	if _, err := f.store.GetReviewByID(t.Context(), review.ID); err == nil {
+		t.Error("review survived its movie")
+	}
+}
+
+// Walks the v1 API through its success paths, checking each response against the spec
+func TestAPIV1SuccessResponsesConformToSpec(t *testing.T) {
+	doc := loadSpec(t)
+	f := newFixture(t)
+	movie := f.createMovie(t, "Cidade de Deus", "Crime")
+	review := f.createReview(t, movie.ID, f.user.ID, 4, "Muito bom")
+
+	jsonRequest := func(method, path, body string) *http.Request {
+		return httptest.NewRequest(method, path, strings.NewReader(body))
+	}
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"list movies", httptest.NewRequest(http.MethodGet, "/api/v1/movies?query=crime", nil), http.StatusOK},
+		{"get movie", httptest.NewRequest(http.MethodGet, "/api/v1/movies/1", nil), http.StatusOK},
+		{"create movie", withSession(jsonRequest(http.MethodPost, "/api/v1/movies", `{"title":"Central do Brasil","director":"Walter Salles","year":1998,"tags":["Drama"]}`), userSession), http.StatusCreated},
+		{"patch movie", withSession(jsonRequest(http.MethodPatch, "/api/v1/movies/1", `{"year":2003}`), adminSession), http.StatusOK},
+		{"movie reviews", httptest.NewRequest(http.MethodGet, "/api/v1/movies/1/reviews", nil), http.StatusOK},
+		{"movie stats", httptest.NewRequest(http.MethodGet, "/api/v1/movies/1/stats", nil), http.StatusOK},
+		{"recent reviews", httptest.NewRequest(http.MethodGet, "/api/v1/reviews?limit=5", nil), http.StatusOK},
+		{"create review", withSession(jsonRequest(http.MethodPost, "/api/v1/reviews", `{"movie_id":1,"rating":3,"title":"Razoável","sub_ratings":{"story":4}}`), adminSession), http.StatusCreated},
+		{"get review", httptest.NewRequest(http.MethodGet, "/api/v1/reviews/1", nil), http.StatusOK},
+		{"patch own review", withSession(jsonRequest(http.MethodPatch, "/api/v1/reviews/1", `{"rating":5,"sub_ratings":{"acting":3}}`), userSession), http.StatusOK},
+		{"create tag", withSession(jsonRequest(http.MethodPost, "/api/v1/tags", `{"name":"Noir"}`), adminSession), http.StatusCreated},
+		{"duplicate tag", withSession(jsonRequest(http.MethodPost, "/api/v1/tags", `{"name":"Noir"}`), adminSession), http.StatusConflict},
+		{"list tags", httptest.NewRequest(http.MethodGet, "/api/v1/tags", nil), http.StatusOK},
+		{"rename tag", withSession(jsonRequest(http.MethodPut, "/api/v1/tags/1", `{"name":"Policial"}`), adminSession), http.StatusOK},
+		{"list users", withSession(httptest.NewRequest(http.MethodGet, "/api/v1/users", nil), adminSession), http.StatusOK},
+		{"get self", withSession(httptest.NewRequest(http.MethodGet, "/api/v1/users/2", nil), userSession), http.StatusOK},
+		{"create user", withSession(jsonRequest(http.MethodPost, "/api/v1/users", `{"username":"critica","email":"critica@example.com","password":"password123","role":"user"}`), adminSession), http.StatusCreated},
+		{"promote user", withSession(jsonRequest(http.MethodPatch, "/api/v1/users/2", `{"role":"admin"}`), adminSession), http.StatusOK},
+		{"delete review", withSession(httptest.NewRequest(http.MethodDelete, "/api/v1/reviews/1", nil), adminSession), http.StatusNoContent},
+		{"delete tag", withSession(httptest.NewRequest(http.MethodDelete, "/api/v1/tags/1", nil), adminSession), http.StatusNoContent},
+		{"delete movie", withSession(httptest.NewRequest(http.MethodDelete, "/api/v1/movies/1", nil), adminSession), http.StatusNoContent},
+		{"delete user", withSession(httptest.NewRequest(http.MethodDelete, "/api/v1/users/3", nil), adminSession), http.StatusNoContent},
+		{"deleted movie", httptest.NewRequest(http.MethodGet, "/api/v1/movies/1", nil), http.StatusNotFound},
+	}
+
+	// The cases build on each other, so they run in order and stop at the first failure
+	for _, tt := range tests {
+		if !t.Run(tt.name, func(t *testing.T) {
+			rec := f.serve(tt.req)
+			assertConforms(t, doc, tt.req.Method, tt.req, rec, tt.status)
+		}) {
+			break
+		}
+	}
+
+	if _, err := f.store.GetReviewByID(t.Context(), review.ID); err == nil {
+		t.Error("review still exists")
+	}
+}
+
+func TestAPIV1ListMoviesCountsEachReviewOnce(t *testing.T) {
+	f := newFixture(t)
+	movie := f.createMovie(t, "Cidade de Deus", "Crime", "Drama")
+	f.createReview(t, movie.ID, f.user.ID, 5, "Obra-prima")
+	f.createReview(t, movie.ID, f.admin.ID, 2, "Violento demais")
+
+	rec := httptest.NewRecorder()
+	f.h.APIV1ListMovies(rec, httptest.NewRequest(http.MethodGet, "/api/v1/movies", nil))
+
+	var movies []models.MovieWithStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &movies); err != nil {
+		t.Fatal(err)
+	}
+	if len(movies) != 1 {
+		t.Fatalf("got %d movies", len(movies))
+	}
+	if got := movies[0]; got.ReviewCount != 2 || got.AverageRating != 3.5 || len(got.Tags) != 2 {
+		t.Errorf("got %d reviews averaging %v with tags %q", got.ReviewCount, got.AverageRating, got.Tags)
+	}
+}
+
+func TestAPIV1UserCannotChangeOthersReview(t *testing.T) {
+	doc := loadSpec(t)
+	f := newFixture(t)
+	movie := f.createMovie(t, "Cidade de Deus")
+	f.createReview(t, movie.ID, f.admin.ID, 5, "Do admin")
+
+	req := withSession(httptest.NewRequest(http.MethodDelete, "/api/v1/reviews/1", nil), userSession)
+	rec := f.serve(req)
+	assertConforms(t, doc, http.MethodDelete, req, rec, http.StatusForbidden)
+
+	if _, err := f.store.GetReviewByID(t.Context(), 1); err != nil {
+		t.Errorf("review was deleted: %v", err)
+	}
+}
+
+func TestAdminRoutesHonourRequire2FA(t *testing.T) {
+	f := newFixture(t)
+	if err := f.store.SetSetting(t.Context(), database.SettingRequireAdmin2FA, "true"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := f.serve(withSession(httptest.NewRequest(http.MethodGet, "/admin", nil), adminSession))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/account/2fa" {
+		t.Errorf("status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestCanceledRequestsAreNotServerErrors(t *testing.T) {
+	f := newFixture(t)
+	f.createMovie(t, "Cidade de Deus")
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	rec := httptest.NewRecorder()
+	f.h.APIV1ListMovies(rec, httptest.NewRequest(http.MethodGet, "/api/v1/movies", nil).WithContext(ctx))
+	if rec.Code != statusClientClosedRequest || rec.Body.Len() != 0 {
+		t.Errorf("API: status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+
+	rec = f.serve(httptest.NewRequest(http.MethodGet, "/movie/1", nil).WithContext(ctx))
+	if rec.Code != statusClientClosedRequest {
+		t.Errorf("page: status = %d", rec.Code)
+	}
+}
+
+func TestReadyzReportsEachCheck(t *testing.T) {
+	f := newFixture(t)
+	f.h.ReadinessChecks = []ReadinessCheck{
+		{Name: "database", Check: func(ctx context.Context) error { return nil }},
+		{Name: "migrations", Check: func(ctx context.Context) error { return errors.New("1 migrations pending") }},
+	}
+
+	rec := httptest.NewRecorder()
+	f.h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(body, "database: ok") || !strings.Contains(body, "migrations: failing") {
+		t.Errorf("failing check: status = %d, body = %q", rec.Code, body)
+	}
+	if strings.Contains(body, "pending") {
+		t.Errorf("readiness errors leak into the response: %q", body)
+	}
+
+	f.h.ReadinessChecks = f.h.ReadinessChecks[:1]
+	rec = httptest.NewRecorder()
+	f.h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("passing checks: status = %d", rec.Code)
+	}
+}
+
+func TestActiveSessionsSkipsExpired(t *testing.T) {
+	f := newFixture(t)
+	f.h.Sessions["stale"] = SessionData{UserID: f.user.ID, ExpiresAt: time.Now().Add(-time.Minute)}
+
+	if got := f.h.ActiveSessions(); got != 2 {
+		t.Errorf("ActiveSessions = %d, want 2", got)
+	}
+	if user, _ := f.h.sessionUser(withSession(httptest.NewRequest(http.MethodGet, "/", nil), "stale")); user != nil {
+		t.Error("expired session still signs the user in")
+	}
+}
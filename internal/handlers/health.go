@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cinerank/internal/logging"
+)
+
+// readinessTimeout bounds all readiness checks together, well under a typical probe timeout
+const readinessTimeout = 2 * time.Second
+
+// ReadinessCheck is one dependency /readyz waits on
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Liveness probe: the process is up and serving
+func (h *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "ok")
+}
+
+// Readiness probe: every readiness check passes, so the instance can take traffic
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	var report strings.Builder
+	status := http.StatusOK
+	for _, c := range h.ReadinessChecks {
+		if err := c.Check(ctx); err != nil {
+			logging.FromContext(r.Context()).Warn("Readiness check failed", "check", c.Name, "error", err)
+			fmt.Fprintf(&report, "%s: failing\n", c.Name)
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		fmt.Fprintf(&report, "%s: ok\n", c.Name)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	fmt.Fprint(w, report.String())
+}
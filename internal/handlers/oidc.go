@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cinerank/internal/auth"
+	"cinerank/internal/database"
+	"cinerank/internal/logging"
+	"cinerank/internal/metrics"
+	"cinerank/internal/models"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCState is the per-login data kept between the redirect to the IdP and the callback
+type OIDCState struct {
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// Start an external login by redirecting to the identity provider
+func (h *Handler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if h.IdentityProvider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	state, err1 := auth.GenerateRandomToken()
+	nonce, err2 := auth.GenerateRandomToken()
+	verifier, err3 := auth.GenerateRandomToken()
+	if err := errors.Join(err1, err2, err3); err != nil {
+		httpError(w, r, "Error starting login", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := h.IdentityProvider.AuthCodeURL(r.Context(), state, nonce, auth.CodeChallengeS256(verifier))
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error building OIDC authorization URL", "error", err)
+		httpError(w, r, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now()
+	h.sessionsMu.Lock()
+	// Logins abandoned at the identity provider never come back, so expired states go whenever a new one starts
+	for id, s := range h.OIDCStates {
+		if s.ExpiresAt.Before(now) {
+			delete(h.OIDCStates, id)
+		}
+	}
+	h.OIDCStates[state] = OIDCState{
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(oidcStateTTL),
+	}
+	h.sessionsMu.Unlock()
+
+	// The state cookie binds the callback to the browser that started the login
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oidc_state",
+		Value:    state,
+		Path:     "/auth/oidc",
+		Expires:  time.Now().Add(oidcStateTTL),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Handle the identity provider redirect, linking or creating the local user
+func (h *Handler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if h.IdentityProvider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	cookie, err := r.Cookie("oidc_state")
+	if err != nil || cookie.Value == "" || cookie.Value != query.Get("state") {
+		httpError(w, r, "Invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	h.sessionsMu.Lock()
+	state, exists := h.OIDCStates[cookie.Value]
+	delete(h.OIDCStates, cookie.Value)
+	h.sessionsMu.Unlock()
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oidc_state",
+		Value:    "",
+		Path:     "/auth/oidc",
+		Expires:  time.Now().Add(-time.Hour),
+		HttpOnly: true,
+	})
+	if !exists || state.ExpiresAt.Before(time.Now()) {
+		httpError(w, r, "Login session expired", http.StatusBadRequest)
+		return
+	}
+
+	if errCode := query.Get("error"); errCode != "" {
+		logging.FromContext(r.Context()).Warn("OIDC login rejected by provider",
+			"error_code", errCode, "error_description", query.Get("error_description"))
+		httpError(w, r, "Login was not completed", http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := h.IdentityProvider.Exchange(r.Context(), query.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error completing OIDC login", "error", err)
+		h.Metrics.LoginFailed(metrics.LoginProviderFailed)
+		httpError(w, r, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userForIdentity(r.Context(), identity)
+	if err != nil {
+		var forbidden *identityError
+		if errors.As(err, &forbidden) {
+			httpError(w, r, forbidden.Error(), http.StatusForbidden)
+			return
+		}
+		dbError(w, r, "Error signing in", err)
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+type identityError struct {
+	msg string
+}
+
+func (e *identityError) Error() string {
+	return e.msg
+}
+
+// userForIdentity finds the user linked to an identity, falling back to a verified email match or a new account
+func (h *Handler) userForIdentity(ctx context.Context, identity *auth.Identity) (*models.User, error) {
+	user, err := h.DB.GetUserByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return user, h.DB.LinkIdentity(ctx, user.ID, identity.Issuer, identity.Subject, identity.Email)
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		return nil, err
+	}
+
+	// Only verified emails may be used to claim an existing account
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, &identityError{msg: "Email not verified by identity provider"}
+	}
+
+	user, err = h.DB.GetUserByEmail(ctx, identity.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		username, err := h.availableUsername(ctx, identity)
+		if err != nil {
+			return nil, err
+		}
+		user, err = h.DB.CreateExternalUser(ctx, username, identity.Email)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := h.DB.LinkIdentity(ctx, user.ID, identity.Issuer, identity.Subject, identity.Email); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// availableUsername derives a username from the identity, adding a numeric suffix on collisions
+func (h *Handler) availableUsername(ctx context.Context, identity *auth.Identity) (string, error) {
+	base := strings.TrimSpace(identity.Name)
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = strings.ReplaceAll(base, " ", "")
+	if base == "" {
+		base = "user"
+	}
+
+	candidate := base
+	for i := 2; i < 100; i++ {
+		exists, err := h.DB.UsernameExists(ctx, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+	return "", fmt.Errorf("no available username for %q", base)
+}
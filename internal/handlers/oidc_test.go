@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cinerank/internal/auth"
+)
+
+// fakeProvider hands out a fixed identity for any authorization code
+type fakeProvider struct {
+	identity auth.Identity
+}
+
+func (p *fakeProvider) Name() string { return "Fake" }
+
+func (p *fakeProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	return "https://idp.example.com/authorize?state=" + state, nil
+}
+
+func (p *fakeProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*auth.Identity, error) {
+	identity := p.identity
+	return &identity, nil
+}
+
+// startOIDCLogin begins an external login and returns the state cookie
+func (f *fixture) startOIDCLogin(t *testing.T) *http.Cookie {
+	t.Helper()
+	rec := f.serve(httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("oidc login: status = %d", rec.Code)
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "oidc_state" {
+			return c
+		}
+	}
+	t.Fatal("oidc login did not set an oidc_state cookie")
+	return nil
+}
+
+// oidcCallback returns from the identity provider with the given state
+func (f *fixture) oidcCallback(cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?code=code&state="+cookie.Value, nil)
+	req.AddCookie(cookie)
+	return f.serve(req)
+}
+
+// signedInUserID is the user of the session a response started, or 0
+func (f *fixture) signedInUserID(rec *httptest.ResponseRecorder) int {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "session_id" {
+			return f.h.Sessions[c.Value].UserID
+		}
+	}
+	return 0
+}
+
+func TestOIDCCallbackChecksTheState(t *testing.T) {
+	f := newFixture(t)
+	f.h.IdentityProvider = &fakeProvider{identity: auth.Identity{Issuer: "https://idp.example.com", Subject: "1", Email: f.user.Email, EmailVerified: true}}
+
+	if rec := f.oidcCallback(&http.Cookie{Name: "oidc_state", Value: "unknown"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown state: status = %d", rec.Code)
+	}
+
+	cookie := f.startOIDCLogin(t)
+	f.h.OIDCStates[cookie.Value] = OIDCState{ExpiresAt: time.Now().Add(-time.Minute)}
+	if rec := f.oidcCallback(cookie); rec.Code != http.StatusBadRequest || f.signedInUserID(rec) != 0 {
+		t.Errorf("expired state: status = %d", rec.Code)
+	}
+
+	cookie = f.startOIDCLogin(t)
+	if rec := f.oidcCallback(cookie); rec.Code != http.StatusSeeOther || f.signedInUserID(rec) != f.user.ID {
+		t.Fatalf("first use: status = %d", rec.Code)
+	}
+	if rec := f.oidcCallback(cookie); rec.Code != http.StatusBadRequest || f.signedInUserID(rec) != 0 {
+		t.Errorf("reused state: status = %d", rec.Code)
+	}
+}
+
+func TestStartingAnOIDCLoginSweepsExpiredStates(t *testing.T) {
+	f := newFixture(t)
+	f.h.IdentityProvider = &fakeProvider{}
+	f.h.OIDCStates["abandoned"] = OIDCState{ExpiresAt: time.Now().Add(-time.Minute)}
+
+	cookie := f.startOIDCLogin(t)
+	if _, ok := f.h.OIDCStates["abandoned"]; ok {
+		t.Error("expired state was kept")
+	}
+	if _, ok := f.h.OIDCStates[cookie.Value]; !ok || len(f.h.OIDCStates) != 1 {
+		t.Errorf("states = %v", f.h.OIDCStates)
+	}
+}
+
+func TestOIDCCallbackResolvesTheUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		identity auth.Identity
+		// want is the signed in user: "user" for the fixture's user, "new" for a created one, "" for none
+		want string
+	}{
+		{"verified email claims the account", auth.Identity{Subject: "claim", Email: "buff@example.com", EmailVerified: true}, "user"},
+		{"unverified email does not claim it", auth.Identity{Subject: "unverified", Email: "buff@example.com"}, ""},
+		{"new identity creates a user", auth.Identity{Subject: "new", Email: "nova@example.com", EmailVerified: true, Name: "Nova Pessoa"}, "new"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			tt.identity.Issuer = "https://idp.example.com"
+			f.h.IdentityProvider = &fakeProvider{identity: tt.identity}
+
+			rec := f.oidcCallback(f.startOIDCLogin(t))
+			id := f.signedInUserID(rec)
+			switch tt.want {
+			case "user":
+				if id != f.user.ID {
+					t.Errorf("status = %d, signed in as %d", rec.Code, id)
+				}
+			case "new":
+				u, err := f.store.GetUserByEmail(t.Context(), tt.identity.Email)
+				if err != nil || id != u.ID || u.Username != "NovaPessoa" {
+					t.Errorf("status = %d, signed in as %d, user = %+v (%v)", rec.Code, id, u, err)
+				}
+			default:
+				if rec.Code != http.StatusForbidden || id != 0 {
+					t.Errorf("status = %d, signed in as %d", rec.Code, id)
+				}
+			}
+			if _, err := f.store.GetUserByIdentity(t.Context(), tt.identity.Issuer, tt.identity.Subject); (err == nil) != (tt.want != "") {
+				t.Errorf("identity linked = %v", err == nil)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackSignsInLinkedIdentities(t *testing.T) {
+	f := newFixture(t)
+	if err := f.store.LinkIdentity(t.Context(), f.user.ID, "https://idp.example.com", "linked", f.user.Email); err != nil {
+		t.Fatal(err)
+	}
+	// A linked identity signs in even though its email is unverified and no longer matches
+	f.h.IdentityProvider = &fakeProvider{identity: auth.Identity{Issuer: "https://idp.example.com", Subject: "linked", Email: "outro@example.com"}}
+
+	rec := f.oidcCallback(f.startOIDCLogin(t))
+	if id := f.signedInUserID(rec); rec.Code != http.StatusSeeOther || id != f.user.ID {
+		t.Errorf("status = %d, signed in as %d", rec.Code, id)
+	}
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cinerank/internal/database"
+	"cinerank/internal/models"
+	"cinerank/internal/openapi"
+)
+
+func loadSpec(t *testing.T) *openapi.Document {
+	t.Helper()
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// assertConforms checks a recorded response against the operation documented for method and the request path
+func assertConforms(t *testing.T, doc *openapi.Document, method string, req *http.Request, rec *httptest.ResponseRecorder, wantStatus int) {
+	t.Helper()
+	if rec.Code != wantStatus {
+		t.Fatalf("%s %s: status = %d, want %d (body %s)", req.Method, req.URL.Path, rec.Code, wantStatus, rec.Body.String())
+	}
+	if err := doc.ValidateResponse(method, req.URL.Path, rec.Code, rec.Header().Get("Content-Type"), rec.Body.Bytes()); err != nil {
+		t.Errorf("%s %s: %v", req.Method, req.URL.Path, err)
+	}
+}
+
+func TestSpecOperationsAreRouted(t *testing.T) {
+	doc := loadSpec(t)
+	for _, op := range doc.Operations() {
+		if !strings.HasPrefix(op.Path, "/api/") {
+			t.Errorf("%s %s: documented path outside /api", op.Method, op.Path)
+		}
+		if len(op.Responses) == 0 {
+			t.Errorf("%s %s: no responses documented", op.Method, op.Path)
+		}
+	}
+	for _, schema := range []string{"Movie", "MovieWithStats", "Review", "User", "Problem"} {
+		if _, ok := doc.Components.Schemas[schema]; !ok {
+			t.Errorf("schema %s missing from components", schema)
+		}
+	}
+}
+
+func TestAPIErrorResponsesConformToSpec(t *testing.T) {
+	doc := loadSpec(t)
+	routes := (&Handler{}).Routes()
+
+	tests := []struct {
+		name   string
+		method string // documented operation the response belongs to
+		req    *http.Request
+		status int
+	}{
+		{
+			name:   "movie invalid id",
+			method: http.MethodGet,
+			req:    httptest.NewRequest(http.MethodGet, "/api/movies/abc", nil),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "movie method not allowed",
+			method: http.MethodGet,
+			req:    httptest.NewRequest(http.MethodDelete, "/api/movies/1", nil),
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "create movie invalid json",
+			method: http.MethodPost,
+			req:    httptest.NewRequest(http.MethodPost, "/api/movies", strings.NewReader("{")),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "create movie validation",
+			method: http.MethodPost,
+			req:    httptest.NewRequest(http.MethodPost, "/api/movies", strings.NewReader(`{"title":"","year":1700,"poster_url":"ftp://x"}`)),
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "create movie method not allowed",
+			method: http.MethodPost,
+			req:    httptest.NewRequest(http.MethodPut, "/api/movies", nil),
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "reviews invalid movie id",
+			method: http.MethodGet,
+			req:    httptest.NewRequest(http.MethodGet, "/api/reviews?movie_id=x", nil),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "create review invalid json",
+			method: http.MethodPost,
+			req:    httptest.NewRequest(http.MethodPost, "/api/reviews", strings.NewReader("[]")),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "create review validation",
+			method: http.MethodPost,
+			req:    httptest.NewRequest(http.MethodPost, "/api/reviews", strings.NewReader(`{"movie_id":1,"rating":9}`)),
+			status: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			routes.ServeHTTP(rec, tt.req)
+			assertConforms(t, doc, tt.method, tt.req, rec, tt.status)
+		})
+	}
+}
+
+func TestAPIDatabaseErrorsConformToSpec(t *testing.T) {
+	doc := loadSpec(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		err    error
+		status int
+	}{
+		{"not found", http.MethodGet, "/api/movies/42", &database.Error{Kind: database.ErrNotFound, Entity: "movie"}, http.StatusNotFound},
+		{"conflict", http.MethodPost, "/api/movies", &database.Error{Kind: database.ErrConflict, Entity: "movie"}, http.StatusConflict},
+		{"constraint", http.MethodPost, "/api/reviews", &database.Error{Kind: database.ErrConstraint, Entity: "review", Constraint: "reviews_movie_id_fkey"}, http.StatusUnprocessableEntity},
+		{"timeout", http.MethodGet, "/api/movies", &database.Error{Kind: database.ErrTimeout, Entity: "movie"}, http.StatusServiceUnavailable},
+		{"internal", http.MethodGet, "/api/movies", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			rec := httptest.NewRecorder()
+			writeAPIError(rec, req, tt.err)
+			assertConforms(t, doc, tt.method, req, rec, tt.status)
+		})
+	}
+}
+
+func TestOpenAPISpecEndpoint(t *testing.T) {
+	doc := loadSpec(t)
+	h := &Handler{}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	h.APIOpenAPISpec(rec, req)
+	assertConforms(t, doc, http.MethodGet, req, rec, http.StatusOK)
+
+	var served map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	if served["openapi"] != "3.1.0" {
+		t.Errorf("openapi version = %v", served["openapi"])
+	}
+}
+
+// The success payloads need a database, so the models they encode are checked against the schemas directly
+func TestModelsConformToSchemas(t *testing.T) {
+	doc := loadSpec(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	movie := models.Movie{
+		ID:         1,
+		Title:      "Cidade de Deus",
+		Director:   "Fernando Meirelles",
+		Year:       2002,
+		Plot:       "Rio de Janeiro",
+		PosterURL:  "https://example.com/poster.jpg",
+		IMDBRating: 8.6,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Tags:       []string{"crime", "drama"},
+	}
+	difference := 0.4
+	user := models.User{ID: 2, Username: "ana", Email: "ana@example.com", Role: "user", CreatedAt: now, UpdatedAt: now}
+
+	samples := []struct {
+		schema string
+		value  interface{}
+	}{
+		{"Movie", movie},
+		{"Movie", models.Movie{ID: 3, Title: "Sem tags", Year: 1999, CreatedAt: now, UpdatedAt: now}},
+		{"MovieWithStats", models.MovieWithStats{Movie: movie, ReviewCount: 3, AverageRating: 4.33}},
+		{"User", user},
+		{"Review", models.Review{
+			ID: 5, MovieID: 1, UserID: 2, Rating: 5, Title: "Obra-prima", Content: "...",
+			SubRatings: map[string]int{models.DimensionStory: 5, models.DimensionSoundtrack: 4},
+			CreatedAt:  now, UpdatedAt: now,
+			Movie: &models.Movie{Title: movie.Title},
+			User:  &models.User{Username: user.Username},
+		}},
+		{"Tag", models.Tag{ID: 1, Name: "drama"}},
+		{"MovieStats", models.MovieStatsReport{
+			MovieID: 1, ReviewCount: 2, AverageRating: 4.5, MedianRating: 4.5, RatingStdDev: 0.5,
+			Histogram: [5]int{0, 0, 0, 1, 1}, LastReviewedAt: &now, IMDBRating: 8.6, IMDBDifference: &difference,
+			ReviewsByMonth: []models.MonthlyCount{{Month: now, Count: 2}},
+			SubRatings:     []models.SubRatingAverage{{Dimension: models.DimensionActing, ReviewCount: 1, AverageRating: 5}},
+		}},
+	}
+
+	for _, s := range samples {
+		t.Run(s.schema, func(t *testing.T) {
+			schema, ok := doc.Components.Schemas[s.schema]
+			if !ok {
+				t.Fatalf("schema %s not found", s.schema)
+			}
+			data, err := json.Marshal(s.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var value interface{}
+			if err := json.Unmarshal(data, &value); err != nil {
+				t.Fatal(err)
+			}
+			if err := doc.ValidateValue(schema, value, "$"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
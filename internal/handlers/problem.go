@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"cinerank/internal/database"
+	"cinerank/internal/logging"
+	"cinerank/internal/validation"
+)
+
+// Stable problem codes returned by the JSON API; clients can branch on these
+const (
+	CodeBadRequest          = "bad_request"
+	CodeInvalidJSON         = "invalid_json"
+	CodeInvalidID           = "invalid_id"
+	CodeValidationFailed    = "validation_failed"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeConstraintViolation = "constraint_violation"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeTimeout             = "timeout"
+	CodeInternal            = "internal_error"
+)
+
+// statusClientClosedRequest is nginx's status for a request the client abandoned; nobody reads
+// the response, but it keeps cancellations apart from failures in access logs
+const statusClientClosedRequest = 499
+
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body with a machine-readable code extension
+type Problem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Code     string            `json:"code"`
+	Errors   validation.Errors `json:"errors,omitempty"`
+}
+
+func newProblem(r *http.Request, status int, code, detail string) Problem {
+	return Problem{
+		Type:     "/problems/" + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	}
+}
+
+func writeProblemBody(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Helper to write a problem+json response
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	writeProblemBody(w, newProblem(r, status, code, detail))
+}
+
+// Helper to map validation and database errors onto problem+json responses
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErrs validation.Errors
+	var dbErr *database.Error
+
+	switch {
+	case errors.As(err, &validationErrs):
+		p := newProblem(r, http.StatusUnprocessableEntity, CodeValidationFailed, "The request contains invalid fields")
+		p.Errors = validationErrs
+		writeProblemBody(w, p)
+	case errors.Is(err, database.ErrNotFound):
+		detail := "Resource not found"
+		if errors.As(err, &dbErr) {
+			detail = "The requested " + dbErr.Entity + " does not exist"
+		}
+		writeProblem(w, r, http.StatusNotFound, CodeNotFound, detail)
+	case errors.Is(err, database.ErrConflict):
+		detail := "Resource already exists"
+		if errors.As(err, &dbErr) {
+			detail = "A " + dbErr.Entity + " with the same unique fields already exists"
+		}
+		writeProblem(w, r, http.StatusConflict, CodeConflict, detail)
+	case errors.Is(err, database.ErrConstraint):
+		detail := "The request references data that does not exist or is not allowed"
+		if errors.As(err, &dbErr) && dbErr.Constraint != "" {
+			detail += " (" + dbErr.Constraint + ")"
+		}
+		writeProblem(w, r, http.StatusUnprocessableEntity, CodeConstraintViolation, detail)
+	case errors.Is(err, database.ErrCanceled):
+		w.WriteHeader(statusClientClosedRequest)
+	case errors.Is(err, database.ErrTimeout):
+		writeProblem(w, r, http.StatusServiceUnavailable, CodeTimeout, "The request took too long to complete; try again later")
+	default:
+		logging.FromContext(r.Context()).Error("API error", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "An unexpected error occurred")
+	}
+}
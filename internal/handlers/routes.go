@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"cinerank/internal/models"
+)
+
+// Access is who may use a route
+type Access int
+
+const (
+	Public Access = iota
+	SignedIn
+	// Admin also demands two-factor authentication when the admin 2FA setting is on
+	Admin
+)
+
+type Route struct {
+	// Pattern is a ServeMux pattern such as "GET /movie/{id}"
+	Pattern string
+	Access  Access
+	Handler http.HandlerFunc
+}
+
+// routes declares every endpoint the handler serves
+func (h *Handler) routes() []Route {
+	return []Route{
+		// HTML pages
+		{"GET /{$}", Public, h.HomePage},
+		{"GET /search", Public, h.SearchMovies},
+		{"GET /movie/{id}", Public, h.MoviePage},
+		{"GET /movie/{id}/stats", Public, h.MovieStatsPanel},
+		{"GET /add-movie", SignedIn, h.AddMovieForm},
+		{"POST /movies", SignedIn, h.CreateMovie},
+		{"GET /review-form", SignedIn, h.AddReviewForm},
+		{"POST /reviews", SignedIn, h.CreateReview},
+		{"GET /events/reviews", Public, h.ReviewEvents},
+		{"GET /events/movie/{id}", Public, h.MovieEvents},
+
+		// Sign-in and account
+		{"GET /login", Public, h.LoginForm},
+		{"POST /login", Public, h.Login},
+		{"GET /login/2fa", Public, h.LoginTwoFactorForm},
+		{"POST /login/2fa", Public, h.LoginTwoFactor},
+		{"GET /auth/oidc/login", Public, h.OIDCLogin},
+		{"GET /auth/oidc/callback", Public, h.OIDCCallback},
+		{"POST /logout", Public, h.Logout},
+		{"GET /register", Public, h.RegisterForm},
+		{"POST /register", Public, h.Register},
+		{"GET /account/2fa", SignedIn, h.TwoFactorPage},
+		{"POST /account/2fa/setup", SignedIn, h.StartTwoFactorSetup},
+		{"POST /account/2fa/enable", SignedIn, h.EnableTwoFactor},
+		{"POST /account/2fa/disable", SignedIn, h.DisableTwoFactor},
+		{"POST /account/2fa/recovery-codes", SignedIn, h.RegenerateRecoveryCodes},
+
+		// Administration
+		{"GET /admin", Admin, h.AdminPanel},
+		{"POST /admin/settings", Admin, h.UpdateAdminSettings},
+		{"POST /admin/rating-dimensions", Admin, h.UpdateRatingDimensions},
+		{"POST /admin/delete-user/{id}", Admin, h.DeleteUser},
+		{"POST /admin/delete-movie/{id}", Admin, h.DeleteMovie},
+		{"GET /admin/analytics", Admin, h.AdminAnalytics},
+		{"GET /admin/analytics/export/{section}", Admin, h.ExportAnalytics},
+		{"GET /admin/webhooks", Admin, h.AdminWebhooks},
+		{"POST /admin/webhooks", Admin, h.CreateWebhook},
+		{"POST /admin/webhooks/{id}/toggle", Admin, h.ToggleWebhook},
+		{"POST /admin/webhooks/{id}/delete", Admin, h.DeleteWebhook},
+
+		// API v1
+		{"GET /api/v1/movies", Public, h.APIV1ListMovies},
+		{"POST /api/v1/movies", SignedIn, h.APIV1CreateMovie},
+		{"GET /api/v1/movies/{id}", Public, h.APIV1GetMovie},
+		{"PUT /api/v1/movies/{id}", Admin, h.APIV1UpdateMovie},
+		{"PATCH /api/v1/movies/{id}", Admin, h.APIV1UpdateMovie},
+		{"DELETE /api/v1/movies/{id}", Admin, h.APIV1DeleteMovie},
+		{"GET /api/v1/movies/{id}/reviews", Public, h.APIV1ListMovieReviews},
+		{"GET /api/v1/movies/{id}/stats", Public, h.APIV1GetMovieStats},
+		{"GET /api/v1/reviews", Public, h.APIV1ListReviews},
+		{"POST /api/v1/reviews", SignedIn, h.APIV1CreateReview},
+		{"GET /api/v1/reviews/{id}", Public, h.APIV1GetReview},
+		{"PUT /api/v1/reviews/{id}", SignedIn, h.APIV1UpdateReview},
+		{"PATCH /api/v1/reviews/{id}", SignedIn, h.APIV1UpdateReview},
+		{"DELETE /api/v1/reviews/{id}", SignedIn, h.APIV1DeleteReview},
+		{"GET /api/v1/tags", Public, h.APIV1ListTags},
+		{"POST /api/v1/tags", Admin, h.APIV1CreateTag},
+		{"GET /api/v1/tags/{id}", Public, h.APIV1GetTag},
+		{"PUT /api/v1/tags/{id}", Admin, h.APIV1UpdateTag},
+		{"PATCH /api/v1/tags/{id}", Admin, h.APIV1UpdateTag},
+		{"DELETE /api/v1/tags/{id}", Admin, h.APIV1DeleteTag},
+		{"GET /api/v1/users", Admin, h.APIV1ListUsers},
+		{"POST /api/v1/users", Admin, h.APIV1CreateUser},
+		// Users may read themselves; APIV1GetUser asks for Admin to read anyone else
+		{"GET /api/v1/users/{id}", SignedIn, h.APIV1GetUser},
+		{"PUT /api/v1/users/{id}", Admin, h.APIV1UpdateUser},
+		{"PATCH /api/v1/users/{id}", Admin, h.APIV1UpdateUser},
+		{"DELETE /api/v1/users/{id}", Admin, h.APIV1DeleteUser},
+
+		// Legacy API, kept unchanged until clients move to /api/v1
+		{"GET /api/movies", Public, Deprecated(h.APIGetMovies)},
+		{"POST /api/movies", Public, Deprecated(h.APICreateMovie)},
+		{"GET /api/movies/{id}", Public, Deprecated(h.APIGetMovie)},
+		{"GET /api/reviews", Public, Deprecated(h.APIGetReviews)},
+		{"POST /api/reviews", Public, Deprecated(h.APICreateReview)},
+
+		{"POST /graphql", Public, h.GraphQL},
+
+		// API documentation
+		{"GET /api/openapi.json", Public, h.APIOpenAPISpec},
+		{"GET /api/docs", Public, h.APIDocs},
+
+		// Probes
+		{"GET /healthz", Public, h.Healthz},
+		{"GET /readyz", Public, h.Readyz},
+	}
+}
+
+// Routes returns a mux serving every route, plus extra ones such as static files, each behind its
+// access check. The mux decides when to answer 404 for unknown paths and 405 for other methods.
+func (h *Handler) Routes(extra ...Route) http.Handler {
+	mux := http.NewServeMux()
+	for _, route := range append(h.routes(), extra...) {
+		mux.Handle(route.Pattern, h.guard(route.Access, route.Handler))
+	}
+	return errorPages(mux)
+}
+
+type userKey struct{}
+
+// currentUser returns the signed-in user, or nil on public routes when nobody is signed in
+func currentUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userKey{}).(*models.User)
+	return user
+}
+
+// guard loads the signed-in user for next and turns away requests access does not allow
+func (h *Handler) guard(access Access, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := h.sessionUser(r)
+		if err != nil {
+			h.deny(w, r, denial{err: err})
+			return
+		}
+		// Stored before the check so error pages for denied requests still show who is signed in
+		r = r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+		if !h.authorize(w, r, user, access) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+type denialReason int
+
+const (
+	signInRequired denialReason = iota + 1
+	adminRequired
+	twoFactorRequired
+)
+
+// denial is why a request was turned away: a reason, or the error that stopped the check
+type denial struct {
+	reason denialReason
+	err    error
+}
+
+// authorize reports whether user, possibly nil, has access, answering the request when they do not
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, user *models.User, access Access) bool {
+	if access == Public {
+		return true
+	}
+	if user == nil {
+		h.deny(w, r, denial{reason: signInRequired})
+		return false
+	}
+	if access == SignedIn {
+		return true
+	}
+	if user.Role != "admin" {
+		h.deny(w, r, denial{reason: adminRequired})
+		return false
+	}
+
+	if !user.TOTPEnabled {
+		required, err := h.DB.RequireAdmin2FA(r.Context())
+		if err != nil {
+			h.deny(w, r, denial{err: err})
+			return false
+		}
+		if required {
+			h.deny(w, r, denial{reason: twoFactorRequired})
+			return false
+		}
+	}
+	return true
+}
+
+// deny answers API requests with a problem and page requests with a redirect or error page
+func (h *Handler) deny(w http.ResponseWriter, r *http.Request, d denial) {
+	if wantsJSON(r) {
+		switch d.reason {
+		case signInRequired:
+			writeProblem(w, r, http.StatusUnauthorized, CodeUnauthorized, "Sign in to use this endpoint")
+		case adminRequired:
+			writeProblem(w, r, http.StatusForbidden, CodeForbidden, "This endpoint requires an admin account")
+		case twoFactorRequired:
+			writeProblem(w, r, http.StatusForbidden, CodeForbidden, "Enable two-factor authentication to use admin endpoints")
+		default:
+			writeAPIError(w, r, d.err)
+		}
+		return
+	}
+
+	switch d.reason {
+	case signInRequired:
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	case adminRequired:
+		httpError(w, r, "This page requires an admin account", http.StatusForbidden)
+	case twoFactorRequired:
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+	default:
+		dbError(w, r, "Error checking access", d.err)
+	}
+}
+
+// apiPath reports whether path belongs to the JSON API, whose errors are problems rather than pages
+func apiPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || path == "/graphql"
+}
+
+// errorPages lets the mux decide 404s and 405s, but answers them like any other error instead of
+// with the mux's plain text
+func errorPages(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		verdict := &headerRecorder{header: http.Header{}}
+		mux.ServeHTTP(verdict, r)
+		if verdict.status == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", verdict.header.Get("Allow"))
+			httpError(w, r, r.Method+" is not supported on this endpoint", http.StatusMethodNotAllowed)
+			return
+		}
+		httpError(w, r, "There is no endpoint at "+r.URL.Path, http.StatusNotFound)
+	})
+}
+
+// headerRecorder keeps the status and headers written through it and drops the body
+type headerRecorder struct {
+	header http.Header
+	status int
+}
+
+func (rec *headerRecorder) Header() http.Header { return rec.header }
+
+func (rec *headerRecorder) Write(b []byte) (int, error) { return len(b), nil }
+
+func (rec *headerRecorder) WriteHeader(status int) { rec.status = status }
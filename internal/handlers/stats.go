@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"cinerank/internal/models"
+)
+
+// statsMonths is how many months of reviews the stats panel and API chart
+const statsMonths = 12
+
+// movieStatsReport details movie's ratings from its stored stats, charting reviews by month up
+// to the month of now and averaging the enabled sub-ratings
+func (h *Handler) movieStatsReport(ctx context.Context, movie *models.Movie, now time.Time) (*models.MovieStatsReport, error) {
+	stats, err := h.DB.GetMovieStats(ctx, movie.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now = now.UTC()
+	first := time.Date(now.Year(), now.Month()-statsMonths+1, 1, 0, 0, 0, 0, time.UTC)
+	counts, err := h.DB.GetReviewCountsByMonth(ctx, movie.ID, first)
+	if err != nil {
+		return nil, err
+	}
+
+	dimensions, err := h.DB.RatingDimensions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subRatings, err := h.DB.GetSubRatingAverages(ctx, movie.ID, dimensions)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.MovieStatsReport{
+		MovieID:        movie.ID,
+		ReviewCount:    stats.ReviewCount,
+		AverageRating:  stats.AverageRating(),
+		MedianRating:   stats.MedianRating(),
+		RatingStdDev:   stats.RatingStdDev(),
+		Histogram:      stats.Histogram,
+		LastReviewedAt: stats.LastReviewedAt,
+		IMDBRating:     movie.IMDBRating,
+		SubRatings:     subRatings,
+	}
+	if movie.IMDBRating > 0 && stats.ReviewCount > 0 {
+		difference := 2*report.AverageRating - movie.IMDBRating
+		report.IMDBDifference = &difference
+	}
+
+	// Months without reviews are missing from counts and chart as zero
+	byMonth := make(map[time.Time]int, len(counts))
+	for _, c := range counts {
+		byMonth[c.Month] = c.Count
+	}
+	for i := 0; i < statsMonths; i++ {
+		month := first.AddDate(0, i, 0)
+		report.ReviewsByMonth = append(report.ReviewsByMonth, models.MonthlyCount{Month: month, Count: byMonth[month]})
+	}
+
+	return report, nil
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cinerank/internal/models"
+)
+
+func TestAPIV1MovieStats(t *testing.T) {
+	f := newFixture(t)
+	movie, err := f.store.CreateMovie(t.Context(), models.CreateMovieRequest{Title: "Cidade de Deus", Director: "Meirelles", Year: 2002, IMDBRating: 8.6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	critic := f.createUser(t, "Critica", "critica@example.com", "user", "critic-session")
+	for _, r := range []struct{ userID, rating int }{{f.user.ID, 5}, {f.admin.ID, 4}, {critic.ID, 2}} {
+		f.createReview(t, movie.ID, r.userID, r.rating, "ok")
+	}
+
+	rec := f.serve(httptest.NewRequest(http.MethodGet, "/api/v1/movies/1/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	var got models.MovieStatsReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ReviewCount != 3 || got.Histogram != [5]int{0, 1, 0, 1, 1} || got.MedianRating != 4 {
+		t.Errorf("count = %d, histogram = %v, median = %v", got.ReviewCount, got.Histogram, got.MedianRating)
+	}
+	if want := math.Sqrt(14.0 / 9); math.Abs(got.RatingStdDev-want) > 1e-9 {
+		t.Errorf("stddev = %v, want %v", got.RatingStdDev, want)
+	}
+	if got.IMDBDifference == nil || math.Abs(*got.IMDBDifference-(22.0/3-8.6)) > 1e-9 {
+		t.Errorf("IMDb difference = %v", got.IMDBDifference)
+	}
+
+	// Twelve months up to this one, with this month's reviews last
+	months := got.ReviewsByMonth
+	now := time.Now().UTC()
+	if len(months) != 12 || months[11].Count != 3 || months[11].Month.Month() != now.Month() || months[0].Count != 0 {
+		t.Errorf("reviews by month = %+v", months)
+	}
+
+	if rec := f.serve(httptest.NewRequest(http.MethodGet, "/api/v1/movies/99/stats", nil)); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown movie: status = %d", rec.Code)
+	}
+}
+
+func TestMoviePageShowsStatsPanel(t *testing.T) {
+	f := newFixture(t)
+	movie := f.createMovie(t, "Cidade de Deus")
+
+	body := f.serve(httptest.NewRequest(http.MethodGet, "/movie/1/stats", nil)).Body.String()
+	if !strings.Contains(body, "Sem avaliações para calcular estatísticas") {
+		t.Errorf("panel without reviews = %s", body)
+	}
+
+	f.createReview(t, movie.ID, f.user.ID, 4, "Muito bom")
+	f.createReview(t, movie.ID, f.admin.ID, 2, "Fraco")
+	for _, path := range []string{"/movie/1", "/movie/1/stats"} {
+		body := f.serve(httptest.NewRequest(http.MethodGet, path, nil)).Body.String()
+		for _, want := range []string{"Mediana", "3.0", "Desvio padrão", "1.00", "2 avaliações nos últimos 12 meses", "<polyline"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: missing %q", path, want)
+			}
+		}
+		// The movie has no IMDb rating to compare with
+		if strings.Contains(body, "IMDb") {
+			t.Errorf("%s: shows an IMDb comparison", path)
+		}
+	}
+
+	if rec := f.serve(httptest.NewRequest(http.MethodGet, "/movie/99/stats", nil)); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown movie: status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"cinerank/internal/database"
+	"cinerank/internal/models"
+)
+
+// formSubRatings reads the sub-rating selects of the review form; the ones left blank read as 0
+func formSubRatings(form url.Values, dimensions []string) map[string]int {
+	ratings := make(map[string]int, len(dimensions))
+	for _, d := range dimensions {
+		ratings[d], _ = strconv.Atoi(form.Get("sub_ratings." + d))
+	}
+	return ratings
+}
+
+// Choose which rating dimensions reviews may rate (admin)
+func (h *Handler) UpdateRatingDimensions(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		httpError(w, r, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	var enabled []string
+	for _, d := range models.RatingDimensions {
+		if slices.Contains(r.Form["dimension"], d) {
+			enabled = append(enabled, d)
+		}
+	}
+
+	if err := h.DB.SetSetting(r.Context(), database.SettingRatingDimensions, strings.Join(enabled, ",")); err != nil {
+		dbError(w, r, "Error updating settings", err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"cinerank/internal/database"
+	"cinerank/internal/models"
+)
+
+func TestReviewFormSubRatings(t *testing.T) {
+	f := newFixture(t)
+	movie := f.createMovie(t, "Cidade de Deus")
+
+	rec := f.serve(withSession(httptest.NewRequest(http.MethodGet, "/review-form?movie_id=1", nil), userSession))
+	if !strings.Contains(rec.Body.String(), `name="sub_ratings.story"`) || !strings.Contains(rec.Body.String(), "Vale rever") {
+		t.Errorf("review form missing sub-ratings: %s", rec.Body)
+	}
+
+	form := url.Values{
+		"movie_id": {"1"}, "rating": {"5"}, "title": {"Imperdível"},
+		"sub_ratings.story": {"9"}, "sub_ratings.acting": {""},
+	}
+	rec = f.serve(withSession(postForm("/reviews", form), userSession))
+	if !strings.Contains(rec.Body.String(), "must be between 1 and 5") {
+		t.Errorf("out of range sub-rating: body = %s", rec.Body)
+	}
+
+	form.Set("sub_ratings.story", "4")
+	rec = f.serve(withSession(postForm("/reviews", form), userSession))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Roteiro: 4/5") || strings.Contains(rec.Body.String(), "Atuações") {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	reviews, _ := f.store.GetReviewsByMovieID(t.Context(), movie.ID)
+	if len(reviews) != 1 || len(reviews[0].SubRatings) != 1 || reviews[0].SubRatings[models.DimensionStory] != 4 {
+		t.Errorf("reviews = %+v", reviews)
+	}
+
+	// Only the checked dimensions stay enabled
+	rec = f.serve(withSession(postForm("/admin/rating-dimensions", url.Values{"dimension": {"acting", "soundtrack", "plot"}}), adminSession))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("update dimensions: status = %d", rec.Code)
+	}
+	if got, _ := f.store.RatingDimensions(t.Context()); strings.Join(got, ",") != "acting,soundtrack" {
+		t.Errorf("enabled dimensions = %q", got)
+	}
+	rec = f.serve(withSession(httptest.NewRequest(http.MethodGet, "/review-form?movie_id=1", nil), userSession))
+	if strings.Contains(rec.Body.String(), `name="sub_ratings.story"`) || !strings.Contains(rec.Body.String(), `name="sub_ratings.acting"`) {
+		t.Errorf("review form shows disabled dimensions: %s", rec.Body)
+	}
+
+	if rec := f.serve(withSession(postForm("/admin/rating-dimensions", url.Values{}), userSession)); rec.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d", rec.Code)
+	}
+}
+
+func TestAPIV1ReviewSubRatings(t *testing.T) {
+	f := newFixture(t)
+	f.createMovie(t, "Cidade de Deus")
+
+	send := func(method, path, body, session string) *httptest.ResponseRecorder {
+		t.Helper()
+		return f.serve(withSession(httptest.NewRequest(method, path, strings.NewReader(body)), session))
+	}
+	subRatings := func(rec *httptest.ResponseRecorder) map[string]int {
+		t.Helper()
+		if rec.Code != http.StatusOK && rec.Code != http.StatusCreated {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+		}
+		var review models.Review
+		if err := json.Unmarshal(rec.Body.Bytes(), &review); err != nil {
+			t.Fatal(err)
+		}
+		return review.SubRatings
+	}
+	averages := func() map[string]models.SubRatingAverage {
+		t.Helper()
+		var report models.MovieStatsReport
+		rec := f.serve(httptest.NewRequest(http.MethodGet, "/api/v1/movies/1/stats", nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		byDimension := map[string]models.SubRatingAverage{}
+		for _, a := range report.SubRatings {
+			byDimension[a.Dimension] = a
+		}
+		return byDimension
+	}
+
+	got := subRatings(send(http.MethodPost, "/api/v1/reviews", `{"movie_id":1,"rating":4,"title":"Ótimo","sub_ratings":{"story":4,"acting":2,"soundtrack":0}}`, userSession))
+	if len(got) != 2 || got["story"] != 4 || got["acting"] != 2 {
+		t.Errorf("created sub-ratings = %v", got)
+	}
+	send(http.MethodPost, "/api/v1/reviews", `{"movie_id":1,"rating":2,"title":"Fraco","sub_ratings":{"story":2}}`, adminSession)
+	if a := averages(); a["story"].ReviewCount != 2 || a["story"].AverageRating != 3 || a["acting"].AverageRating != 2 || len(a) != 2 {
+		t.Errorf("averages = %+v", a)
+	}
+
+	if rec := send(http.MethodPost, "/api/v1/reviews", `{"movie_id":1,"rating":4,"title":"Ótimo","sub_ratings":{"plot":4}}`, userSession); rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "sub_ratings.plot") {
+		t.Errorf("unknown dimension: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	// PATCH merges sub-ratings and 0 clears one
+	got = subRatings(send(http.MethodPatch, "/api/v1/reviews/1", `{"sub_ratings":{"acting":5,"story":0}}`, userSession))
+	if len(got) != 1 || got["acting"] != 5 {
+		t.Errorf("patched sub-ratings = %v", got)
+	}
+
+	// Disabling a dimension hides its average, but reviews keep the ratings they have
+	if err := f.store.SetSetting(t.Context(), database.SettingRatingDimensions, "story"); err != nil {
+		t.Fatal(err)
+	}
+	if a := averages(); len(a) != 1 || a["story"].ReviewCount != 1 {
+		t.Errorf("averages after disabling acting = %+v", a)
+	}
+	got = subRatings(send(http.MethodPatch, "/api/v1/reviews/1", `{"rating":3}`, userSession))
+	if got["acting"] != 5 {
+		t.Errorf("sub-ratings after unrelated patch = %v", got)
+	}
+	if rec := send(http.MethodPatch, "/api/v1/reviews/1", `{"sub_ratings":{"acting":4}}`, userSession); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("disabled dimension: status = %d", rec.Code)
+	}
+
+	// PUT replaces them
+	got = subRatings(send(http.MethodPut, "/api/v1/reviews/1", `{"rating":3,"title":"Bom"}`, userSession))
+	if len(got) != 0 {
+		t.Errorf("sub-ratings after PUT = %v", got)
+	}
+	if review, _ := f.store.GetReviewByID(t.Context(), 1); len(review.SubRatings) != 0 {
+		t.Errorf("stored sub-ratings after PUT = %v", review.SubRatings)
+	}
+}
@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"cinerank/internal/auth"
+	"cinerank/internal/database"
+	"cinerank/internal/logging"
+	"cinerank/internal/metrics"
+	"cinerank/internal/models"
+	"cinerank/internal/ui"
+
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer      = "CineRank"
+	pendingLoginTTL = 5 * time.Minute
+	// maxSecondFactorFailures wrong codes end a pending login, so the password step must be passed again
+	maxSecondFactorFailures = 5
+)
+
+// PendingLogin is a login that passed the password check and waits for a 2FA code
+type PendingLogin struct {
+	UserID    int
+	ExpiresAt time.Time
+	Failures  int
+}
+
+// Two-factor settings page: enrollment for new users, status for enrolled ones
+func (h *Handler) TwoFactorPage(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	if user.TOTPEnabled {
+		remaining, err := h.DB.CountUnusedRecoveryCodes(r.Context(), user.ID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error counting recovery codes", "error", err)
+		}
+
+		if err := render(r.Context(), w, "TwoFactorStatus", ui.TwoFactorStatus(user, remaining)); err != nil {
+			httpError(w, r, "Error rendering page", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Enrollment starts with a POST, which stores the secret; until it is confirmed each visit shows that same secret
+	secret := user.TOTPSecret
+	if secret == "" {
+		if err := render(r.Context(), w, "TwoFactorStart", ui.TwoFactorStart(user)); err != nil {
+			httpError(w, r, "Error rendering page", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	uri := auth.ProvisioningURI(totpIssuer, user.Email, secret)
+	qrCode, err := auth.QRCodeDataURI(uri)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error rendering QR code", "error", err)
+	}
+
+	if err := render(r.Context(), w, "TwoFactorSetup", ui.TwoFactorSetup(user, secret, uri, qrCode)); err != nil {
+		httpError(w, r, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// Start (or restart) enrollment with a new secret
+func (h *Handler) StartTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	if user.TOTPEnabled {
+		httpError(w, r, "2FA is already enabled", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		httpError(w, r, "Error generating secret", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.DB.SetTOTPSecret(r.Context(), user.ID, secret); err != nil {
+		dbError(w, r, "Error starting 2FA setup", err)
+		return
+	}
+
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+// Confirm enrollment with a first code and hand out recovery codes
+func (h *Handler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	if err := r.ParseForm(); err != nil {
+		httpError(w, r, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	if user.TOTPEnabled {
+		httpError(w, r, "2FA is already enabled", http.StatusBadRequest)
+		return
+	}
+
+	ok, err := h.useTOTPCode(r.Context(), user, r.Form.Get("code"))
+	if err != nil {
+		dbError(w, r, "Error verifying code", err)
+		return
+	}
+	if !ok {
+		httpError(w, r, "Invalid verification code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		httpError(w, r, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.DB.EnableTOTP(r.Context(), user.ID, hashes); err != nil {
+		dbError(w, r, "Error enabling 2FA", err)
+		return
+	}
+
+	user.TOTPEnabled = true
+	if err := render(r.Context(), w, "RecoveryCodes", ui.RecoveryCodes(user, codes)); err != nil {
+		httpError(w, r, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// Turn 2FA off, which requires a current code or a recovery code
+func (h *Handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	if err := r.ParseForm(); err != nil {
+		httpError(w, r, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	if user.Role == "admin" {
+		required, err := h.DB.RequireAdmin2FA(r.Context())
+		if err != nil {
+			dbError(w, r, "Error checking 2FA requirement", err)
+			return
+		}
+		if required {
+			httpError(w, r, "2FA is required for admin accounts", http.StatusForbidden)
+			return
+		}
+	}
+
+	ok, err := h.verifySecondFactor(r.Context(), user, r.Form.Get("code"))
+	if err != nil {
+		dbError(w, r, "Error verifying code", err)
+		return
+	}
+	if !ok {
+		httpError(w, r, "Invalid verification code", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.DB.DisableTOTP(r.Context(), user.ID); err != nil {
+		dbError(w, r, "Error disabling 2FA", err)
+		return
+	}
+
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+// Replace all recovery codes after confirming a current TOTP code
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	if err := r.ParseForm(); err != nil {
+		httpError(w, r, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	if !user.TOTPEnabled {
+		httpError(w, r, "Invalid verification code", http.StatusBadRequest)
+		return
+	}
+	ok, err := h.useTOTPCode(r.Context(), user, r.Form.Get("code"))
+	if err != nil {
+		dbError(w, r, "Error verifying code", err)
+		return
+	}
+	if !ok {
+		httpError(w, r, "Invalid verification code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		httpError(w, r, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.DB.ReplaceRecoveryCodes(r.Context(), user.ID, hashes); err != nil {
+		dbError(w, r, "Error generating recovery codes", err)
+		return
+	}
+
+	if err := render(r.Context(), w, "RecoveryCodes", ui.RecoveryCodes(user, codes)); err != nil {
+		httpError(w, r, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// Second login step form
+func (h *Handler) LoginTwoFactorForm(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := h.pendingLogin(r); !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := render(r.Context(), w, "LoginTwoFactorForm", ui.LoginTwoFactorForm()); err != nil {
+		httpError(w, r, "Error rendering form", http.StatusInternalServerError)
+	}
+}
+
+// Second login step: exchange a pending login and a valid code for a session
+func (h *Handler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	pendingID, pending, ok := h.pendingLogin(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		httpError(w, r, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.DB.GetUserByID(r.Context(), pending.UserID)
+	if err != nil {
+		httpError(w, r, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	ok, err = h.verifySecondFactor(r.Context(), user, r.Form.Get("code"))
+	if err != nil {
+		dbError(w, r, "Error verifying code", err)
+		return
+	}
+	if !ok {
+		h.Metrics.LoginFailed(metrics.LoginBadSecondFactor)
+		if h.failPendingLogin(pendingID) {
+			clearPendingLoginCookie(w)
+			httpError(w, r, "Too many invalid verification codes, sign in again", http.StatusUnauthorized)
+			return
+		}
+		httpError(w, r, "Invalid verification code", http.StatusUnauthorized)
+		return
+	}
+
+	h.sessionsMu.Lock()
+	delete(h.PendingLogins, pendingID)
+	h.sessionsMu.Unlock()
+	clearPendingLoginCookie(w)
+
+	h.createSession(w, user.ID)
+	http.Redirect(w, r, h.postLoginRedirect(r.Context(), user), http.StatusSeeOther)
+}
+
+// Update site-wide security settings (admin)
+func (h *Handler) UpdateAdminSettings(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		httpError(w, r, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	value := "false"
+	if r.Form.Get(database.SettingRequireAdmin2FA) == "on" {
+		value = "true"
+	}
+
+	if err := h.DB.SetSetting(r.Context(), database.SettingRequireAdmin2FA, value); err != nil {
+		dbError(w, r, "Error updating settings", err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// Helper to finish a successful first factor login, deferring to the 2FA step when enabled
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User) {
+	if user.TOTPEnabled {
+		pendingID := uuid.New().String()
+		now := time.Now()
+		h.sessionsMu.Lock()
+		// Abandoned logins are never looked up again, so expired ones go whenever a new one starts
+		for id, pending := range h.PendingLogins {
+			if pending.ExpiresAt.Before(now) {
+				delete(h.PendingLogins, id)
+			}
+		}
+		h.PendingLogins[pendingID] = PendingLogin{
+			UserID:    user.ID,
+			ExpiresAt: now.Add(pendingLoginTTL),
+		}
+		h.sessionsMu.Unlock()
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     "pending_login",
+			Value:    pendingID,
+			Path:     "/login",
+			Expires:  now.Add(pendingLoginTTL),
+			HttpOnly: true,
+		})
+
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	h.createSession(w, user.ID)
+	http.Redirect(w, r, h.postLoginRedirect(r.Context(), user), http.StatusSeeOther)
+}
+
+// Helper to look up a non-expired pending login from its cookie
+func (h *Handler) pendingLogin(r *http.Request) (string, PendingLogin, bool) {
+	cookie, err := r.Cookie("pending_login")
+	if err != nil {
+		return "", PendingLogin{}, false
+	}
+
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+
+	pending, exists := h.PendingLogins[cookie.Value]
+	if !exists || pending.ExpiresAt.Before(time.Now()) {
+		delete(h.PendingLogins, cookie.Value)
+		return "", PendingLogin{}, false
+	}
+
+	return cookie.Value, pending, true
+}
+
+// Helper to count a wrong code against a pending login, dropping it at the limit; reports whether it was dropped
+func (h *Handler) failPendingLogin(id string) bool {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+
+	pending, exists := h.PendingLogins[id]
+	if !exists {
+		return true
+	}
+	pending.Failures++
+	if pending.Failures >= maxSecondFactorFailures {
+		delete(h.PendingLogins, id)
+		return true
+	}
+	h.PendingLogins[id] = pending
+	return false
+}
+
+func clearPendingLoginCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "pending_login",
+		Value:    "",
+		Path:     "/login",
+		Expires:  time.Now().Add(-time.Hour),
+		HttpOnly: true,
+	})
+}
+
+// Helper to accept either a TOTP code or an unused recovery code
+func (h *Handler) verifySecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+	ok, err := h.useTOTPCode(ctx, user, code)
+	if ok || err != nil {
+		return ok, err
+	}
+	if code == "" {
+		return false, nil
+	}
+	return h.DB.UseRecoveryCode(ctx, user.ID, auth.HashRecoveryCode(code))
+}
+
+// Helper to accept a TOTP code once: a code from the time step of the last accepted one, or an earlier step, is refused
+func (h *Handler) useTOTPCode(ctx context.Context, user *models.User, code string) (bool, error) {
+	if user.TOTPSecret == "" {
+		return false, nil
+	}
+	step, ok := auth.MatchTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return h.DB.UseTOTPStep(ctx, user.ID, step)
+}
+
+// Helper to send admins who still need to enroll to the 2FA setup page
+func (h *Handler) postLoginRedirect(ctx context.Context, user *models.User) string {
+	if user.Role != "admin" || user.TOTPEnabled {
+		return "/"
+	}
+
+	required, err := h.DB.RequireAdmin2FA(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("Error reading 2FA setting", "error", err)
+		return "/"
+	}
+	if required {
+		return "/account/2fa"
+	}
+	return "/"
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
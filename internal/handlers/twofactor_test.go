@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"cinerank/internal/auth"
+)
+
+// enrollTwoFactor turns 2FA on for the fixture's regular user and returns the TOTP secret
+func (f *fixture) enrollTwoFactor(t *testing.T) string {
+	t.Helper()
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.store.SetTOTPSecret(t.Context(), f.user.ID, secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.store.EnableTOTP(t.Context(), f.user.ID, []string{auth.HashRecoveryCode("recovery-code")}); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// startLogin passes the password step for the fixture's regular user and returns the pending login cookie
+func (f *fixture) startLogin(t *testing.T) *http.Cookie {
+	t.Helper()
+	rec := f.serve(postForm("/login", url.Values{"email": {f.user.Email}, "password": {testPassword}}))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login/2fa" {
+		t.Fatalf("login: status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "pending_login" {
+			return c
+		}
+	}
+	t.Fatal("login did not set a pending_login cookie")
+	return nil
+}
+
+func TestStartingALoginSweepsExpiredPendingLogins(t *testing.T) {
+	f := newFixture(t)
+	f.enrollTwoFactor(t)
+	f.h.PendingLogins["abandoned"] = PendingLogin{UserID: f.user.ID, ExpiresAt: time.Now().Add(-time.Minute)}
+
+	cookie := f.startLogin(t)
+	if _, ok := f.h.PendingLogins["abandoned"]; ok {
+		t.Error("expired pending login was kept")
+	}
+	if _, ok := f.h.PendingLogins[cookie.Value]; !ok || len(f.h.PendingLogins) != 1 {
+		t.Errorf("pending logins = %v", f.h.PendingLogins)
+	}
+}
+
+// sendCode posts a code for the second login step
+func (f *fixture) sendCode(cookie *http.Cookie, code string) *httptest.ResponseRecorder {
+	req := postForm("/login/2fa", url.Values{"code": {code}})
+	req.AddCookie(cookie)
+	return f.serve(req)
+}
+
+func TestWrongCodesEndThePendingLogin(t *testing.T) {
+	f := newFixture(t)
+	secret := f.enrollTwoFactor(t)
+	cookie := f.startLogin(t)
+
+	for i := 1; i < maxSecondFactorFailures; i++ {
+		if rec := f.sendCode(cookie, "000000"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d: status = %d", i, rec.Code)
+		}
+		if _, ok := f.h.PendingLogins[cookie.Value]; !ok {
+			t.Fatalf("pending login dropped after %d wrong codes", i)
+		}
+	}
+	if rec := f.sendCode(cookie, "000000"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("last wrong code: status = %d", rec.Code)
+	}
+	if _, ok := f.h.PendingLogins[cookie.Value]; ok {
+		t.Fatal("pending login kept after too many wrong codes")
+	}
+
+	code, err := auth.GenerateTOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := f.sendCode(cookie, code); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login" {
+		t.Errorf("valid code after lockout: status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestTOTPCodesCannotBeReused(t *testing.T) {
+	f := newFixture(t)
+	secret := f.enrollTwoFactor(t)
+	code, err := auth.GenerateTOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := f.sendCode(f.startLogin(t), code); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Fatalf("first use: status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	cookie := f.startLogin(t)
+	if rec := f.sendCode(cookie, code); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed code: status = %d", rec.Code)
+	}
+	// An earlier step within the skew window is refused as well
+	earlier, _ := auth.GenerateTOTPCode(secret, time.Now().Add(-30*time.Second))
+	if rec := f.sendCode(cookie, earlier); rec.Code != http.StatusUnauthorized {
+		t.Errorf("code from an earlier step: status = %d", rec.Code)
+	}
+	if rec := f.sendCode(cookie, "recovery-code"); rec.Code != http.StatusSeeOther {
+		t.Errorf("recovery code: status = %d", rec.Code)
+	}
+}
+
+func TestTwoFactorPageDoesNotChangeTheSecret(t *testing.T) {
+	f := newFixture(t)
+	secretOf := func() string {
+		t.Helper()
+		u, err := f.store.GetUserByID(t.Context(), f.user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.TOTPSecret
+	}
+
+	rec := f.serve(withSession(httptest.NewRequest(http.MethodGet, "/account/2fa", nil), userSession))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `action="/account/2fa/setup"`) || secretOf() != "" {
+		t.Fatalf("before setup: status = %d, secret = %q", rec.Code, secretOf())
+	}
+
+	if rec := f.serve(withSession(postForm("/account/2fa/setup", nil), userSession)); rec.Code != http.StatusSeeOther {
+		t.Fatalf("setup: status = %d", rec.Code)
+	}
+	secret := secretOf()
+	for range 2 {
+		rec := f.serve(withSession(httptest.NewRequest(http.MethodGet, "/account/2fa", nil), userSession))
+		if !strings.Contains(rec.Body.String(), secret) || secretOf() != secret {
+			t.Fatalf("visit changed the secret from %q to %q", secret, secretOf())
+		}
+	}
+
+	f.serve(withSession(postForm("/account/2fa/setup", nil), userSession))
+	if secretOf() == secret {
+		t.Error("restarting setup kept the old secret")
+	}
+}
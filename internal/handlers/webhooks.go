@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"cinerank/internal/database"
+	"cinerank/internal/logging"
+	"cinerank/internal/models"
+	"cinerank/internal/ui"
+	"cinerank/internal/validation"
+	"cinerank/internal/webhooks"
+)
+
+// Number of deliveries shown in the admin delivery log
+const deliveryLogSize = 50
+
+// Webhook subscriptions and delivery log (admin)
+func (h *Handler) AdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	h.renderWebhooks(w, r, currentUser(r), url.Values{}, nil)
+}
+
+// Create webhook subscription (admin)
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	if err := r.ParseForm(); err != nil {
+		httpError(w, r, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	req := models.WebhookRequest{
+		URL:    r.Form.Get("url"),
+		Secret: r.Form.Get("secret"),
+		Events: r.Form["events"],
+	}
+
+	if errs := validation.Webhook(&req); len(errs) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		h.renderWebhooks(w, r, user, r.Form, errs.Map())
+		return
+	}
+
+	if req.Secret == "" {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error generating webhook secret", "error", err)
+			httpError(w, r, "Error creating webhook", http.StatusInternalServerError)
+			return
+		}
+		req.Secret = secret
+	}
+
+	if _, err := h.DB.CreateWebhook(r.Context(), req); err != nil {
+		dbError(w, r, "Error creating webhook", err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// Pause or resume a webhook subscription (admin)
+func (h *Handler) ToggleWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		httpError(w, r, "Error parsing form", http.StatusBadRequest)
+		return
+	}
+
+	err = h.DB.SetWebhookActive(r.Context(), webhookID, r.Form.Get("active") == "true")
+	if errors.Is(err, database.ErrNotFound) {
+		httpError(w, r, "Webhook not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		dbError(w, r, "Error updating webhook", err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// Delete webhook subscription and its delivery log (admin)
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httpError(w, r, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.DB.DeleteWebhook(r.Context(), webhookID)
+	if errors.Is(err, database.ErrNotFound) {
+		httpError(w, r, "Webhook not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		dbError(w, r, "Error deleting webhook", err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+func (h *Handler) renderWebhooks(w http.ResponseWriter, r *http.Request, user *models.User, form url.Values, errs map[string]string) {
+	hooks, err := h.DB.GetAllWebhooks(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching webhooks", "error", err)
+	}
+
+	deliveries, err := h.DB.GetRecentDeliveries(r.Context(), deliveryLogSize)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching webhook deliveries", "error", err)
+	}
+
+	if err := render(r.Context(), w, "AdminWebhooks", ui.AdminWebhooks(hooks, deliveries, user, form, errs)); err != nil {
+		httpError(w, r, "Error rendering webhooks", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,82 @@
+// Package logging builds the structured logger and carries a request-scoped copy of it in contexts,
+// so handlers and the database layer log with the request's ID and user.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// New returns a logger writing format ("json" or "text") at level and above
+func New(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// ParseLevel reads debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(strings.ToUpper(s)))
+	return level, err
+}
+
+type contextKey struct{}
+
+// requestLogger is shared by every context derived from the request's, so that the user
+// found partway through the request shows up in the access log written at the end
+type requestLogger struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+	userID int
+}
+
+// NewContext returns ctx carrying logger for everything done on behalf of one request
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestLogger{logger: logger})
+}
+
+// FromContext returns the request's logger, or the default logger outside a request
+func FromContext(ctx context.Context) *slog.Logger {
+	if rl, ok := ctx.Value(contextKey{}).(*requestLogger); ok {
+		rl.mu.Lock()
+		defer rl.mu.Unlock()
+		return rl.logger
+	}
+	return slog.Default()
+}
+
+// SetUserID records the signed-in user; later log lines for the request include it.
+// Only the first call per request counts.
+func SetUserID(ctx context.Context, userID int) {
+	rl, ok := ctx.Value(contextKey{}).(*requestLogger)
+	if !ok {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.userID != 0 {
+		return
+	}
+	rl.logger = rl.logger.With("user_id", userID)
+	rl.userID = userID
+}
+
+// UserID returns the user recorded with SetUserID, or 0
+func UserID(ctx context.Context) int {
+	if rl, ok := ctx.Value(contextKey{}).(*requestLogger); ok {
+		rl.mu.Lock()
+		defer rl.mu.Unlock()
+		return rl.userID
+	}
+	return 0
+}
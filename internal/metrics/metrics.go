@@ -0,0 +1,176 @@
+// Package metrics collects the Prometheus metrics served on /metrics.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cinerank/internal/events"
+	"cinerank/internal/middleware"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cinerank"
+
+// Login failure reasons
+const (
+	LoginBadPassword     = "password"
+	LoginBadSecondFactor = "second_factor"
+	LoginProviderFailed  = "oidc"
+)
+
+// Metrics owns a registry with the process, HTTP and business metrics
+type Metrics struct {
+	registry       *prometheus.Registry
+	requests       *prometheus.CounterVec
+	duration       *prometheus.HistogramVec
+	reviewsCreated prometheus.Counter
+	loginsFailed   *prometheus.CounterVec
+	cacheLookups   *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by route pattern, method and status code.",
+		}, []string{"route", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time to serve HTTP requests, by route pattern and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		reviewsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reviews_created_total",
+			Help:      "Reviews created.",
+		}),
+		loginsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_failed_total",
+			Help:      "Rejected sign-in attempts, by reason.",
+		}, []string{"reason"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "Cache lookups, by cached read and result (hit or miss).",
+		}, []string{"cache", "result"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.duration,
+		m.reviewsCreated,
+		m.loginsFailed,
+		m.cacheLookups,
+	)
+	// Every reason shows up as zero before the first failure
+	for _, reason := range []string{LoginBadPassword, LoginBadSecondFactor, LoginProviderFailed} {
+		m.loginsFailed.WithLabelValues(reason)
+	}
+	return m
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// RegisterDB exports the connection pool statistics of db
+func (m *Metrics) RegisterDB(db *sql.DB) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// RegisterSessions exports the number of signed-in sessions, counted by active at scrape time
+func (m *Metrics) RegisterSessions(active func() int) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sessions_active",
+		Help:      "Sessions that have not expired.",
+	}, func() float64 { return float64(active()) }))
+}
+
+// RegisterCache exports the number of cached entries, counted by size at scrape time
+func (m *Metrics) RegisterCache(size func() int) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_entries",
+		Help:      "Entries held by the in-process cache.",
+	}, func() float64 { return float64(size()) }))
+}
+
+// LoginFailed counts a rejected sign-in; it is a no-op on a nil Metrics so handlers work without metrics
+func (m *Metrics) LoginFailed(reason string) {
+	if m == nil {
+		return
+	}
+	m.loginsFailed.WithLabelValues(reason).Inc()
+}
+
+// CacheLookup counts a lookup of the named cached read; like LoginFailed it is a no-op on a nil Metrics
+func (m *Metrics) CacheLookup(cache string, hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// Events wraps next so that published events also feed the business counters
+func (m *Metrics) Events(next events.Publisher) events.Publisher {
+	return &countingPublisher{next: next, m: m}
+}
+
+type countingPublisher struct {
+	next events.Publisher
+	m    *Metrics
+}
+
+func (p *countingPublisher) Publish(e events.Event) {
+	if e.Type == events.TypeReviewCreated {
+		p.m.reviewsCreated.Inc()
+	}
+	if p.next != nil {
+		p.next.Publish(e)
+	}
+}
+
+// Instrument counts and times every request next serves, labelled by the mux pattern that matched
+func (m *Metrics) Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := middleware.NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		// Unmatched requests share one label so that arbitrary paths cannot grow the number of series
+		route := middleware.RoutePath(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		method := methodLabel(r.Method)
+		m.requests.WithLabelValues(route, method, strconv.Itoa(rec.Status)).Inc()
+		m.duration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// methodLabel folds nonstandard methods into one label for the same reason
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
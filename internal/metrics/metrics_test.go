@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cinerank/internal/events"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scrape: status = %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestInstrumentLabelsByRoutePattern(t *testing.T) {
+	m := New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /movies/{id}", func(w http.ResponseWriter, r *http.Request) {
+		// Flushing must still reach the real writer through the recorder
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush = %v", err)
+		}
+	})
+	mux.HandleFunc("POST /reviews", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Invalid rating", http.StatusBadRequest)
+	})
+	handler := m.Instrument(mux)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/movies/1", nil),
+		httptest.NewRequest(http.MethodGet, "/movies/2", nil),
+		httptest.NewRequest(http.MethodPost, "/reviews", nil),
+		httptest.NewRequest(http.MethodGet, "/no-such-page", nil),
+		httptest.NewRequest("BREW", "/no-such-page", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`cinerank_http_requests_total{code="200",method="GET",route="/movies/{id}"} 2`,
+		`cinerank_http_requests_total{code="400",method="POST",route="/reviews"} 1`,
+		`cinerank_http_requests_total{code="404",method="GET",route="unmatched"} 1`,
+		`cinerank_http_requests_total{code="404",method="other",route="unmatched"} 1`,
+		`cinerank_http_request_duration_seconds_count{method="GET",route="/movies/{id}"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("scrape is missing %s", want)
+		}
+	}
+	if strings.Contains(body, "/movies/1") {
+		t.Error("request paths leak into labels")
+	}
+}
+
+type recordingPublisher struct{ got []events.Event }
+
+func (p *recordingPublisher) Publish(e events.Event) { p.got = append(p.got, e) }
+
+func TestBusinessCounters(t *testing.T) {
+	m := New()
+	next := &recordingPublisher{}
+	pub := m.Events(next)
+	pub.Publish(events.Event{Type: events.TypeReviewCreated})
+	pub.Publish(events.Event{Type: events.TypeMovieCreated})
+	if len(next.got) != 2 {
+		t.Errorf("wrapped publisher got %d events, want 2", len(next.got))
+	}
+
+	m.LoginFailed(LoginBadPassword)
+	m.LoginFailed(LoginBadPassword)
+	var none *Metrics
+	none.LoginFailed(LoginBadPassword)
+
+	m.RegisterSessions(func() int { return 3 })
+
+	m.CacheLookup("movies", false)
+	m.CacheLookup("movies", true)
+	m.CacheLookup("movies", true)
+	none.CacheLookup("movies", true)
+	m.RegisterCache(func() int { return 2 })
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		"cinerank_reviews_created_total 1",
+		`cinerank_logins_failed_total{reason="password"} 2`,
+		`cinerank_logins_failed_total{reason="second_factor"} 0`,
+		"cinerank_sessions_active 3",
+		`cinerank_cache_lookups_total{cache="movies",result="hit"} 2`,
+		`cinerank_cache_lookups_total{cache="movies",result="miss"} 1`,
+		"cinerank_cache_entries 2",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("scrape is missing %s", want)
+		}
+	}
+}
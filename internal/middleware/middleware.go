@@ -0,0 +1,240 @@
+// Package middleware holds the HTTP middleware wrapped around every request.
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"cinerank/internal/logging"
+	"cinerank/internal/tracing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID in and out; proxies may set it to correlate their logs with ours
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps client-supplied IDs so they cannot bloat every log line
+const maxRequestIDLength = 128
+
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in mws, the first being the outermost. Middleware in the chain learns the route
+// pattern h matched from Route once h returns.
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	h = recordRoute(h)
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return routeSlot(h)
+}
+
+type routeKey struct{}
+
+// routeSlot gives the request somewhere to leave its route. The mux only sets Pattern on the
+// request it is handed, which is a copy whenever middleware has added to the context.
+func routeSlot(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeKey{}, new(string))))
+	})
+}
+
+func recordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Deferred so the route is still known when the handler panics
+		defer func() {
+			if slot, ok := r.Context().Value(routeKey{}).(*string); ok {
+				*slot = r.Pattern
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Route returns the mux pattern that served r, such as "GET /movies/{id}", or "" when none matched
+func Route(r *http.Request) string {
+	if slot, ok := r.Context().Value(routeKey{}).(*string); ok && *slot != "" {
+		return *slot
+	}
+	return r.Pattern
+}
+
+// RoutePath is Route without the method, such as "/movies/{id}"
+func RoutePath(r *http.Request) string {
+	pattern := Route(r)
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		return pattern[i+1:]
+	}
+	return pattern
+}
+
+type requestIDKey struct{}
+
+// RequestID keeps the caller's X-Request-ID when it is reasonable, assigns a new one otherwise,
+// and echoes it in the response
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFrom returns the ID RequestID gave the request, or ""
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts printable ASCII without spaces, which is safe to log and to send back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Tracing records a server span per request, continuing the caller's trace when it sends a
+// traceparent header. Spans are named after the matched route.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("request.id", RequestIDFrom(ctx)),
+			),
+		)
+		defer span.End()
+
+		r = r.WithContext(ctx)
+		rec := NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		if route := RoutePath(r); route != "" {
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(attribute.String("http.route", route))
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.Status))
+		if rec.Status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.Status))
+		}
+	})
+}
+
+// Logging gives each request a logger tagged with its request and trace IDs and logs one line per
+// request once it is served. Server errors log at error level.
+func Logging(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			reqLogger := logger
+			if id := RequestIDFrom(r.Context()); id != "" {
+				reqLogger = reqLogger.With("request_id", id)
+			}
+			if sc := trace.SpanContextFromContext(r.Context()); sc.IsSampled() {
+				reqLogger = reqLogger.With("trace_id", sc.TraceID().String())
+			}
+			r = r.WithContext(logging.NewContext(r.Context(), reqLogger))
+			rec := NewStatusRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", Route(r)),
+				slog.Int("status", rec.Status),
+				slog.Int64("bytes", rec.Bytes),
+				slog.Duration("duration", time.Since(start)),
+			}
+			level := slog.LevelInfo
+			if rec.Status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			// The request logger already carries the user ID once a handler has set it
+			logging.FromContext(r.Context()).LogAttrs(r.Context(), level, "request", attrs...)
+		})
+	}
+}
+
+// Recover turns a panicking handler into a logged error answered by respond, rather than a dropped
+// connection. If the handler had already started its response, the panic is only logged.
+// http.ErrAbortHandler is re-raised: it is how handlers ask the server to abort the response.
+func Recover(respond http.HandlerFunc) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				logging.FromContext(r.Context()).Error("Handler panicked", "panic", p, "stack", string(debug.Stack()))
+				if !rec.wroteHeader {
+					respond(w, r)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// CSRF rejects state-changing requests sent by browsers from other sites, judged by the
+// Sec-Fetch-Site and Origin headers. Requests without them, such as API clients', pass.
+func CSRF(next http.Handler) http.Handler {
+	return http.NewCrossOriginProtection().Handler(next)
+}
+
+// StatusRecorder remembers the status code and body size written through it
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status      int
+	Bytes       int64
+	wroteHeader bool
+}
+
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *StatusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.Status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer for flushing and deadlines
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,290 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cinerank/internal/logging"
+	"cinerank/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestRequestIDKeepsValidIDsAndReplacesOthers(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFrom(r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"from proxy", "abc-123", true},
+		{"missing", "", false},
+		{"with spaces", "abc 123", false},
+		{"with newline", "abc\n{\"level\":\"ERROR\"}", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if seen == "" || rec.Header().Get(RequestIDHeader) != seen {
+				t.Fatalf("request ID %q, response header %q", seen, rec.Header().Get(RequestIDHeader))
+			}
+			if (seen == tt.header) != tt.keep {
+				t.Errorf("request ID = %q for header %q", seen, tt.header)
+			}
+		})
+	}
+}
+
+func TestLoggingWritesOneLinePerRequest(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "json", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /movies/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logging.SetUserID(r.Context(), 7)
+		logging.FromContext(r.Context()).Info("Loading movie")
+		http.Error(w, "Database error", http.StatusInternalServerError)
+	})
+	handler := Chain(mux, RequestID, Logging(logger))
+
+	req := httptest.NewRequest(http.MethodGet, "/movies/42", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want the handler's and the request's", len(lines))
+	}
+	if lines[0]["msg"] != "Loading movie" || lines[0]["request_id"] != "req-1" || lines[0]["user_id"] != 7.0 {
+		t.Errorf("handler line = %v", lines[0])
+	}
+
+	access := lines[1]
+	want := map[string]interface{}{
+		"level":      "ERROR",
+		"msg":        "request",
+		"request_id": "req-1",
+		"user_id":    7.0,
+		"method":     "GET",
+		"path":       "/movies/42",
+		"route":      "GET /movies/{id}",
+		"status":     500.0,
+	}
+	for key, value := range want {
+		if access[key] != value {
+			t.Errorf("request line %s = %v, want %v", key, access[key], value)
+		}
+	}
+	if _, ok := access["duration"]; !ok {
+		t.Error("request line has no duration")
+	}
+}
+
+func TestTracingNamesSpansAfterRouteAndJoinsCallerTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /movie/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.Start(r.Context(), "db.GetMovieByID")
+		span.End()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	// Logging copies the request, so the route must still reach the tracing middleware outside it
+	handler := Chain(mux, RequestID, Tracing, Logging(slog.New(slog.DiscardHandler)))
+
+	req := httptest.NewRequest(http.MethodGet, "/movie/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want the query's and the request's", len(spans))
+	}
+	query, server := spans[0], spans[1]
+	if server.Name() != "GET /movie/{id}" || server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("server span = %s (%s)", server.Name(), server.SpanKind())
+	}
+	if server.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("server span did not join the caller's trace: %s", server.SpanContext().TraceID())
+	}
+	if query.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("query span is not a child of the request span")
+	}
+	if server.Status().Code != codes.Error {
+		t.Errorf("server span status = %v for a 503", server.Status())
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range server.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["http.route"].AsString() != "/movie/{id}" || attrs["http.response.status_code"].AsInt64() != 503 {
+		t.Errorf("server span attributes = %v", server.Attributes())
+	}
+}
+
+func TestRecoverLogsPanicsAsServerErrors(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, "json", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /movie/{id}", func(w http.ResponseWriter, r *http.Request) {
+		panic("nil movie")
+	})
+	mux.HandleFunc("GET /movies", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<ul>"))
+		panic("nil movie")
+	})
+	serverError := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Algo deu errado", http.StatusInternalServerError)
+	}
+	handler := Chain(mux, RequestID, Logging(logger), Recover(serverError))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/movie/1", nil))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "Algo deu errado") {
+		t.Errorf("status = %d, body = %q", rec.Code, rec.Body)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want the panic's and the request's", len(lines))
+	}
+	var panicLine, requestLine map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &panicLine)
+	json.Unmarshal([]byte(lines[1]), &requestLine)
+	if panicLine["panic"] != "nil movie" || !strings.Contains(panicLine["stack"].(string), "TestRecoverLogsPanicsAsServerErrors") {
+		t.Errorf("panic line = %v", panicLine)
+	}
+	if requestLine["status"] != 500.0 || requestLine["route"] != "GET /movie/{id}" {
+		t.Errorf("request line = %v", requestLine)
+	}
+
+	// A response already under way is left alone rather than corrupted with an error page
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/movies", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "<ul>" {
+		t.Errorf("started response: status = %d, body = %q", rec.Code, rec.Body)
+	}
+}
+
+func TestCSRFRejectsCrossSiteForms(t *testing.T) {
+	handler := CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		method string
+		header string
+		value  string
+		status int
+	}{
+		{"cross-site post", http.MethodPost, "Sec-Fetch-Site", "cross-site", http.StatusForbidden},
+		{"foreign origin", http.MethodPost, "Origin", "https://evil.example", http.StatusForbidden},
+		{"same-origin post", http.MethodPost, "Sec-Fetch-Site", "same-origin", http.StatusOK},
+		{"API client", http.MethodPost, "", "", http.StatusOK},
+		{"cross-site link", http.MethodGet, "Sec-Fetch-Site", "cross-site", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://cinerank.example/reviews", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestCompressGzipsPagesButNotEventStreams(t *testing.T) {
+	page := "<!DOCTYPE html>" + strings.Repeat("<li>Cidade de Deus</li>", 100)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, page)
+	})
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "event: review\n\n")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("flush: %v", err)
+		}
+	})
+	handler := Compress(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "br, gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("headers = %v", rec.Header())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := io.ReadAll(zr); string(body) != page {
+		t.Errorf("decompressed body = %q", body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "event: review\n\n" || !rec.Flushed {
+		t.Errorf("event stream was compressed or not flushed: %v %q", rec.Header(), rec.Body.String())
+	}
+
+	for _, accept := range []string{"", "gzip;q=0", "identity"} {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != page {
+			t.Errorf("Accept-Encoding %q: response was compressed", accept)
+		}
+	}
+}
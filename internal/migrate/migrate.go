@@ -0,0 +1,375 @@
+// Package migrate applies the SQL migrations in a filesystem to Postgres and records them in schema_migrations.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockKey identifies the advisory lock that keeps concurrent runners (e.g. replicas starting together) apart
+const lockKey = 7_283_617_001
+
+const createTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+	)
+`
+
+var filePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of Up, to detect edits to applied migrations
+}
+
+// Status describes one migration, known from the files, the database or both
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// Modified is set when the file changed after it was applied
+	Modified bool
+	// Missing is set when the database has a version with no file
+	Missing bool
+}
+
+// Load reads NNN_name.up.sql / NNN_name.down.sql pairs from fsys, ordered by version
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files with different names: %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		if m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Migrator runs migrations against a database, one transaction per migration
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+type applied struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// Up applies every pending migration and returns how many ran
+func (m *Migrator) Up() (int, error) {
+	count := 0
+	err := m.locked(func(conn *sql.Conn, done map[int]applied) error {
+		if err := m.verify(done); err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			err := inTx(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec(mig.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(
+					"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, NOW())",
+					mig.Version, mig.Name, mig.Checksum,
+				)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+			log.Printf("Applied migration %d_%s", mig.Version, mig.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down rolls back the latest steps applied migrations and returns how many were rolled back
+func (m *Migrator) Down(steps int) (int, error) {
+	count := 0
+	err := m.locked(func(conn *sql.Conn, done map[int]applied) error {
+		if err := m.verify(done); err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			err := inTx(conn, func(tx *sql.Tx) error {
+				if _, err := tx.Exec(mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = $1", mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("rollback of %d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+			log.Printf("Rolled back migration %d_%s", mig.Version, mig.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status lists every migration in version order with whether and when it was applied
+func (m *Migrator) Status() ([]Status, error) {
+	var statuses []Status
+	err := m.locked(func(conn *sql.Conn, done map[int]applied) error {
+		statuses = status(m.migrations, done)
+		return nil
+	})
+	return statuses, err
+}
+
+// Check reports whether the database schema matches the migration files, without taking the lock or
+// changing anything; it fails while migrations are pending, edited or missing
+func (m *Migrator) Check(ctx context.Context) error {
+	done, err := appliedVersions(ctx, m.db)
+	if err != nil {
+		return err
+	}
+	if err := m.verify(done); err != nil {
+		return err
+	}
+	return m.pending(done)
+}
+
+// pending fails when some migration files have not been applied yet
+func (m *Migrator) pending(done map[int]applied) error {
+	var names []string
+	for _, mig := range m.migrations {
+		if _, ok := done[mig.Version]; !ok {
+			names = append(names, fmt.Sprintf("%d_%s", mig.Version, mig.Name))
+		}
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("%d migrations pending: %s", len(names), strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func status(migrations []Migration, done map[int]applied) []Status {
+	known := make(map[int]bool)
+	var statuses []Status
+	for _, mig := range migrations {
+		known[mig.Version] = true
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := done[mig.Version]; ok {
+			s.AppliedAt = &a.appliedAt
+			s.Modified = a.checksum != mig.Checksum
+		}
+		statuses = append(statuses, s)
+	}
+	for version, a := range done {
+		if !known[version] {
+			statuses = append(statuses, Status{Version: version, AppliedAt: &a.appliedAt, Missing: true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses
+}
+
+// verify refuses to run when applied migrations were edited or removed, since the schema no longer matches the files
+func (m *Migrator) verify(done map[int]applied) error {
+	var problems []error
+	for _, s := range status(m.migrations, done) {
+		switch {
+		case s.Modified:
+			problems = append(problems, fmt.Errorf("migration %d_%s was modified after it was applied", s.Version, s.Name))
+		case s.Missing:
+			problems = append(problems, fmt.Errorf("migration %d was applied but its files are missing", s.Version))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// locked runs fn on a single connection holding the migration advisory lock, with the applied versions loaded
+func (m *Migrator) locked(fn func(conn *sql.Conn, done map[int]applied) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Advisory locks belong to the session, so lock and unlock on this same connection
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey)
+
+	if err := m.ensureTable(conn); err != nil {
+		return err
+	}
+
+	done, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(conn, done)
+}
+
+// ensureTable creates schema_migrations, taking over the version table left by golang-migrate if there is one
+func (m *Migrator) ensureTable(conn *sql.Conn) error {
+	ctx := context.Background()
+
+	var legacy bool
+	err := conn.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'schema_migrations' AND column_name = 'dirty'
+		)
+	`).Scan(&legacy)
+	if err != nil {
+		return err
+	}
+	if legacy {
+		return inTx(conn, m.adoptLegacy)
+	}
+
+	_, err = conn.ExecContext(ctx, createTable)
+	return err
+}
+
+// adoptLegacy converts golang-migrate's single (version, dirty) row into one row per applied migration
+func (m *Migrator) adoptLegacy(tx *sql.Tx) error {
+	var version int
+	var dirty bool
+	err := tx.QueryRow("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d was left half-applied by golang-migrate; fix the schema and clear the dirty flag first", version)
+	}
+
+	if _, err := tx.Exec("DROP TABLE schema_migrations"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(createTable); err != nil {
+		return err
+	}
+
+	for _, mig := range m.migrations {
+		if mig.Version > version {
+			break
+		}
+		_, err := tx.Exec(
+			"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, NOW())",
+			mig.Version, mig.Name, mig.Checksum,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Adopted golang-migrate schema version %d", version)
+	return nil
+}
+
+// querier is satisfied by both *sql.DB and *sql.Conn
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func appliedVersions(ctx context.Context, q querier) (map[int]applied, error) {
+	rows, err := q.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := make(map[int]applied)
+	for rows.Next() {
+		var version int
+		var a applied
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		done[version] = a
+	}
+	return done, rows.Err()
+}
+
+func inTx(conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
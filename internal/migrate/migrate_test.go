@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"cinerank/migrations"
+)
+
+func TestLoadOrdersAndPairsFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"010_add_index.up.sql":   {Data: []byte("CREATE INDEX a ON t(x);")},
+		"010_add_index.down.sql": {Data: []byte("DROP INDEX a;")},
+		"002_create_t.up.sql":    {Data: []byte("CREATE TABLE t (x int);")},
+		"002_create_t.down.sql":  {Data: []byte("DROP TABLE t;")},
+		"README.md":              {Data: []byte("ignored")},
+	}
+
+	got, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Version != 2 || got[1].Version != 10 {
+		t.Fatalf("versions = %+v", got)
+	}
+	if got[0].Name != "create_t" || got[0].Down != "DROP TABLE t;" {
+		t.Errorf("first migration = %+v", got[0])
+	}
+	if len(got[0].Checksum) != 64 || got[0].Checksum == got[1].Checksum {
+		t.Errorf("checksums = %q, %q", got[0].Checksum, got[1].Checksum)
+	}
+}
+
+func TestLoadRejectsIncompleteMigrations(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"no down file": {
+			"001_a.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"no up file": {
+			"001_a.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"mismatched names": {
+			"001_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"001_b.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range tests {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEmbeddedMigrationsAreComplete(t *testing.T) {
+	got, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range got {
+		if m.Version != i+1 {
+			t.Errorf("migration %d_%s breaks the version sequence", m.Version, m.Name)
+		}
+	}
+}
+
+func TestVerifyDetectsDrift(t *testing.T) {
+	m := &Migrator{migrations: []Migration{
+		{Version: 1, Name: "one", Checksum: "aaa"},
+		{Version: 2, Name: "two", Checksum: "bbb"},
+	}}
+	now := time.Now()
+
+	if err := m.verify(map[int]applied{1: {"aaa", now}}); err != nil {
+		t.Errorf("unexpected error with one pending migration: %v", err)
+	}
+
+	err := m.verify(map[int]applied{1: {"changed", now}, 3: {"ccc", now}})
+	if err == nil || !strings.Contains(err.Error(), "1_one was modified") || !strings.Contains(err.Error(), "migration 3 was applied") {
+		t.Errorf("verify = %v", err)
+	}
+
+	statuses := status(m.migrations, map[int]applied{1: {"aaa", now}, 3: {"ccc", now}})
+	if len(statuses) != 3 || statuses[1].AppliedAt != nil || !statuses[2].Missing {
+		t.Errorf("statuses = %+v", statuses)
+	}
+}
+
+func TestPendingListsUnappliedMigrations(t *testing.T) {
+	m := &Migrator{migrations: []Migration{
+		{Version: 1, Name: "one", Checksum: "aaa"},
+		{Version: 2, Name: "two", Checksum: "bbb"},
+	}}
+	now := time.Now()
+
+	if err := m.pending(map[int]applied{1: {"aaa", now}, 2: {"bbb", now}}); err != nil {
+		t.Errorf("unexpected error with every migration applied: %v", err)
+	}
+	if err := m.pending(map[int]applied{1: {"aaa", now}}); err == nil || !strings.Contains(err.Error(), "2_two") {
+		t.Errorf("pending = %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"math"
 	"time"
 )
 
@@ -18,18 +19,31 @@ type Movie struct {
 }
 
 type Review struct {
-	ID        int       `json:"id"`
-	MovieID   int       `json:"movie_id"`
-	UserID    int       `json:"user_id"`
-	Rating    int       `json:"rating"` // 1-5 stars
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Movie     *Movie    `json:"movie,omitempty"`
-	User      *User     `json:"user,omitempty"`
+	ID         int            `json:"id"`
+	MovieID    int            `json:"movie_id"`
+	UserID     int            `json:"user_id"`
+	Rating     int            `json:"rating"` // 1-5 stars
+	Title      string         `json:"title"`
+	Content    string         `json:"content"`
+	SubRatings map[string]int `json:"sub_ratings,omitempty"` // 1-5 stars by RatingDimensions, each optional
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	Movie      *Movie         `json:"movie,omitempty"`
+	User       *User          `json:"user,omitempty"`
 }
 
+// Rating dimensions a review may rate besides the overall rating
+const (
+	DimensionStory          = "story"
+	DimensionActing         = "acting"
+	DimensionCinematography = "cinematography"
+	DimensionSoundtrack     = "soundtrack"
+	DimensionRewatchability = "rewatchability"
+)
+
+// RatingDimensions lists every rating dimension in display order; admins choose which are enabled
+var RatingDimensions = []string{DimensionStory, DimensionActing, DimensionCinematography, DimensionSoundtrack, DimensionRewatchability}
+
 type User struct {
 	ID           int       `json:"id"`
 	Username     string    `json:"username"`
@@ -37,7 +51,9 @@ type User struct {
 	Role         string    `json:"role"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	TOTPEnabled  bool      `json:"totp_enabled"`
 	PasswordHash string    `json:"-"` // Not exposed in JSON
+	TOTPSecret   string    `json:"-"`
 }
 
 type Tag struct {
@@ -51,6 +67,92 @@ type MovieWithStats struct {
 	AverageRating float64 `json:"average_rating"`
 }
 
+// MovieStats are a movie's review statistics, kept up to date as reviews are written
+type MovieStats struct {
+	MovieID     int `json:"movie_id"`
+	ReviewCount int `json:"review_count"`
+	RatingSum   int `json:"rating_sum"`
+	// Histogram counts reviews by rating: Histogram[0] holds the 1-star reviews
+	Histogram      [5]int     `json:"histogram"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at,omitempty"`
+}
+
+// AverageRating is 0 for a movie without reviews
+func (s MovieStats) AverageRating() float64 {
+	if s.ReviewCount == 0 {
+		return 0
+	}
+	return float64(s.RatingSum) / float64(s.ReviewCount)
+}
+
+// MedianRating is 0 for a movie without reviews
+func (s MovieStats) MedianRating() float64 {
+	if s.ReviewCount == 0 {
+		return 0
+	}
+	// The middle ratings in review order, the same one when the count is odd
+	lower, upper := s.ratingAt((s.ReviewCount-1)/2), s.ratingAt(s.ReviewCount/2)
+	return float64(lower+upper) / 2
+}
+
+// ratingAt returns the rating of the i-th review, counting from 0 in ascending order of rating
+func (s MovieStats) ratingAt(i int) int {
+	for rating, count := range s.Histogram {
+		if i < count {
+			return rating + 1
+		}
+		i -= count
+	}
+	return len(s.Histogram)
+}
+
+// RatingStdDev is the population standard deviation of the ratings, 0 without reviews
+func (s MovieStats) RatingStdDev() float64 {
+	if s.ReviewCount == 0 {
+		return 0
+	}
+	mean := s.AverageRating()
+	var squares float64
+	for rating, count := range s.Histogram {
+		d := float64(rating+1) - mean
+		squares += float64(count) * d * d
+	}
+	return math.Sqrt(squares / float64(s.ReviewCount))
+}
+
+// MonthlyCount is how many reviews were written in the month starting at Month, in UTC
+type MonthlyCount struct {
+	Month time.Time `json:"month"`
+	Count int       `json:"count"`
+}
+
+// MovieStatsReport details how a movie was rated, for its stats panel and the API
+type MovieStatsReport struct {
+	MovieID       int     `json:"movie_id"`
+	ReviewCount   int     `json:"review_count"`
+	AverageRating float64 `json:"average_rating"`
+	MedianRating  float64 `json:"median_rating"`
+	RatingStdDev  float64 `json:"rating_stddev"`
+	// Histogram counts reviews by rating: Histogram[0] holds the 1-star reviews
+	Histogram      [5]int     `json:"histogram"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at,omitempty"`
+	// IMDBRating is out of 10, so IMDBDifference compares it with twice the average rating. The
+	// difference is left out when the movie has no IMDb rating or no reviews.
+	IMDBRating     float64  `json:"imdb_rating"`
+	IMDBDifference *float64 `json:"imdb_difference,omitempty"`
+	// ReviewsByMonth covers the last twelve months, oldest first
+	ReviewsByMonth []MonthlyCount `json:"reviews_by_month"`
+	// SubRatings average the enabled rating dimensions that reviews rated, in display order
+	SubRatings []SubRatingAverage `json:"sub_ratings"`
+}
+
+// SubRatingAverage averages one rating dimension over the reviews of a movie that rated it
+type SubRatingAverage struct {
+	Dimension     string  `json:"dimension"`
+	ReviewCount   int     `json:"review_count"`
+	AverageRating float64 `json:"average_rating"`
+}
+
 type CreateMovieRequest struct {
 	Title      string   `json:"title"`
 	Director   string   `json:"director"`
@@ -62,10 +164,11 @@ type CreateMovieRequest struct {
 }
 
 type CreateReviewRequest struct {
-	MovieID int    `json:"movie_id"`
-	Rating  int    `json:"rating"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	MovieID    int            `json:"movie_id"`
+	Rating     int            `json:"rating"`
+	Title      string         `json:"title"`
+	Content    string         `json:"content"`
+	SubRatings map[string]int `json:"sub_ratings"`
 }
 
 type RegisterRequest struct {
@@ -77,4 +180,127 @@ type RegisterRequest struct {
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
-}
\ No newline at end of file
+}
+
+type TagRequest struct {
+	Name string `json:"name"`
+}
+
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+type UpdateUserRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+// Webhook events
+const (
+	EventReviewCreated = "review.created"
+	EventMovieCreated  = "movie.created"
+	EventMovieDeleted  = "movie.deleted"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{EventReviewCreated, EventMovieCreated, EventMovieDeleted}
+
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type WebhookDelivery struct {
+	ID             int        `json:"id"`
+	WebhookID      int        `json:"webhook_id"`
+	Event          string     `json:"event"`
+	Payload        []byte     `json:"-"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"response_status"` // 0 when no response was received
+	LastError      string     `json:"last_error"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	// Filled in when claimed for delivery
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+// Analytics periods, named after the Postgres date_trunc fields they group by
+const (
+	PeriodDay  = "day"
+	PeriodWeek = "week"
+)
+
+// Movie rankings on the analytics dashboard
+const (
+	RankMostReviewed = "most_reviewed"
+	RankHighestRated = "highest_rated"
+	RankLowestRated  = "lowest_rated"
+)
+
+// ActivityCount is how many users signed up and reviews were written in the period starting at Start
+type ActivityCount struct {
+	Start    time.Time `json:"start"`
+	NewUsers int       `json:"new_users"`
+	Reviews  int       `json:"reviews"`
+}
+
+type ReviewerStats struct {
+	UserID         int       `json:"user_id"`
+	Username       string    `json:"username"`
+	ReviewCount    int       `json:"review_count"`
+	AverageRating  float64   `json:"average_rating"`
+	LastReviewedAt time.Time `json:"last_reviewed_at"`
+}
+
+// TagStats adds up the review stats of the movies carrying a tag
+type TagStats struct {
+	TagID         int     `json:"tag_id"`
+	Name          string  `json:"name"`
+	MovieCount    int     `json:"movie_count"`
+	ReviewCount   int     `json:"review_count"`
+	AverageRating float64 `json:"average_rating"`
+}
+
+// RatingTrend is how the reviews written in the month starting at Month rated their movies
+type RatingTrend struct {
+	Month         time.Time `json:"month"`
+	ReviewCount   int       `json:"review_count"`
+	AverageRating float64   `json:"average_rating"`
+	FiveStarCount int       `json:"five_star_count"`
+}
+
+// Analytics is what the admin dashboard shows; Activity and RatingTrend include periods without reviews
+type Analytics struct {
+	Period       string
+	Activity     []ActivityCount
+	TopReviewers []ReviewerStats
+	MostReviewed []MovieWithStats
+	HighestRated []MovieWithStats
+	LowestRated  []MovieWithStats
+	Tags         []TagStats
+	RatingTrend  []RatingTrend
+}
@@ -0,0 +1,495 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed openapi.json
+var specJSON []byte
+
+// Spec returns the raw OpenAPI document
+func Spec() []byte {
+	return specJSON
+}
+
+// Document is the subset of OpenAPI 3.1 used by the CineRank spec
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+// PathItem maps lower-case HTTP methods to operations
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Tags        []string             `json:"tags"`
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Description string               `json:"description"`
+	Deprecated  bool                 `json:"deprecated"`
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref         string                `json:"$ref"`
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas"`
+	Responses  map[string]*Response  `json:"responses"`
+	Parameters map[string]*Parameter `json:"parameters"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Description          string             `json:"description"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	Items                *Schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	MaxItems             *int               `json:"maxItems"`
+}
+
+// Load parses the embedded document
+func Load() (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(specJSON, &doc); err != nil {
+		return nil, fmt.Errorf("invalid embedded OpenAPI document: %w", err)
+	}
+	return &doc, nil
+}
+
+// ServeSpec writes the raw document
+func ServeSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(specJSON)
+}
+
+// SchemaName returns the component name of a $ref, or the schema type for inline schemas
+func SchemaName(s *Schema) string {
+	if s == nil {
+		return ""
+	}
+	if s.Ref != "" {
+		return s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+	}
+	if s.Type == "array" && s.Items != nil {
+		return SchemaName(s.Items) + "[]"
+	}
+	return s.Type
+}
+
+func (d *Document) schema(s *Schema) (*Schema, error) {
+	for s != nil && s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		resolved, ok := d.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("unresolved schema reference %q", s.Ref)
+		}
+		s = resolved
+	}
+	return s, nil
+}
+
+func (d *Document) response(r *Response) (*Response, error) {
+	if r != nil && r.Ref != "" {
+		name := strings.TrimPrefix(r.Ref, "#/components/responses/")
+		resolved, ok := d.Components.Responses[name]
+		if !ok {
+			return nil, fmt.Errorf("unresolved response reference %q", r.Ref)
+		}
+		return resolved, nil
+	}
+	return r, nil
+}
+
+func (d *Document) parameter(p *Parameter) *Parameter {
+	if p.Ref != "" {
+		if resolved, ok := d.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]; ok {
+			return resolved
+		}
+	}
+	return p
+}
+
+// FindOperation matches a concrete request path against the path templates. When several
+// templates match, the one whose first differing segment is literal wins, as with /movies/top
+// over /movies/{id}; ties go to the template that sorts first.
+func (d *Document) FindOperation(method, path string) (string, *Operation) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, template := range d.templates() {
+		templateSegments := strings.Split(strings.Trim(template, "/"), "/")
+		if len(templateSegments) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, seg := range templateSegments {
+			if !isPathParam(seg) && seg != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if op, ok := d.Paths[template][strings.ToLower(method)]; ok {
+			return template, op
+		}
+	}
+	return "", nil
+}
+
+// templates lists the path templates in the order FindOperation tries them
+func (d *Document) templates() []string {
+	templates := make([]string, 0, len(d.Paths))
+	for template := range d.Paths {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		a := strings.Split(strings.Trim(templates[i], "/"), "/")
+		b := strings.Split(strings.Trim(templates[j], "/"), "/")
+		// Only templates with as many segments compete, but ordering by length keeps the sort consistent
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		for k := range a {
+			if aParam, bParam := isPathParam(a[k]), isPathParam(b[k]); aParam != bParam {
+				return bParam
+			}
+		}
+		return templates[i] < templates[j]
+	})
+	return templates
+}
+
+func isPathParam(segment string) bool {
+	return strings.HasPrefix(segment, "{")
+}
+
+// ValidateResponse checks that a response is documented for the operation and its body matches the schema
+func (d *Document) ValidateResponse(method, path string, status int, contentType string, body []byte) error {
+	template, op := d.FindOperation(method, path)
+	if op == nil {
+		return fmt.Errorf("%s %s is not documented", method, path)
+	}
+
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		return fmt.Errorf("%s %s: status %d is not documented", method, template, status)
+	}
+	resp, err := d.response(resp)
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Content) == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%s %s: invalid content type %q", method, template, contentType)
+	}
+	media, ok := resp.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%s %s: content type %s is not documented for status %d", method, template, mediaType, status)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("%s %s: body is not valid JSON: %w", method, template, err)
+	}
+	return d.ValidateValue(media.Schema, value, "$")
+}
+
+// ValidateValue validates a decoded JSON value against a schema
+func (d *Document) ValidateValue(s *Schema, value interface{}, at string) error {
+	s, err := d.schema(s)
+	if err != nil || s == nil {
+		return err
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			if allowed == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", at, value, s.Enum)
+		}
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T", at, value)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", at, name)
+			}
+		}
+		for name, v := range obj {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: undocumented property %q", at, name)
+				}
+				continue
+			}
+			if err := d.ValidateValue(prop, v, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T", at, value)
+		}
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			return fmt.Errorf("%s: more than %d items", at, *s.MaxItems)
+		}
+		for i, item := range arr {
+			if err := d.ValidateValue(s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string, got %T", at, value)
+		}
+		if s.MinLength != nil && len([]rune(str)) < *s.MinLength {
+			return fmt.Errorf("%s: shorter than %d characters", at, *s.MinLength)
+		}
+		if s.MaxLength != nil && len([]rune(str)) > *s.MaxLength {
+			return fmt.Errorf("%s: longer than %d characters", at, *s.MaxLength)
+		}
+		if s.Format == "date-time" {
+			if _, err := parseDateTime(str); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, str)
+			}
+		}
+	case "integer", "number":
+		num, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("%s: expected %s, got %T", at, s.Type, value)
+		}
+		if s.Type == "integer" && num != float64(int64(num)) {
+			return fmt.Errorf("%s: expected integer, got %v", at, num)
+		}
+		if s.Minimum != nil && num < *s.Minimum {
+			return fmt.Errorf("%s: %v is below minimum %v", at, num, *s.Minimum)
+		}
+		if s.Maximum != nil && num > *s.Maximum {
+			return fmt.Errorf("%s: %v is above maximum %v", at, num, *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %T", at, value)
+		}
+	}
+
+	return nil
+}
+
+// OperationView is a flattened operation for rendering the docs page
+type OperationView struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Deprecated  bool
+	Parameters  []ParameterView
+	RequestBody string
+	Responses   []ResponseView
+}
+
+type ParameterView struct {
+	Name        string
+	In          string
+	Type        string
+	Required    bool
+	Description string
+}
+
+type ResponseView struct {
+	Status      string
+	Description string
+	Schema      string
+}
+
+var methodOrder = []string{"get", "post", "put", "patch", "delete"}
+
+// Operations lists every operation sorted by path and method
+func (d *Document) Operations() []OperationView {
+	paths := make([]string, 0, len(d.Paths))
+	for path := range d.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var views []OperationView
+	for _, path := range paths {
+		for _, method := range methodOrder {
+			op, ok := d.Paths[path][method]
+			if !ok {
+				continue
+			}
+			views = append(views, d.operationView(strings.ToUpper(method), path, op))
+		}
+	}
+	return views
+}
+
+func (d *Document) operationView(method, path string, op *Operation) OperationView {
+	view := OperationView{
+		Method:      method,
+		Path:        path,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Deprecated:  op.Deprecated,
+	}
+
+	for _, p := range op.Parameters {
+		p = d.parameter(p)
+		view.Parameters = append(view.Parameters, ParameterView{
+			Name:        p.Name,
+			In:          p.In,
+			Type:        SchemaName(p.Schema),
+			Required:    p.Required,
+			Description: p.Description,
+		})
+	}
+
+	if op.RequestBody != nil {
+		for _, media := range op.RequestBody.Content {
+			view.RequestBody = SchemaName(media.Schema)
+		}
+	}
+
+	statuses := make([]string, 0, len(op.Responses))
+	for status := range op.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		resp, err := d.response(op.Responses[status])
+		if err != nil {
+			continue
+		}
+		rv := ResponseView{Status: status, Description: resp.Description}
+		for _, media := range resp.Content {
+			rv.Schema = SchemaName(media.Schema)
+		}
+		view.Responses = append(view.Responses, rv)
+	}
+
+	return view
+}
+
+type SchemaView struct {
+	Name       string
+	Properties []PropertyView
+}
+
+type PropertyView struct {
+	Name        string
+	Type        string
+	Required    bool
+	Description string
+}
+
+// Schemas lists the component schemas and their properties in alphabetical order
+func (d *Document) Schemas() []SchemaView {
+	names := make([]string, 0, len(d.Components.Schemas))
+	for name := range d.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	views := make([]SchemaView, 0, len(names))
+	for _, name := range names {
+		s := d.Components.Schemas[name]
+		required := make(map[string]bool, len(s.Required))
+		for _, r := range s.Required {
+			required[r] = true
+		}
+
+		props := make([]string, 0, len(s.Properties))
+		for prop := range s.Properties {
+			props = append(props, prop)
+		}
+		sort.Strings(props)
+
+		view := SchemaView{Name: name}
+		for _, prop := range props {
+			ps := s.Properties[prop]
+			typ := SchemaName(ps)
+			if ps.Format != "" {
+				typ += " (" + ps.Format + ")"
+			}
+			view.Properties = append(view.Properties, PropertyView{
+				Name:        prop,
+				Type:        typ,
+				Required:    required[prop],
+				Description: ps.Description,
+			})
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+func parseDateTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -0,0 +1,39 @@
+package openapi
+
+import "testing"
+
+func TestFindOperationPrefersLiteralSegments(t *testing.T) {
+	op := func(id string) *Operation { return &Operation{OperationID: id} }
+	d := &Document{Paths: map[string]PathItem{
+		"/movies/{id}":         {"get": op("getMovie"), "post": op("postMovie")},
+		"/movies/top":          {"get": op("topMovies")},
+		"/movies/{id}/reviews": {"get": op("movieReviews")},
+		"/{kind}/top":          {"get": op("topByKind")},
+		"/{kind}/{id}":         {"get": op("getByKind")},
+		"/{type}/{id}":         {"get": op("getByType")},
+	}}
+
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{"GET", "/movies/top", "/movies/top"},
+		{"GET", "/movies/7", "/movies/{id}"},
+		// A literal match without the method falls through to the templated one
+		{"POST", "/movies/top", "/movies/{id}"},
+		{"GET", "/shows/top", "/{kind}/top"},
+		{"GET", "/movies/7/reviews", "/movies/{id}/reviews"},
+		// Equally specific templates tie on the template string
+		{"GET", "/shows/7", "/{kind}/{id}"},
+		{"DELETE", "/movies/7", ""},
+		{"GET", "/movies", ""},
+	}
+	// Map iteration order changes between runs, so try each path a few times
+	for range 20 {
+		for _, tt := range tests {
+			if got, _ := d.FindOperation(tt.method, tt.path); got != tt.want {
+				t.Fatalf("FindOperation(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package tracing
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestSetupStdoutExportsSpansOnShutdown(t *testing.T) {
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	var out bytes.Buffer
+	shutdown, err := Setup(t.Context(), Config{Exporter: ExporterStdout, SampleRatio: 1, Stdout: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := Start(t.Context(), "render HomePage")
+	span.End()
+
+	if err := shutdown(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"Name": "render HomePage"`) || !strings.Contains(out.String(), `"cinerank"`) {
+		t.Errorf("stdout export = %s", out.String())
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	if _, err := Setup(t.Context(), Config{Exporter: "zipkin"}); err == nil {
+		t.Error("Setup accepted an unknown exporter")
+	}
+}
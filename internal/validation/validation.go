@@ -0,0 +1,323 @@
+package validation
+
+import (
+	"fmt"
+	"maps"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cinerank/internal/models"
+)
+
+// Stable error codes returned alongside each field error
+const (
+	CodeRequired = "required"
+	CodeTooLong  = "too_long"
+	CodeTooShort = "too_short"
+	CodeRange    = "out_of_range"
+	CodeFormat   = "invalid_format"
+	CodeTaken    = "already_taken"
+)
+
+const (
+	// FirstFilmYear is the year of the oldest surviving motion picture
+	FirstFilmYear = 1888
+	maxTextLength = 255
+	maxTagLength  = 100
+	maxTags       = 20
+	maxContent    = 10000
+	minPassword   = 8
+	minUsername   = 3
+	maxUsername   = 50
+	minSecret     = 16
+)
+
+// Roles accepted by the users.role check constraint
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Errors is a list of field-level validation failures
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *Errors) Add(field, code, message string) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Map returns the first message for each field, for rendering next to form inputs
+func (e Errors) Map() map[string]string {
+	m := make(map[string]string, len(e))
+	for _, fe := range e {
+		if _, exists := m[fe.Field]; !exists {
+			m[fe.Field] = fe.Message
+		}
+	}
+	return m
+}
+
+// Movie normalizes the request in place and validates it
+func Movie(req *models.CreateMovieRequest) Errors {
+	var errs Errors
+
+	req.Title = strings.TrimSpace(req.Title)
+	req.Director = strings.TrimSpace(req.Director)
+	req.Plot = strings.TrimSpace(req.Plot)
+	req.PosterURL = strings.TrimSpace(req.PosterURL)
+	req.Tags = normalizeTags(req.Tags)
+
+	requiredText(&errs, "title", req.Title, maxTextLength)
+	requiredText(&errs, "director", req.Director, maxTextLength)
+
+	maxYear := time.Now().Year() + 5
+	if req.Year < FirstFilmYear || req.Year > maxYear {
+		errs.Add("year", CodeRange, fmt.Sprintf("must be a year between %d and %d", FirstFilmYear, maxYear))
+	}
+
+	// Zero means the rating is unknown
+	if req.IMDBRating != 0 && (req.IMDBRating < 1 || req.IMDBRating > 10) {
+		errs.Add("imdb_rating", CodeRange, "must be between 1.0 and 10.0")
+	}
+
+	if req.PosterURL != "" && !isHTTPURL(req.PosterURL) {
+		errs.Add("poster_url", CodeFormat, "must be an absolute http or https URL")
+	}
+
+	if len(req.Tags) > maxTags {
+		errs.Add("tags", CodeTooLong, fmt.Sprintf("must have at most %d tags", maxTags))
+	}
+	for _, tag := range req.Tags {
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			errs.Add("tags", CodeTooLong, fmt.Sprintf("each tag must be at most %d characters", maxTagLength))
+			break
+		}
+	}
+
+	return errs
+}
+
+// Review normalizes the request in place and validates it
+func Review(req *models.CreateReviewRequest) Errors {
+	var errs Errors
+
+	req.Title = strings.TrimSpace(req.Title)
+	req.Content = strings.TrimSpace(req.Content)
+
+	if req.MovieID <= 0 {
+		errs.Add("movie_id", CodeRequired, "must reference a movie")
+	}
+	if req.Rating < 1 || req.Rating > 5 {
+		errs.Add("rating", CodeRange, "must be between 1 and 5")
+	}
+	requiredText(&errs, "title", req.Title, maxTextLength)
+	if utf8.RuneCountInString(req.Content) > maxContent {
+		errs.Add("content", CodeTooLong, fmt.Sprintf("must be at most %d characters", maxContent))
+	}
+
+	return errs
+}
+
+// SubRatings drops the dimensions rated 0, which leaves them unrated, from ratings in place and
+// validates the rest. Only enabled dimensions may be rated, but a review keeps the ratings it
+// already has in current for dimensions disabled since.
+func SubRatings(ratings map[string]int, enabled []string, current map[string]int) Errors {
+	var errs Errors
+
+	for _, dimension := range slices.Sorted(maps.Keys(ratings)) {
+		rating := ratings[dimension]
+		field := "sub_ratings." + dimension
+		switch {
+		case rating == 0:
+			delete(ratings, dimension)
+		case rating < 1 || rating > 5:
+			errs.Add(field, CodeRange, "must be between 1 and 5")
+		case !slices.Contains(enabled, dimension) && current[dimension] != rating:
+			errs.Add(field, CodeFormat, "is not an enabled rating dimension")
+		}
+	}
+
+	return errs
+}
+
+// Register normalizes the request in place and validates it
+func Register(req *models.RegisterRequest) Errors {
+	var errs Errors
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+
+	username(&errs, req.Username)
+	email(&errs, req.Email)
+	password(&errs, req.Password)
+
+	return errs
+}
+
+// NewUser normalizes an admin-created account in place and validates it; an empty role means "user"
+func NewUser(req *models.CreateUserRequest) Errors {
+	var errs Errors
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Role == "" {
+		req.Role = RoleUser
+	}
+
+	username(&errs, req.Username)
+	email(&errs, req.Email)
+	password(&errs, req.Password)
+	role(&errs, req.Role)
+
+	return errs
+}
+
+// User normalizes a user update in place and validates it
+func User(req *models.UpdateUserRequest) Errors {
+	var errs Errors
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+
+	username(&errs, req.Username)
+	email(&errs, req.Email)
+	role(&errs, req.Role)
+
+	return errs
+}
+
+// Tag normalizes the request in place and validates it
+func Tag(req *models.TagRequest) Errors {
+	var errs Errors
+
+	req.Name = strings.TrimSpace(req.Name)
+	requiredText(&errs, "name", req.Name, maxTagLength)
+
+	return errs
+}
+
+// Webhook normalizes a subscription in place and validates it; an empty secret is generated by the caller
+func Webhook(req *models.WebhookRequest) Errors {
+	var errs Errors
+
+	req.URL = strings.TrimSpace(req.URL)
+	req.Secret = strings.TrimSpace(req.Secret)
+
+	if req.URL == "" {
+		errs.Add("url", CodeRequired, "is required")
+	} else if !isHTTPURL(req.URL) {
+		errs.Add("url", CodeFormat, "must be an absolute http or https URL")
+	}
+	if req.Secret != "" && len(req.Secret) < minSecret {
+		errs.Add("secret", CodeTooShort, fmt.Sprintf("must be at least %d characters", minSecret))
+	}
+
+	var events []string
+	for _, event := range req.Events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			errs.Add("events", CodeFormat, fmt.Sprintf("unknown event %q", event))
+		} else if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	req.Events = events
+	if len(req.Events) == 0 {
+		errs.Add("events", CodeRequired, "must include at least one event")
+	}
+
+	return errs
+}
+
+func username(errs *Errors, value string) {
+	switch n := utf8.RuneCountInString(value); {
+	case n == 0:
+		errs.Add("username", CodeRequired, "is required")
+	case n < minUsername:
+		errs.Add("username", CodeTooShort, fmt.Sprintf("must be at least %d characters", minUsername))
+	case n > maxUsername:
+		errs.Add("username", CodeTooLong, fmt.Sprintf("must be at most %d characters", maxUsername))
+	case !usernamePattern.MatchString(value):
+		errs.Add("username", CodeFormat, "may only contain letters, numbers, '.', '_' and '-'")
+	}
+}
+
+func email(errs *Errors, value string) {
+	if value == "" {
+		errs.Add("email", CodeRequired, "is required")
+	} else if !isEmail(value) {
+		errs.Add("email", CodeFormat, "must be a valid email address")
+	}
+}
+
+func password(errs *Errors, value string) {
+	if len(value) < minPassword {
+		errs.Add("password", CodeTooShort, fmt.Sprintf("must be at least %d characters", minPassword))
+	}
+}
+
+func role(errs *Errors, value string) {
+	if value != RoleUser && value != RoleAdmin {
+		errs.Add("role", CodeFormat, fmt.Sprintf("must be %q or %q", RoleUser, RoleAdmin))
+	}
+}
+
+func requiredText(errs *Errors, field, value string, max int) {
+	if value == "" {
+		errs.Add(field, CodeRequired, "is required")
+	} else if utf8.RuneCountInString(value) > max {
+		errs.Add(field, CodeTooLong, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+// normalizeTags trims tags and drops empty and duplicate ones
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, tag)
+	}
+	return out
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func isEmail(raw string) bool {
+	addr, err := mail.ParseAddress(raw)
+	if err != nil || addr.Address != raw {
+		return false
+	}
+	_, domain, _ := strings.Cut(raw, "@")
+	return strings.Contains(domain, ".")
+}
@@ -0,0 +1,333 @@
+package validation
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"cinerank/internal/models"
+)
+
+// summary lists errs as "field:code" pairs, in order
+func summary(errs Errors) string {
+	pairs := make([]string, len(errs))
+	for i, fe := range errs {
+		pairs[i] = fe.Field + ":" + fe.Code
+	}
+	return strings.Join(pairs, " ")
+}
+
+func TestMovie(t *testing.T) {
+	valid := func() models.CreateMovieRequest {
+		return models.CreateMovieRequest{Title: "Cidade de Deus", Director: "Fernando Meirelles", Year: 2002}
+	}
+	maxYear := time.Now().Year() + 5
+
+	tests := []struct {
+		name   string
+		modify func(*models.CreateMovieRequest)
+		want   string
+	}{
+		{"valid", func(*models.CreateMovieRequest) {}, ""},
+		{"blank title and director", func(m *models.CreateMovieRequest) { m.Title, m.Director = "  ", "" }, "title:required director:required"},
+		{"title at the limit", func(m *models.CreateMovieRequest) { m.Title = strings.Repeat("é", 255) }, ""},
+		{"title over the limit", func(m *models.CreateMovieRequest) { m.Title = strings.Repeat("é", 256) }, "title:too_long"},
+		{"first film year", func(m *models.CreateMovieRequest) { m.Year = FirstFilmYear }, ""},
+		{"before the first film", func(m *models.CreateMovieRequest) { m.Year = FirstFilmYear - 1 }, "year:out_of_range"},
+		{"five years ahead", func(m *models.CreateMovieRequest) { m.Year = maxYear }, ""},
+		{"six years ahead", func(m *models.CreateMovieRequest) { m.Year = maxYear + 1 }, "year:out_of_range"},
+		{"unknown IMDb rating", func(m *models.CreateMovieRequest) { m.IMDBRating = 0 }, ""},
+		{"lowest IMDb rating", func(m *models.CreateMovieRequest) { m.IMDBRating = 1 }, ""},
+		{"highest IMDb rating", func(m *models.CreateMovieRequest) { m.IMDBRating = 10 }, ""},
+		{"IMDb rating below 1", func(m *models.CreateMovieRequest) { m.IMDBRating = 0.5 }, "imdb_rating:out_of_range"},
+		{"IMDb rating above 10", func(m *models.CreateMovieRequest) { m.IMDBRating = 10.1 }, "imdb_rating:out_of_range"},
+		{"https poster", func(m *models.CreateMovieRequest) { m.PosterURL = " https://example.com/poster.jpg " }, ""},
+		{"ftp poster", func(m *models.CreateMovieRequest) { m.PosterURL = "ftp://example.com/poster.jpg" }, "poster_url:invalid_format"},
+		{"relative poster", func(m *models.CreateMovieRequest) { m.PosterURL = "/poster.jpg" }, "poster_url:invalid_format"},
+		{"poster without host", func(m *models.CreateMovieRequest) { m.PosterURL = "https://" }, "poster_url:invalid_format"},
+		{"20 tags", func(m *models.CreateMovieRequest) { m.Tags = numbered("tag", 20) }, ""},
+		{"21 tags", func(m *models.CreateMovieRequest) { m.Tags = numbered("tag", 21) }, "tags:too_long"},
+		{"tag at the limit", func(m *models.CreateMovieRequest) { m.Tags = []string{strings.Repeat("a", 100)} }, ""},
+		{"tag over the limit", func(m *models.CreateMovieRequest) {
+			m.Tags = []string{strings.Repeat("a", 101), strings.Repeat("b", 101)}
+		}, "tags:too_long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			tt.modify(&req)
+			if got := summary(Movie(&req)); got != tt.want {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMovieNormalizesInPlace(t *testing.T) {
+	req := models.CreateMovieRequest{
+		Title: "  Tropa de Elite ", Director: " José Padilha", Year: 2007, Plot: " Rio. ",
+		PosterURL: " https://example.com/p.jpg ", Tags: []string{" Ação", "", "ação ", "Crime", "  "},
+	}
+	if errs := Movie(&req); len(errs) != 0 {
+		t.Fatalf("errors = %v", errs)
+	}
+	if req.Title != "Tropa de Elite" || req.Director != "José Padilha" || req.Plot != "Rio." || req.PosterURL != "https://example.com/p.jpg" {
+		t.Errorf("fields not trimmed: %+v", req)
+	}
+	if !slices.Equal(req.Tags, []string{"Ação", "Crime"}) {
+		t.Errorf("tags = %q", req.Tags)
+	}
+
+	// More than 20 tags are fine while duplicates bring them down to 20
+	req.Tags = append(numbered("tag", 20), "TAG", " tagx ")
+	if errs := Movie(&req); len(errs) != 0 || len(req.Tags) != 20 {
+		t.Errorf("errors = %v, tags = %q", errs, req.Tags)
+	}
+}
+
+func TestReview(t *testing.T) {
+	valid := func() models.CreateReviewRequest {
+		return models.CreateReviewRequest{MovieID: 1, Rating: 3, Title: "Ótimo"}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*models.CreateReviewRequest)
+		want   string
+	}{
+		{"valid", func(*models.CreateReviewRequest) {}, ""},
+		{"rating 1", func(r *models.CreateReviewRequest) { r.Rating = 1 }, ""},
+		{"rating 5", func(r *models.CreateReviewRequest) { r.Rating = 5 }, ""},
+		{"rating 0", func(r *models.CreateReviewRequest) { r.Rating = 0 }, "rating:out_of_range"},
+		{"rating 6", func(r *models.CreateReviewRequest) { r.Rating = 6 }, "rating:out_of_range"},
+		{"no movie", func(r *models.CreateReviewRequest) { r.MovieID = 0 }, "movie_id:required"},
+		{"negative movie", func(r *models.CreateReviewRequest) { r.MovieID = -1 }, "movie_id:required"},
+		{"blank title", func(r *models.CreateReviewRequest) { r.Title = " \t " }, "title:required"},
+		{"title at the limit", func(r *models.CreateReviewRequest) { r.Title = strings.Repeat("ã", 255) }, ""},
+		{"title over the limit", func(r *models.CreateReviewRequest) { r.Title = strings.Repeat("ã", 256) }, "title:too_long"},
+		{"content at the limit", func(r *models.CreateReviewRequest) { r.Content = strings.Repeat("ç", 10000) }, ""},
+		{"content over the limit", func(r *models.CreateReviewRequest) { r.Content = strings.Repeat("ç", 10001) }, "content:too_long"},
+		{"padding does not count", func(r *models.CreateReviewRequest) { r.Content = " " + strings.Repeat("a", 10000) + " " }, ""},
+		{"everything wrong", func(r *models.CreateReviewRequest) { *r = models.CreateReviewRequest{Rating: 9} }, "movie_id:required rating:out_of_range title:required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			tt.modify(&req)
+			if got := summary(Review(&req)); got != tt.want {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReviewNormalizesInPlace(t *testing.T) {
+	req := models.CreateReviewRequest{MovieID: 1, Rating: 4, Title: "  Ótimo ", Content: "\n Vale a pena. \n"}
+	if errs := Review(&req); len(errs) != 0 {
+		t.Fatalf("errors = %v", errs)
+	}
+	if req.Title != "Ótimo" || req.Content != "Vale a pena." {
+		t.Errorf("title = %q, content = %q", req.Title, req.Content)
+	}
+}
+
+func TestSubRatings(t *testing.T) {
+	enabled := []string{models.DimensionStory, models.DimensionActing}
+
+	tests := []struct {
+		name    string
+		ratings map[string]int
+		current map[string]int
+		want    string
+		kept    []string
+	}{
+		{"none", nil, nil, "", nil},
+		{"lowest and highest", map[string]int{"story": 1, "acting": 5}, nil, "", []string{"acting", "story"}},
+		{"0 leaves a dimension unrated", map[string]int{"story": 0, "acting": 4}, nil, "", []string{"acting"}},
+		{"6", map[string]int{"story": 6}, nil, "sub_ratings.story:out_of_range", []string{"story"}},
+		{"negative", map[string]int{"acting": -1}, nil, "sub_ratings.acting:out_of_range", []string{"acting"}},
+		{"unknown dimension", map[string]int{"plot": 3}, nil, "sub_ratings.plot:invalid_format", []string{"plot"}},
+		{"disabled dimension", map[string]int{"soundtrack": 3}, nil, "sub_ratings.soundtrack:invalid_format", []string{"soundtrack"}},
+		{"disabled dimension kept as it was", map[string]int{"soundtrack": 3}, map[string]int{"soundtrack": 3}, "", []string{"soundtrack"}},
+		{"disabled dimension changed", map[string]int{"soundtrack": 4}, map[string]int{"soundtrack": 3}, "sub_ratings.soundtrack:invalid_format", []string{"soundtrack"}},
+		{"disabled dimension cleared", map[string]int{"soundtrack": 0}, map[string]int{"soundtrack": 3}, "", nil},
+		{"errors sorted by dimension name", map[string]int{"story": 7, "acting": 0, "cinematography": 2}, nil, "sub_ratings.cinematography:invalid_format sub_ratings.story:out_of_range", []string{"cinematography", "story"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summary(SubRatings(tt.ratings, enabled, tt.current)); got != tt.want {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+			if kept := slices.Sorted(maps.Keys(tt.ratings)); !slices.Equal(kept, tt.kept) {
+				t.Errorf("ratings left = %q, want %q", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	valid := func() models.RegisterRequest {
+		return models.RegisterRequest{Username: "cinefilo", Email: "cinefilo@example.com", Password: "password"}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*models.RegisterRequest)
+		want   string
+	}{
+		{"valid", func(*models.RegisterRequest) {}, ""},
+		{"no username", func(r *models.RegisterRequest) { r.Username = "  " }, "username:required"},
+		{"2 character username", func(r *models.RegisterRequest) { r.Username = "ab" }, "username:too_short"},
+		{"3 character username", func(r *models.RegisterRequest) { r.Username = "abc" }, ""},
+		{"50 character username", func(r *models.RegisterRequest) { r.Username = strings.Repeat("a", 50) }, ""},
+		{"51 character username", func(r *models.RegisterRequest) { r.Username = strings.Repeat("a", 51) }, "username:too_long"},
+		{"username punctuation", func(r *models.RegisterRequest) { r.Username = "cine_filo.2-b" }, ""},
+		{"username with a space", func(r *models.RegisterRequest) { r.Username = "cine filo" }, "username:invalid_format"},
+		{"username with an accent", func(r *models.RegisterRequest) { r.Username = "cinéfilo" }, "username:invalid_format"},
+		{"no email", func(r *models.RegisterRequest) { r.Email = "" }, "email:required"},
+		{"email without @", func(r *models.RegisterRequest) { r.Email = "cinefilo.example.com" }, "email:invalid_format"},
+		{"email without a dot in the domain", func(r *models.RegisterRequest) { r.Email = "cinefilo@localhost" }, "email:invalid_format"},
+		{"email with a display name", func(r *models.RegisterRequest) { r.Email = "Cinéfilo <cinefilo@example.com>" }, "email:invalid_format"},
+		{"7 character password", func(r *models.RegisterRequest) { r.Password = "1234567" }, "password:too_short"},
+		{"8 character password", func(r *models.RegisterRequest) { r.Password = "12345678" }, ""},
+		{"everything wrong", func(r *models.RegisterRequest) { *r = models.RegisterRequest{} }, "username:required email:required password:too_short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			tt.modify(&req)
+			if got := summary(Register(&req)); got != tt.want {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterNormalizesInPlace(t *testing.T) {
+	req := models.RegisterRequest{Username: " cinefilo ", Email: " cinefilo@example.com\n", Password: " secret  "}
+	if errs := Register(&req); len(errs) != 0 {
+		t.Fatalf("errors = %v", errs)
+	}
+	// Passwords are taken as typed
+	if req.Username != "cinefilo" || req.Email != "cinefilo@example.com" || req.Password != " secret  " {
+		t.Errorf("request = %+v", req)
+	}
+}
+
+func TestNewUserAndUserRoles(t *testing.T) {
+	tests := []struct {
+		role        string
+		wantRole    string
+		newUserErrs string
+		userErrs    string
+	}{
+		{"", RoleUser, "", "role:invalid_format"},
+		{RoleUser, RoleUser, "", ""},
+		{RoleAdmin, RoleAdmin, "", ""},
+		{"owner", "owner", "role:invalid_format", "role:invalid_format"},
+	}
+	for _, tt := range tests {
+		newUser := models.CreateUserRequest{Username: " novato ", Email: "novato@example.com", Password: "password", Role: tt.role}
+		if got := summary(NewUser(&newUser)); got != tt.newUserErrs || newUser.Role != tt.wantRole || newUser.Username != "novato" {
+			t.Errorf("NewUser with role %q: errors = %q, request = %+v", tt.role, got, newUser)
+		}
+
+		// Updates have no default role
+		update := models.UpdateUserRequest{Username: "novato", Email: " novato@example.com ", Role: tt.role}
+		if got := summary(User(&update)); got != tt.userErrs || update.Email != "novato@example.com" {
+			t.Errorf("User with role %q: errors = %q, request = %+v", tt.role, got, update)
+		}
+	}
+
+	if got := summary(NewUser(&models.CreateUserRequest{Username: "ab", Email: "x", Password: "short"})); got != "username:too_short email:invalid_format password:too_short" {
+		t.Errorf("NewUser errors = %q", got)
+	}
+}
+
+func TestTag(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want string
+	}{
+		{"valid", " Ação ", ""},
+		{"blank", "   ", "name:required"},
+		{"at the limit", strings.Repeat("á", 100), ""},
+		{"over the limit", strings.Repeat("á", 101), "name:too_long"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := models.TagRequest{Name: tt.tag}
+			if got := summary(Tag(&req)); got != tt.want {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+			if req.Name != strings.TrimSpace(tt.tag) {
+				t.Errorf("name = %q", req.Name)
+			}
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	valid := func() models.WebhookRequest {
+		return models.WebhookRequest{URL: "https://example.com/hook", Events: []string{models.EventReviewCreated}}
+	}
+
+	tests := []struct {
+		name       string
+		modify     func(*models.WebhookRequest)
+		want       string
+		wantEvents []string
+	}{
+		{"valid", func(*models.WebhookRequest) {}, "", []string{models.EventReviewCreated}},
+		{"no url", func(w *models.WebhookRequest) { w.URL = " " }, "url:required", []string{models.EventReviewCreated}},
+		{"url without scheme", func(w *models.WebhookRequest) { w.URL = "example.com/hook" }, "url:invalid_format", []string{models.EventReviewCreated}},
+		{"ftp url", func(w *models.WebhookRequest) { w.URL = "ftp://example.com/hook" }, "url:invalid_format", []string{models.EventReviewCreated}},
+		{"generated secret", func(w *models.WebhookRequest) { w.Secret = "  " }, "", []string{models.EventReviewCreated}},
+		{"15 character secret", func(w *models.WebhookRequest) { w.Secret = strings.Repeat("s", 15) }, "secret:too_short", []string{models.EventReviewCreated}},
+		{"16 character secret", func(w *models.WebhookRequest) { w.Secret = strings.Repeat("s", 16) }, "", []string{models.EventReviewCreated}},
+		{"duplicate events", func(w *models.WebhookRequest) {
+			w.Events = []string{models.EventMovieCreated, models.EventReviewCreated, models.EventMovieCreated}
+		}, "", []string{models.EventMovieCreated, models.EventReviewCreated}},
+		{"unknown event", func(w *models.WebhookRequest) { w.Events = []string{"movie.updated", models.EventMovieDeleted} }, "events:invalid_format", []string{models.EventMovieDeleted}},
+		{"no events", func(w *models.WebhookRequest) { w.Events = nil }, "events:required", nil},
+		{"only unknown events", func(w *models.WebhookRequest) { w.Events = []string{"movie.updated"} }, "events:invalid_format events:required", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			tt.modify(&req)
+			if got := summary(Webhook(&req)); got != tt.want {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+			if !slices.Equal(req.Events, tt.wantEvents) {
+				t.Errorf("events = %q, want %q", req.Events, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var errs Errors
+	errs.Add("title", CodeRequired, "is required")
+	errs.Add("title", CodeTooLong, "must be at most 255 characters")
+	errs.Add("rating", CodeRange, "must be between 1 and 5")
+
+	if got := errs.Error(); got != "validation failed: title: is required; title: must be at most 255 characters; rating: must be between 1 and 5" {
+		t.Errorf("Error() = %q", got)
+	}
+	if got := errs.Map(); len(got) != 2 || got["title"] != "is required" || got["rating"] != "must be between 1 and 5" {
+		t.Errorf("Map() = %v", got)
+	}
+}
+
+// numbered returns n distinct strings starting with prefix
+func numbered(prefix string, n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = prefix + strings.Repeat("x", i)
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+// Package webhooks delivers queued webhook events to subscribers with HMAC signatures and exponential retry.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cinerank/internal/models"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Cinerank-Event"
+	HeaderDelivery  = "X-Cinerank-Delivery"
+	HeaderSignature = "X-Cinerank-Signature"
+)
+
+const (
+	defaultInterval    = 5 * time.Second
+	defaultBatchSize   = 20
+	defaultMaxAttempts = 8
+	defaultBaseDelay   = 30 * time.Second
+	maxDelay           = 6 * time.Hour
+	requestTimeout     = 10 * time.Second
+	maxErrorLength     = 500
+)
+
+// Store is the queue the worker reads from; *database.DB implements it
+type Store interface {
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RecordDeliveryAttempt(ctx context.Context, d models.WebhookDelivery) error
+}
+
+// Worker polls the delivery queue and sends due deliveries
+type Worker struct {
+	Store       Store
+	Client      *http.Client
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	BaseDelay   time.Duration
+	now         func() time.Time
+}
+
+func NewWorker(store Store) *Worker {
+	return &Worker{
+		Store:       store,
+		Client:      &http.Client{Timeout: requestTimeout},
+		Interval:    defaultInterval,
+		BatchSize:   defaultBatchSize,
+		MaxAttempts: defaultMaxAttempts,
+		BaseDelay:   defaultBaseDelay,
+		now:         time.Now,
+	}
+}
+
+// Run delivers due events every Interval until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.DeliverDue(ctx); err != nil {
+			log.Printf("Error delivering webhooks: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue sends one batch of due deliveries and records the outcome of each
+func (w *Worker) DeliverDue(ctx context.Context) error {
+	// Claimed deliveries are hidden from other workers until the lease expires
+	lease := 2 * requestTimeout * time.Duration(w.BatchSize)
+	deliveries, err := w.Store.ClaimDueDeliveries(ctx, w.BatchSize, lease)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deliveries {
+		w.attempt(ctx, &d)
+		if ctx.Err() != nil {
+			// Interrupted attempts are not recorded; the lease expires and they are retried
+			return nil
+		}
+		if err := w.Store.RecordDeliveryAttempt(ctx, d); err != nil {
+			log.Printf("Error recording webhook delivery %d: %v", d.ID, err)
+		}
+	}
+	return nil
+}
+
+// attempt sends d once and updates its status, attempt count and next attempt time
+func (w *Worker) attempt(ctx context.Context, d *models.WebhookDelivery) {
+	d.Attempts++
+	d.ResponseStatus, d.LastError = w.send(ctx, d)
+
+	now := w.now()
+	switch {
+	case d.LastError == "":
+		d.Status = models.DeliveryDelivered
+		d.DeliveredAt = &now
+	case d.Attempts >= w.MaxAttempts:
+		d.Status = models.DeliveryFailed
+	default:
+		d.Status = models.DeliveryPending
+		d.NextAttemptAt = now.Add(Backoff(w.BaseDelay, d.Attempts))
+	}
+}
+
+func (w *Worker) send(ctx context.Context, d *models.WebhookDelivery) (int, string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cinerank-webhooks")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(d.ID))
+	req.Header.Set(HeaderSignature, Sign(d.Secret, d.Payload))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return 0, truncate(err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+		return resp.StatusCode, truncate(fmt.Sprintf("unexpected status %d: %s", resp.StatusCode, body))
+	}
+	return resp.StatusCode, ""
+}
+
+// Backoff returns the wait before the next attempt: base, 2*base, 4*base, ... capped at six hours
+func Backoff(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by the hex HMAC-SHA256 under secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature matches body; receivers written in Go can use it as is
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// NewSecret returns a random signing secret for subscriptions created without one
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// truncate shortens s for the delivery log; response bodies may be arbitrary bytes, which Postgres text rejects
+func truncate(s string) string {
+	if len(s) > maxErrorLength {
+		s = s[:maxErrorLength]
+	}
+	return strings.ToValidUTF8(strings.ReplaceAll(s, "\x00", ""), "")
+}
@@ -0,0 +1,124 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cinerank/internal/models"
+)
+
+type fakeStore struct {
+	due      []models.WebhookDelivery
+	recorded []models.WebhookDelivery
+}
+
+func (s *fakeStore) ClaimDueDeliveries(_ context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	due := s.due
+	s.due = nil
+	return due, nil
+}
+
+func (s *fakeStore) RecordDeliveryAttempt(_ context.Context, d models.WebhookDelivery) error {
+	s.recorded = append(s.recorded, d)
+	return nil
+}
+
+func newTestWorker(store Store) (*Worker, time.Time) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	w := NewWorker(store)
+	w.now = func() time.Time { return now }
+	return w, now
+}
+
+func TestDeliverDueSignsPayload(t *testing.T) {
+	payload := []byte(`{"event":"review.created","data":{"id":1}}`)
+	var got *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	store := &fakeStore{due: []models.WebhookDelivery{{
+		ID: 42, Event: models.EventReviewCreated, Payload: payload,
+		Status: models.DeliveryPending, URL: server.URL, Secret: "topsecret",
+	}}}
+	worker, now := newTestWorker(store)
+
+	if err := worker.DeliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Header.Get(HeaderEvent) != models.EventReviewCreated || got.Header.Get(HeaderDelivery) != "42" {
+		t.Errorf("headers = %v", got.Header)
+	}
+	if !Verify("topsecret", body, got.Header.Get(HeaderSignature)) {
+		t.Errorf("signature %q does not match body", got.Header.Get(HeaderSignature))
+	}
+	if Verify("othersecret", body, got.Header.Get(HeaderSignature)) {
+		t.Error("signature verified under the wrong secret")
+	}
+
+	d := store.recorded[0]
+	if d.Status != models.DeliveryDelivered || d.Attempts != 1 || d.ResponseStatus != http.StatusNoContent {
+		t.Errorf("recorded = %+v", d)
+	}
+	if d.DeliveredAt == nil || !d.DeliveredAt.Equal(now) {
+		t.Errorf("delivered_at = %v", d.DeliveredAt)
+	}
+}
+
+func TestDeliverDueRetriesWithBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	store := &fakeStore{due: []models.WebhookDelivery{
+		{ID: 1, Attempts: 2, Payload: []byte(`{}`), URL: server.URL},
+		{ID: 2, Attempts: 7, Payload: []byte(`{}`), URL: server.URL},
+	}}
+	worker, now := newTestWorker(store)
+
+	if err := worker.DeliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	retry, failed := store.recorded[0], store.recorded[1]
+	if retry.Status != models.DeliveryPending || retry.Attempts != 3 {
+		t.Errorf("retry = %+v", retry)
+	}
+	if want := now.Add(4 * defaultBaseDelay); !retry.NextAttemptAt.Equal(want) {
+		t.Errorf("next attempt = %v, want %v", retry.NextAttemptAt, want)
+	}
+	if retry.ResponseStatus != http.StatusServiceUnavailable || !strings.Contains(retry.LastError, "unavailable") {
+		t.Errorf("retry error = %d %q", retry.ResponseStatus, retry.LastError)
+	}
+	if failed.Status != models.DeliveryFailed || failed.Attempts != defaultMaxAttempts {
+		t.Errorf("failed = %+v", failed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{20, maxDelay},
+	}
+	for _, tt := range tests {
+		if got := Backoff(30*time.Second, tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
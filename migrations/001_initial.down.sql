@@ -1,3 +1,6 @@
--- Drop tables in reverse order
+-- Drop tables in reverse order; later migrations' tables are dropped too in case they were not rolled back first
+DROP TABLE IF EXISTS movie_tags;
+DROP TABLE IF EXISTS tags;
 DROP TABLE IF EXISTS reviews;
-DROP TABLE IF EXISTS movies;
\ No newline at end of file
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS movies;
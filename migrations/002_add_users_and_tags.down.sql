@@ -0,0 +1,7 @@
+-- Drop reviews.user_id before the users table it references
+ALTER TABLE reviews DROP COLUMN IF EXISTS user_id;
+
+-- Drop tables in reverse order
+DROP TABLE IF EXISTS movie_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS users;
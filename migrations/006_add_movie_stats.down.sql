@@ -0,0 +1,2 @@
+-- Drop movie_stats table
+DROP TABLE IF EXISTS movie_stats;
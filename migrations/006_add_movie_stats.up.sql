@@ -0,0 +1,22 @@
+-- Create movie_stats table; review writes keep it current in the same transaction, so reads
+-- no longer aggregate over every review
+CREATE TABLE IF NOT EXISTS movie_stats (
+    movie_id INTEGER PRIMARY KEY REFERENCES movies(id) ON DELETE CASCADE,
+    review_count INTEGER NOT NULL DEFAULT 0,
+    rating_sum INTEGER NOT NULL DEFAULT 0,
+    rating_1 INTEGER NOT NULL DEFAULT 0,
+    rating_2 INTEGER NOT NULL DEFAULT 0,
+    rating_3 INTEGER NOT NULL DEFAULT 0,
+    rating_4 INTEGER NOT NULL DEFAULT 0,
+    rating_5 INTEGER NOT NULL DEFAULT 0,
+    last_reviewed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Backfill from the existing reviews
+INSERT INTO movie_stats (movie_id, review_count, rating_sum, rating_1, rating_2, rating_3, rating_4, rating_5, last_reviewed_at)
+SELECT movie_id, COUNT(*), SUM(rating),
+       COUNT(*) FILTER (WHERE rating = 1), COUNT(*) FILTER (WHERE rating = 2),
+       COUNT(*) FILTER (WHERE rating = 3), COUNT(*) FILTER (WHERE rating = 4),
+       COUNT(*) FILTER (WHERE rating = 5), MAX(created_at)
+FROM reviews
+GROUP BY movie_id;
@@ -0,0 +1,3 @@
+-- Drop review_ratings table and its setting
+DROP TABLE IF EXISTS review_ratings;
+DELETE FROM settings WHERE key = 'rating_dimensions';
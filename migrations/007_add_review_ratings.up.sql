@@ -0,0 +1,12 @@
+-- Create review_ratings table for the optional per-dimension ratings of a review, next to its
+-- overall rating
+CREATE TABLE IF NOT EXISTS review_ratings (
+    review_id INTEGER NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    dimension VARCHAR(50) NOT NULL CHECK (dimension IN ('story', 'acting', 'cinematography', 'soundtrack', 'rewatchability')),
+    rating INTEGER NOT NULL CHECK (rating >= 1 AND rating <= 5),
+    PRIMARY KEY (review_id, dimension)
+);
+
+-- Every dimension is enabled until an admin turns some off
+INSERT INTO settings (key, value) VALUES ('rating_dimensions', 'story,acting,cinematography,soundtrack,rewatchability')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+-- Drop the last TOTP time step column
+ALTER TABLE users DROP COLUMN IF EXISTS totp_last_step;
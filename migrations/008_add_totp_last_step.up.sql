@@ -0,0 +1,2 @@
+-- Remember the last TOTP time step each user signed in with, so a code cannot be used twice
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT;